@@ -1,91 +1,211 @@
 package chaincode
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
+	"sync"
+	"time"
 
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/checkpoint"
 	"github.com/hyperledger-labs/cc-tools-demo/ccapi/common"
-	ev "github.com/hyperledger/fabric-sdk-go/pkg/client/event"
-	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
 )
 
-func getEventClient(channelName string) (*ev.Client, error) {
-	// create channel manager
-	fabMngr, err := common.NewFabricChClient(channelName, os.Getenv("USER"), os.Getenv("ORG"))
+// ChaincodeEventHandler processes a chaincode event. The key identifies
+// the event across replays, so that handlers can discard duplicates.
+// Returning an error stops the stream, which is resumed from the last
+// checkpoint after a delay, so the event is delivered again. An event still
+// failing after EVENT_HANDLER_MAX_ATTEMPTS attempts is moved to the skipped
+// events store, from which ReplaySkippedEvent hands it to the handler again.
+type ChaincodeEventHandler func(ccEvent *client.ChaincodeEvent, key string) error
+
+// listenerHandlers holds the handler of each running listener, by
+// checkpoint name, for the replay of its skipped events
+var listenerHandlers sync.Map
+
+// EventKey is the idempotency key of the event emitted by a transaction
+func EventKey(channelName, ccName string, blockNumber uint64, txID string) string {
+	return fmt.Sprintf("%s/%s/%d/%s", channelName, ccName, blockNumber, txID)
+}
+
+// ListenChaincodeEvents delivers the events of a chaincode to the handler
+// at least once. The listener checkpoint is saved after each handled event
+// and, on startup or after a failure, events are replayed from it through
+// the gateway. A listener without a checkpoint starts at the next commit.
+// It runs until ctx is cancelled.
+func ListenChaincodeEvents(ctx context.Context, channelName, ccName, listener string, handle ChaincodeEventHandler) {
+	checkpointName := channelName + "/" + ccName + "/" + listener
+	listenerHandlers.Store(checkpointName, handle)
+	failures := checkpoint.NewFailures()
+	retryDelay := time.Second
+
+	for {
+		progressed, err := listenChaincodeEvents(ctx, channelName, ccName, checkpointName, handle, failures)
+		if ctx.Err() != nil {
+			return
+		}
+		if progressed {
+			retryDelay = time.Second
+		}
+		log.Printf("%s event listener stopped, resuming in %s: %v\n", checkpointName, retryDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+		if retryDelay < 30*time.Second {
+			retryDelay *= 2
+		}
+	}
+}
+
+// listenChaincodeEvents runs one event stream from the listener checkpoint
+// until it fails, reporting whether any event was processed
+func listenChaincodeEvents(ctx context.Context, channelName, ccName, checkpointName string, handle ChaincodeEventHandler, failures *checkpoint.Failures) (bool, error) {
+	grpcConn, err := common.CreateGrpcConnection(os.Getenv("FABRIC_GATEWAY_ENDPOINT"))
 	if err != nil {
-		return nil, err
+		return false, errors.Wrap(err, "failed to create grpc connection")
 	}
+	defer grpcConn.Close()
 
-	// Create event client
-	ec, err := ev.New(fabMngr.Provider, ev.WithBlockEvents())
+	gw, err := common.CreateGatewayConnection(grpcConn, os.Getenv("USER"))
 	if err != nil {
-		return nil, err
+		return false, errors.Wrap(err, "failed to create gateway connection")
 	}
+	defer gw.Close()
 
-	return ec, nil
-}
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-func WaitForEvent(channelName, ccName, eventName string, fn func(*fab.CCEvent)) {
-	ec, err := getEventClient(channelName)
+	store := checkpoint.Default()
+	position := store.Get(checkpointName)
+	events, err := gw.GetNetwork(channelName).ChaincodeEvents(streamCtx, ccName, client.WithCheckpoint(position))
 	if err != nil {
-		log.Println("error getting event client: ", err)
-		return
+		return false, errors.Wrap(err, "failed to start chaincode event stream")
 	}
 
-	for {
-		// Register chaincode event
-		registration, notifier, err := ec.RegisterChaincodeEvent(ccName, eventName)
-		if err != nil {
-			log.Println("error registering chaincode event: ", err)
-			return
+	progressed := false
+	for event := range events {
+		key := EventKey(channelName, ccName, event.BlockNumber, event.TransactionID)
+		if err := handle(event, key); err != nil {
+			attempts, retry := failures.Failed(key)
+			if retry {
+				return progressed, errors.Wrapf(err, "failed to handle event %s (attempt %d)", key, attempts)
+			}
+			if err := skipEvent(checkpointName, event, key, attempts, err); err != nil {
+				return progressed, errors.Wrapf(err, "failed to store skipped event %s", key)
+			}
+			log.Printf("%s skipping event %s after %d failed attempts: %v\n", checkpointName, key, attempts, err)
+		} else {
+			failures.Succeeded(key)
 		}
 
-		// Execute handler function on event notification
-		ccEvent := <-notifier
-		fmt.Printf("Received CC event: %v\n", ccEvent)
-		fn(ccEvent)
-
-		ec.Unregister(registration)
+		position = position.Processed(event.BlockNumber, event.TransactionID)
+		if err := store.Save(checkpointName, position); err != nil {
+			return progressed, errors.Wrap(err, "failed to save event checkpoint")
+		}
+		progressed = true
 	}
+
+	return progressed, errors.New("chaincode event stream closed")
 }
 
-func HandleEvent(channelName, ccName string, event EventHandler) {
-	ec, err := getEventClient(channelName)
+// skipEvent records an event the listener gives up on, before the
+// checkpoint moves past it
+func skipEvent(checkpointName string, event *client.ChaincodeEvent, key string, attempts int, cause error) error {
+	return checkpoint.DefaultSkipped().Put(checkpoint.SkippedEvent{
+		ID:            checkpoint.SkippedID(checkpointName, key),
+		Listener:      checkpointName,
+		Key:           key,
+		ChaincodeName: event.ChaincodeName,
+		EventName:     event.EventName,
+		BlockNumber:   event.BlockNumber,
+		TxID:          event.TransactionID,
+		Payload:       event.Payload,
+		Attempts:      attempts,
+		LastError:     cause.Error(),
+		SkippedAt:     time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// ReplaySkippedEvent takes a skipped event out of the store and hands it
+// to its listener handler again, with the same key. An event that fails
+// again, or whose listener is not running, returns to the store.
+func ReplaySkippedEvent(id string) error {
+	skipped, err := checkpoint.DefaultSkipped().Take(id)
 	if err != nil {
-		log.Println("error getting event client: ", err)
-		return
+		return err
 	}
 
-	for {
-		// Register chaincode event
-		registration, notifier, err := ec.RegisterChaincodeEvent(ccName, event.Tag)
-		if err != nil {
-			log.Println("error registering chaincode event: ", err)
-			return
+	handle, ok := listenerHandlers.Load(skipped.Listener)
+	if !ok {
+		if err := checkpoint.DefaultSkipped().Put(skipped); err != nil {
+			log.Println("error restoring skipped event: ", err)
+		}
+		return fmt.Errorf("listener %s of event %s: %w", skipped.Listener, id, checkpoint.ErrNotFound)
+	}
+
+	event := &client.ChaincodeEvent{
+		BlockNumber:   skipped.BlockNumber,
+		TransactionID: skipped.TxID,
+		ChaincodeName: skipped.ChaincodeName,
+		EventName:     skipped.EventName,
+		Payload:       skipped.Payload,
+	}
+	if err := handle.(ChaincodeEventHandler)(event, skipped.Key); err != nil {
+		skipped.Attempts++
+		skipped.LastError = err.Error()
+		skipped.SkippedAt = time.Now().UTC().Format(time.RFC3339)
+		if err := checkpoint.DefaultSkipped().Put(skipped); err != nil {
+			log.Println("error restoring skipped event: ", err)
+		}
+		return errors.Wrapf(err, "failed to handle event %s", skipped.Key)
+	}
+
+	return nil
+}
+
+func WaitForEvent(ctx context.Context, channelName, ccName, eventName string, fn func(*client.ChaincodeEvent)) {
+	ListenChaincodeEvents(ctx, channelName, ccName, "wait:"+eventName, func(ccEvent *client.ChaincodeEvent, key string) error {
+		if ccEvent.EventName != eventName {
+			return nil
 		}
 
 		// Execute handler function on event notification
-		ccEvent := <-notifier
 		fmt.Printf("Received CC event: %v\n", ccEvent)
-		event.Execute(ccEvent)
+		fn(ccEvent)
+		return nil
+	})
+}
 
-		ec.Unregister(registration)
-	}
+func HandleEvent(ctx context.Context, channelName, ccName string, event EventHandler) {
+	ListenChaincodeEvents(ctx, channelName, ccName, "handler:"+event.Tag, func(ccEvent *client.ChaincodeEvent, key string) error {
+		if ccEvent.EventName != event.Tag {
+			return nil
+		}
+
+		// Execute handler function on event notification
+		fmt.Printf("Received CC event: %v\n", ccEvent)
+		return event.Execute(ccEvent, key)
+	})
 }
 
-func RegisterForEvents() {
+func RegisterForEvents(ctx context.Context) {
 	// Get registered events on the chaincode
-	res, _, err := Invoke(os.Getenv("CHANNEL"), os.Getenv("CCNAME"), "getEvents", os.Getenv("USER"), nil, nil)
+	res, err := QueryGateway(os.Getenv("CHANNEL"), os.Getenv("CCNAME"), "getEvents", os.Getenv("USER"), nil)
 	if err != nil {
 		fmt.Println("error registering for events: ", err)
 		return
 	}
 
 	var events []interface{}
-	nerr := json.Unmarshal(res.Payload, &events)
+	nerr := json.Unmarshal(res, &events)
 	if nerr != nil {
 		fmt.Println("error unmarshalling events: ", nerr)
 		return
@@ -139,7 +259,7 @@ func RegisterForEvents() {
 				ReadOnly:    eventMap["readOnly"].(bool),
 			}
 
-			go HandleEvent(os.Getenv("CHANNEL"), os.Getenv("CCNAME"), eventHandler)
+			go HandleEvent(ctx, os.Getenv("CHANNEL"), os.Getenv("CCNAME"), eventHandler)
 		}
 	}
 }
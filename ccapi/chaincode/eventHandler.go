@@ -6,7 +6,8 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/webhook"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
 type EventType float64
@@ -15,6 +16,7 @@ const (
 	EventLog EventType = iota
 	EventTransaction
 	EventCustom
+	EventWebhook
 )
 
 type EventHandler struct {
@@ -28,7 +30,12 @@ type EventHandler struct {
 	ReadOnly    bool
 }
 
-func (event EventHandler) Execute(ccEvent *fab.CCEvent) {
+// Execute runs the handler for an event identified by key. Errors are only
+// returned for failures worth retrying: the event is then delivered again,
+// up to EVENT_HANDLER_MAX_ATTEMPTS times, so transactions invoked by
+// handlers must tolerate replays. They receive the key in the
+// EventKeyTransient transient field to recognize them.
+func (event EventHandler) Execute(ccEvent *client.ChaincodeEvent, key string) error {
 	if len(event.BaseLog) > 0 {
 		fmt.Println(event.BaseLog)
 	}
@@ -38,7 +45,7 @@ func (event EventHandler) Execute(ccEvent *fab.CCEvent) {
 		nerr := json.Unmarshal(ccEvent.Payload, &logStr)
 		if nerr != nil {
 			fmt.Println("error unmarshalling log: ", nerr)
-			return
+			return nil
 		}
 
 		if len(logStr) > 0 {
@@ -54,17 +61,17 @@ func (event EventHandler) Execute(ccEvent *fab.CCEvent) {
 			cc = event.Chaincode
 		}
 
-		res, _, err := Invoke(ch, cc, event.Transaction, os.Getenv("USER"), [][]byte{ccEvent.Payload}, nil)
+		res, err := InvokeGatewayForEvent(ch, cc, event.Transaction, os.Getenv("USER"), []string{string(ccEvent.Payload)}, key)
 		if err != nil {
 			fmt.Println("error invoking transaction: ", err)
-			return
+			return err
 		}
 
 		var response map[string]interface{}
-		nerr := json.Unmarshal(res.Payload, &response)
+		nerr := json.Unmarshal(res, &response)
 		if nerr != nil {
 			fmt.Println("error unmarshalling response: ", nerr)
-			return
+			return nil
 		}
 		fmt.Println("Response: ", response)
 	} else if event.Type == EventCustom {
@@ -77,7 +84,7 @@ func (event EventHandler) Execute(ccEvent *fab.CCEvent) {
 		})
 		if ok != nil {
 			fmt.Println("failed to encode args to JSON format")
-			return
+			return nil
 		}
 
 		// Invoke tx
@@ -86,12 +93,26 @@ func (event EventHandler) Execute(ccEvent *fab.CCEvent) {
 			txName = "runEvent"
 		}
 
-		_, _, err := Invoke(os.Getenv("CHANNEL"), os.Getenv("CCNAME"), txName, os.Getenv("USER"), [][]byte{args}, nil)
+		_, err := InvokeGatewayForEvent(os.Getenv("CHANNEL"), os.Getenv("CCNAME"), txName, os.Getenv("USER"), []string{string(args)}, key)
 		if err != nil {
 			fmt.Println("error invoking transaction: ", err)
-			return
+			return err
+		}
+	} else if event.Type == EventWebhook {
+		// POST the payload to the webhooks registered for the event tag,
+		// waiting at most WEBHOOK_WAIT_TIMEOUT so that a slow webhook does not
+		// hold back the listener
+		finished, err := webhook.Default.DispatchWait(event.Tag, key, ccEvent.Payload)
+		if err != nil {
+			fmt.Println("error recording webhook deliveries: ", err)
+			return err
+		}
+		if !finished {
+			fmt.Println("webhook deliveries still running, continuing in the background: ", key)
 		}
 	} else {
 		fmt.Println("Event type not supported")
 	}
+
+	return nil
 }
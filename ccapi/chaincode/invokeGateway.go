@@ -8,7 +8,35 @@ import (
 	"github.com/pkg/errors"
 )
 
+// EventKeyTransient is the transient field carrying the idempotency key of
+// the chaincode event a transaction is invoked for, which the chaincode can
+// use to discard replays of the same event
+const EventKeyTransient = "@eventKey"
+
 func InvokeGateway(channelName, chaincodeName, txName, user string, args []string, transientArgs []byte, endorsingOrgs []string) ([]byte, error) {
+	options := []client.ProposalOption{client.WithArguments(args...)}
+
+	// Make transient request
+	if transientArgs != nil {
+		options = append(options, client.WithTransient(map[string][]byte{"@request": transientArgs}))
+	}
+	if len(endorsingOrgs) > 0 {
+		options = append(options, client.WithEndorsingOrganizations(endorsingOrgs...))
+	}
+
+	return submitGateway(channelName, chaincodeName, txName, user, options...)
+}
+
+// InvokeGatewayForEvent submits a transaction triggered by the chaincode
+// event identified by key, sent in the EventKeyTransient transient field
+func InvokeGatewayForEvent(channelName, chaincodeName, txName, user string, args []string, key string) ([]byte, error) {
+	return submitGateway(channelName, chaincodeName, txName, user,
+		client.WithArguments(args...),
+		client.WithTransient(map[string][]byte{EventKeyTransient: []byte(key)}),
+	)
+}
+
+func submitGateway(channelName, chaincodeName, txName, user string, options ...client.ProposalOption) ([]byte, error) {
 	// Gateway endpoint
 	endpoint := os.Getenv("FABRIC_GATEWAY_ENDPOINT")
 
@@ -30,32 +58,6 @@ func InvokeGateway(channelName, chaincodeName, txName, user string, args []strin
 	network := gw.GetNetwork(channelName)
 	contract := network.GetContract(chaincodeName)
 
-	// Make transient request
-	transientMap := make(map[string][]byte)
-	transientMap["@request"] = transientArgs
-
 	// Invoke transaction
-	if transientArgs != nil && len(endorsingOrgs) > 0 {
-		return contract.Submit(txName,
-			client.WithArguments(args...),
-			client.WithTransient(transientMap),
-			client.WithEndorsingOrganizations(endorsingOrgs...),
-		)
-	}
-
-	if transientArgs != nil {
-		return contract.Submit(txName,
-			client.WithArguments(args...),
-			client.WithTransient(transientMap),
-		)
-	}
-
-	if len(endorsingOrgs) > 0 {
-		return contract.Submit(txName,
-			client.WithArguments(args...),
-			client.WithEndorsingOrganizations(endorsingOrgs...),
-		)
-	}
-
-	return contract.SubmitTransaction(txName, args...)
+	return contract.Submit(txName, options...)
 }
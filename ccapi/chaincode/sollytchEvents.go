@@ -0,0 +1,311 @@
+package chaincode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/common"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/webhook"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/pkg/errors"
+)
+
+// SollytchEventVersion is the newest event schema version understood here
+const SollytchEventVersion = 1
+
+// SollytchBatchEvent is the event name used when a transaction emits more
+// than one event, since Fabric only delivers the last one set
+const SollytchBatchEvent = "SollytchEvents"
+
+// SollytchEventTypes lists the events emitted by sollytch-chain and sollytch-image
+var SollytchEventTypes = []string{
+	"TestStored",
+	"TestUpdated",
+	"TestRepredicted",
+	"TestImageLinked",
+	"PredictionFlagged",
+	"HazardAlert",
+	"ModelRegistered",
+	"ModelPromoted",
+	"PlanilhaAnchored",
+	"LoteStatusChanged",
+	"PredictionConfigChanged",
+	"AlertConfigChanged",
+	"StateKeysMigrated",
+	"ImageAnchored",
+	"ImageUpdated",
+	"ImageKitReassigned",
+	"ImageRevoked",
+}
+
+// SollytchEvent is a typed chaincode event together with where it was
+// committed. Data is kept raw, its layout depends on Type and Version.
+// ID stays the same when the event is replayed.
+type SollytchEvent struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Version     int             `json:"version"`
+	TxID        string          `json:"tx_id"`
+	Timestamp   string          `json:"timestamp"`
+	Data        json.RawMessage `json:"data"`
+	Channel     string          `json:"channel"`
+	Chaincode   string          `json:"chaincode"`
+	BlockNumber uint64          `json:"block_number"`
+}
+
+// SollytchChaincodes returns the names of the chaincodes that emit typed events
+func SollytchChaincodes() []string {
+	names := []string{"sollytch-chain", "sollytch-image"}
+	for i, env := range []string{"SOLLYTCH_CHAIN_CCNAME", "SOLLYTCH_IMAGE_CCNAME"} {
+		if value := os.Getenv(env); value != "" {
+			names[i] = value
+		}
+	}
+	return names
+}
+
+// ParseSollytchEvent decodes a chaincode event, single or batched, into its
+// typed events, identified by the event key and their position in the
+// batch. Events with a newer schema version are rejected.
+func ParseSollytchEvent(channelName string, ccEvent *client.ChaincodeEvent, key string) ([]SollytchEvent, error) {
+	var events []SollytchEvent
+
+	if ccEvent.EventName == SollytchBatchEvent {
+		var batch struct {
+			Version int             `json:"version"`
+			Events  []SollytchEvent `json:"events"`
+		}
+		if err := json.Unmarshal(ccEvent.Payload, &batch); err != nil {
+			return nil, fmt.Errorf("invalid event batch in tx %s: %w", ccEvent.TransactionID, err)
+		}
+		if batch.Version > SollytchEventVersion {
+			return nil, fmt.Errorf("unsupported event batch version %d in tx %s", batch.Version, ccEvent.TransactionID)
+		}
+		events = batch.Events
+	} else {
+		var event SollytchEvent
+		if err := json.Unmarshal(ccEvent.Payload, &event); err != nil {
+			return nil, fmt.Errorf("invalid event %s in tx %s: %w", ccEvent.EventName, ccEvent.TransactionID, err)
+		}
+		events = []SollytchEvent{event}
+	}
+
+	for i := range events {
+		if events[i].Version > SollytchEventVersion {
+			return nil, fmt.Errorf("unsupported %s event version %d in tx %s", events[i].Type, events[i].Version, ccEvent.TransactionID)
+		}
+		events[i].ID = fmt.Sprintf("%s#%d", key, i)
+		events[i].Channel = channelName
+		events[i].Chaincode = ccEvent.ChaincodeName
+		events[i].BlockNumber = ccEvent.BlockNumber
+	}
+
+	return events, nil
+}
+
+// EventBus fans typed events out to every subscribed consumer
+type EventBus struct {
+	mu          sync.RWMutex
+	next        int
+	subscribers map[int]*eventSubscriber
+}
+
+type eventSubscriber struct {
+	types  map[string]bool
+	events chan SollytchEvent
+}
+
+// SollytchEvents is the bus the event listeners publish to
+var SollytchEvents = NewEventBus()
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[int]*eventSubscriber{}}
+}
+
+// Subscribe returns a channel receiving the given event types (all of them
+// when none is given) and a function that cancels the subscription
+func (b *EventBus) Subscribe(buffer int, types ...string) (<-chan SollytchEvent, func()) {
+	subscriber := &eventSubscriber{events: make(chan SollytchEvent, buffer)}
+	if len(types) > 0 {
+		subscriber.types = map[string]bool{}
+		for _, eventType := range types {
+			subscriber.types[eventType] = true
+		}
+	}
+
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = subscriber
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, id)
+			b.mu.Unlock()
+			close(subscriber.events)
+		})
+	}
+
+	return subscriber.events, cancel
+}
+
+// Publish delivers the event to the interested subscribers. A subscriber
+// whose buffer is full misses the event instead of stalling the others.
+func (b *EventBus) Publish(event SollytchEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, subscriber := range b.subscribers {
+		if subscriber.types != nil && !subscriber.types[event.Type] {
+			continue
+		}
+
+		select {
+		case subscriber.events <- event:
+		default:
+			log.Printf("event consumer buffer full, dropping %s event from tx %s\n", event.Type, event.TxID)
+		}
+	}
+}
+
+// HandleSollytchEvents listens to the typed events of a chaincode,
+// publishes them to the SollytchEvents bus and delivers them to the
+// registered webhooks. Events are published first, so that a slow webhook
+// does not delay the bus consumers, which only see the events received
+// while they are subscribed. Events are checkpointed once the webhook
+// deliveries succeeded or were dead lettered, or once WEBHOOK_WAIT_TIMEOUT
+// elapsed and the deliveries still running were recorded as in-flight dead
+// letters, which are resumed after a restart, so none is lost.
+func HandleSollytchEvents(ctx context.Context, channelName, ccName string) {
+	eventNames := sollytchEventNames()
+
+	ListenChaincodeEvents(ctx, channelName, ccName, "sollytch", func(ccEvent *client.ChaincodeEvent, key string) error {
+		if !eventNames[ccEvent.EventName] {
+			return nil
+		}
+
+		events, err := ParseSollytchEvent(channelName, ccEvent, key)
+		if err != nil {
+			log.Println("error parsing chaincode event: ", err)
+			return nil
+		}
+
+		for _, event := range events {
+			SollytchEvents.Publish(event)
+		}
+
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			finished, err := webhook.Default.DispatchWait(event.Type, event.ID, data)
+			if err != nil {
+				return err
+			}
+			if !finished {
+				log.Printf("webhook deliveries of %s still running, continuing in the background\n", event.ID)
+			}
+		}
+
+		return nil
+	})
+}
+
+// sollytchEventNames returns the chaincode event names carrying typed events:
+// each event type and the batch of the transactions emitting several
+func sollytchEventNames() map[string]bool {
+	eventNames := map[string]bool{SollytchBatchEvent: true}
+	for _, eventType := range SollytchEventTypes {
+		eventNames[eventType] = true
+	}
+	return eventNames
+}
+
+// ReplaySollytchEvents streams the typed events of the sollytch chaincodes
+// committed from the given block on, then the new ones as they commit. The
+// channel is closed once ctx is cancelled or an event stream fails.
+func ReplaySollytchEvents(ctx context.Context, channelName string, fromBlock uint64) (<-chan SollytchEvent, error) {
+	eventNames := sollytchEventNames()
+
+	grpcConn, err := common.CreateGrpcConnection(os.Getenv("FABRIC_GATEWAY_ENDPOINT"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create grpc connection")
+	}
+
+	gw, err := common.CreateGatewayConnection(grpcConn, os.Getenv("USER"))
+	if err != nil {
+		grpcConn.Close()
+		return nil, errors.Wrap(err, "failed to create gateway connection")
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	network := gw.GetNetwork(channelName)
+	out := make(chan SollytchEvent)
+
+	var streams sync.WaitGroup
+	for _, ccName := range SollytchChaincodes() {
+		ccEvents, err := network.ChaincodeEvents(streamCtx, ccName, client.WithStartBlock(fromBlock))
+		if err != nil {
+			cancel()
+			streams.Wait()
+			gw.Close()
+			grpcConn.Close()
+			return nil, errors.Wrap(err, "failed to start chaincode event stream")
+		}
+
+		streams.Add(1)
+		go func(ccName string) {
+			defer streams.Done()
+			// One stream ending ends the replay, so no chaincode is silently missing
+			defer cancel()
+
+			for ccEvent := range ccEvents {
+				// Other events of the chaincodes are not typed events
+				if !eventNames[ccEvent.EventName] {
+					continue
+				}
+
+				key := EventKey(channelName, ccName, ccEvent.BlockNumber, ccEvent.TransactionID)
+				events, err := ParseSollytchEvent(channelName, ccEvent, key)
+				if err != nil {
+					log.Println("error parsing chaincode event: ", err)
+					continue
+				}
+
+				for _, event := range events {
+					select {
+					case out <- event:
+					case <-streamCtx.Done():
+						return
+					}
+				}
+			}
+		}(ccName)
+	}
+
+	go func() {
+		streams.Wait()
+		cancel()
+		close(out)
+		gw.Close()
+		grpcConn.Close()
+	}()
+
+	return out, nil
+}
+
+// LogSollytchEvents logs the key identifiers of every published event
+func LogSollytchEvents() {
+	events, _ := SollytchEvents.Subscribe(100)
+	for event := range events {
+		log.Printf("%s event v%d from %s tx %s (block %d): %s\n", event.Type, event.Version, event.Chaincode, event.TxID, event.BlockNumber, event.Data)
+	}
+}
@@ -0,0 +1,170 @@
+// Package checkpoint persists how far each event listener got in the
+// chaincode event stream, so that it can resume from there after a restart
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the position of a listener in the event stream. It
+// satisfies the fabric-gateway client.Checkpoint interface, so events can be
+// replayed with client.WithCheckpoint.
+type Checkpoint struct {
+	// Block in which the next event is expected
+	Block uint64 `json:"block_number"`
+	// Number of events already processed in that block
+	TxIndex int `json:"tx_index"`
+	// Last transaction processed in that block
+	TxID      string `json:"tx_id"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// BlockNumber in which the next event is expected
+func (c Checkpoint) BlockNumber() uint64 {
+	return c.Block
+}
+
+// TransactionID of the last processed event within the current block
+func (c Checkpoint) TransactionID() string {
+	return c.TxID
+}
+
+// Processed returns the checkpoint that follows an event processed from
+// the given block and transaction
+func (c Checkpoint) Processed(blockNumber uint64, txID string) Checkpoint {
+	if blockNumber != c.Block {
+		c.Block = blockNumber
+		c.TxIndex = 0
+	}
+	c.TxIndex++
+	c.TxID = txID
+	c.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return c
+}
+
+// Store keeps the checkpoint of each listener in a JSON file
+type Store struct {
+	mu          sync.Mutex
+	path        string
+	checkpoints map[string]Checkpoint
+}
+
+var (
+	defaultStore     *Store
+	defaultStoreOnce sync.Once
+)
+
+// Default returns the store at EVENT_CHECKPOINT_FILE, event-checkpoints.json
+// in the working directory when unset. A file that cannot be loaded is
+// logged and checkpoints are kept in memory until the next restart.
+func Default() *Store {
+	defaultStoreOnce.Do(func() {
+		path := os.Getenv("EVENT_CHECKPOINT_FILE")
+		if path == "" {
+			path = "event-checkpoints.json"
+		}
+
+		var err error
+		defaultStore, err = NewStore(path)
+		if err != nil {
+			fmt.Println("error loading event checkpoints, replay disabled: ", err)
+			defaultStore, _ = NewStore("")
+		}
+	})
+
+	return defaultStore
+}
+
+// NewStore creates a store backed by the file at path, loading the
+// checkpoints already stored there. An empty path keeps them in memory.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, checkpoints: map[string]Checkpoint{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.checkpoints); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Get returns the checkpoint of a listener, the zero value when it has
+// not processed any event yet
+func (s *Store) Get(listener string) Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkpoints[listener]
+}
+
+// Save records the checkpoint of a listener. The file is synced before
+// returning, so an event is only considered processed once it is durable.
+func (s *Store) Save(listener string, checkpoint Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.checkpoints[listener]
+	s.checkpoints[listener] = checkpoint
+	if err := s.save(); err != nil {
+		if existed {
+			s.checkpoints[listener] = previous
+		} else {
+			delete(s.checkpoints, listener)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// save writes the checkpoints to the backing file; callers hold the lock
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	return writeFile(s.path, s.checkpoints)
+}
+
+// writeFile replaces the file at path with v as JSON through a temporary
+// file, synced before the rename, so that a crash never leaves it half written
+func writeFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,96 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessedAdvancesWithinBlock(t *testing.T) {
+	var c Checkpoint
+	if c.BlockNumber() != 0 || c.TransactionID() != "" {
+		t.Fatalf("unexpected zero checkpoint %+v", c)
+	}
+
+	c = c.Processed(7, "tx1").Processed(7, "tx2")
+	if c.BlockNumber() != 7 || c.TxIndex != 2 || c.TransactionID() != "tx2" {
+		t.Errorf("unexpected checkpoint %+v", c)
+	}
+
+	c = c.Processed(9, "tx3")
+	if c.BlockNumber() != 9 || c.TxIndex != 1 || c.TransactionID() != "tx3" {
+		t.Errorf("unexpected checkpoint %+v", c)
+	}
+}
+
+func TestStoreIsDurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := store.Get("sollytch"); c != (Checkpoint{}) {
+		t.Errorf("unexpected checkpoint before any event %+v", c)
+	}
+
+	saved := Checkpoint{}.Processed(12, "tx1")
+	if err := store.Save("sollytch", saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("other", Checkpoint{}.Processed(3, "tx0")); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := reloaded.Get("sollytch"); c != saved {
+		t.Errorf("checkpoint not persisted: %+v, expected %+v", c, saved)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(path); err == nil {
+		t.Error("corrupt checkpoint file accepted")
+	}
+}
+
+func TestFailuresSkipAfterMaxAttempts(t *testing.T) {
+	t.Setenv("EVENT_HANDLER_MAX_ATTEMPTS", "3")
+	f := NewFailures()
+
+	for attempt := 1; attempt < 3; attempt++ {
+		if attempts, retry := f.Failed("poison"); attempts != attempt || !retry {
+			t.Fatalf("attempt %d: got %d, retry %v", attempt, attempts, retry)
+		}
+	}
+	if attempts, retry := f.Failed("poison"); attempts != 3 || retry {
+		t.Errorf("expected the event to be skipped on attempt 3, got %d, retry %v", attempts, retry)
+	}
+
+	// A skipped event that shows up again starts over, and a success
+	// clears the failures of an event
+	if attempts, _ := f.Failed("poison"); attempts != 1 {
+		t.Errorf("expected the count to restart, got %d", attempts)
+	}
+	f.Failed("flaky")
+	f.Succeeded("flaky")
+	if attempts, _ := f.Failed("flaky"); attempts != 1 {
+		t.Errorf("expected a success to clear the count, got %d", attempts)
+	}
+}
+
+func TestFailuresMaxAttemptsFromEnv(t *testing.T) {
+	for value, expected := range map[string]int{"": 5, "1": 1, "10": 10, "0": 5, "abc": 5} {
+		t.Setenv("EVENT_HANDLER_MAX_ATTEMPTS", value)
+		if f := NewFailures(); f.MaxAttempts != expected {
+			t.Errorf("EVENT_HANDLER_MAX_ATTEMPTS=%q: got %d, expected %d", value, f.MaxAttempts, expected)
+		}
+	}
+}
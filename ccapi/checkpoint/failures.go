@@ -0,0 +1,54 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Attempts made to handle an event before a listener skips it
+const defaultMaxAttempts = 5
+
+// Failures counts the failed attempts to handle each event of a listener,
+// so that an event failing every time is eventually moved to the
+// SkippedStore instead of holding back the listener forever. Counts are
+// kept in memory: a restart gives every event a fresh set of attempts.
+type Failures struct {
+	MaxAttempts int
+	attempts    map[string]int
+}
+
+// NewFailures creates a counter allowing EVENT_HANDLER_MAX_ATTEMPTS
+// attempts per event, 5 when unset
+func NewFailures() *Failures {
+	f := &Failures{MaxAttempts: defaultMaxAttempts, attempts: map[string]int{}}
+	if value := os.Getenv("EVENT_HANDLER_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			fmt.Printf("invalid EVENT_HANDLER_MAX_ATTEMPTS %q, using %d\n", value, f.MaxAttempts)
+		} else {
+			f.MaxAttempts = attempts
+		}
+	}
+
+	return f
+}
+
+// Failed records a failed attempt to handle the event identified by key,
+// returning the attempts made so far and whether it should be retried.
+// Once it should not, the count is forgotten.
+func (f *Failures) Failed(key string) (int, bool) {
+	f.attempts[key]++
+	attempts := f.attempts[key]
+	if attempts < f.MaxAttempts {
+		return attempts, true
+	}
+
+	delete(f.attempts, key)
+	return attempts, false
+}
+
+// Succeeded forgets the failed attempts of an event once it was handled
+func (f *Failures) Succeeded(key string) {
+	delete(f.attempts, key)
+}
@@ -0,0 +1,173 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned for an unknown skipped event
+var ErrNotFound = errors.New("skipped event not found")
+
+// SkippedEvent is an event a listener stopped retrying after
+// EVENT_HANDLER_MAX_ATTEMPTS failed attempts. It is kept, with everything
+// needed to hand it to the listener again, until it is replayed or discarded.
+type SkippedEvent struct {
+	ID            string `json:"id"`
+	Listener      string `json:"listener"`
+	Key           string `json:"key"`
+	ChaincodeName string `json:"chaincode"`
+	EventName     string `json:"event_name"`
+	BlockNumber   uint64 `json:"block_number"`
+	TxID          string `json:"tx_id"`
+	Payload       []byte `json:"payload"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error"`
+	SkippedAt     string `json:"skipped_at"`
+}
+
+// SkippedID derives the ID of the event identified by key once skipped by
+// a listener, the same when the event is skipped again
+func SkippedID(listener, key string) string {
+	digest := sha256.Sum256([]byte(listener + "\n" + key))
+	return hex.EncodeToString(digest[:16])
+}
+
+// SkippedStore keeps the skipped events in a JSON file
+type SkippedStore struct {
+	mu     sync.Mutex
+	path   string
+	events map[string]*SkippedEvent
+}
+
+var (
+	defaultSkipped     *SkippedStore
+	defaultSkippedOnce sync.Once
+)
+
+// DefaultSkipped returns the store at EVENT_SKIPPED_FILE,
+// event-skipped.json in the working directory when unset. A file that
+// cannot be loaded is logged and skipped events are kept in memory until
+// the next restart.
+func DefaultSkipped() *SkippedStore {
+	defaultSkippedOnce.Do(func() {
+		path := os.Getenv("EVENT_SKIPPED_FILE")
+		if path == "" {
+			path = "event-skipped.json"
+		}
+
+		var err error
+		defaultSkipped, err = NewSkippedStore(path)
+		if err != nil {
+			fmt.Println("error loading skipped events, keeping them in memory: ", err)
+			defaultSkipped, _ = NewSkippedStore("")
+		}
+	})
+
+	return defaultSkipped
+}
+
+// NewSkippedStore creates a store backed by the file at path, loading the
+// events already stored there. An empty path keeps them in memory.
+func NewSkippedStore(path string) (*SkippedStore, error) {
+	s := &SkippedStore{path: path, events: map[string]*SkippedEvent{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*SkippedEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("invalid skipped event file %s: %w", path, err)
+	}
+	for _, event := range events {
+		s.events[event.ID] = event
+	}
+
+	return s, nil
+}
+
+// Put stores a skipped event, replacing a previous skip of the same event.
+// The file is synced before returning, so the listener only checkpoints
+// past the event once it is durable.
+func (s *SkippedStore) Put(event SkippedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.events[event.ID]
+	s.events[event.ID] = &event
+	if err := s.save(); err != nil {
+		if previous != nil {
+			s.events[event.ID] = previous
+		} else {
+			delete(s.events, event.ID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Take removes a skipped event and returns it
+func (s *SkippedStore) Take(id string) (SkippedEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, ok := s.events[id]
+	if !ok {
+		return SkippedEvent{}, ErrNotFound
+	}
+
+	delete(s.events, id)
+	if err := s.save(); err != nil {
+		s.events[id] = event
+		return SkippedEvent{}, err
+	}
+
+	return *event, nil
+}
+
+// List returns copies of the skipped events, in ledger order
+func (s *SkippedStore) List() []SkippedEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]SkippedEvent, 0, len(s.events))
+	for _, event := range s.events {
+		events = append(events, *event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].ID < events[j].ID
+	})
+
+	return events
+}
+
+// save writes the skipped events to the backing file; callers hold the lock
+func (s *SkippedStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	events := make([]*SkippedEvent, 0, len(s.events))
+	for _, event := range s.events {
+		events = append(events, event)
+	}
+
+	return writeFile(s.path, events)
+}
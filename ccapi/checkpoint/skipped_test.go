@@ -0,0 +1,62 @@
+package checkpoint
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkippedEventsAreDurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skipped.json")
+
+	store, err := NewSkippedStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := SkippedEvent{
+		ID:          SkippedID("mainchannel/sollytch-chain/sollytch", "mainchannel/sollytch-chain/14/tx2"),
+		Listener:    "mainchannel/sollytch-chain/sollytch",
+		Key:         "mainchannel/sollytch-chain/14/tx2",
+		BlockNumber: 14,
+		Payload:     []byte(`{"type":"TestStored"}`),
+		Attempts:    5,
+	}
+	earlier := SkippedEvent{
+		ID:          SkippedID("mainchannel/sollytch-chain/sollytch", "mainchannel/sollytch-chain/9/tx1"),
+		Listener:    "mainchannel/sollytch-chain/sollytch",
+		Key:         "mainchannel/sollytch-chain/9/tx1",
+		BlockNumber: 9,
+	}
+	for _, event := range []SkippedEvent{later, earlier} {
+		if err := store.Put(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if SkippedID(later.Listener, later.Key) != later.ID || SkippedID("other", later.Key) == later.ID {
+		t.Error("skipped ids are not derived from the listener and the event key")
+	}
+
+	reloaded, err := NewSkippedStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := reloaded.List()
+	if len(events) != 2 || events[0].ID != earlier.ID || events[1].ID != later.ID {
+		t.Fatalf("unexpected skipped events %+v", events)
+	}
+	if string(events[1].Payload) != string(later.Payload) {
+		t.Errorf("payload not persisted: %s", events[1].Payload)
+	}
+
+	taken, err := reloaded.Take(later.ID)
+	if err != nil || taken.Attempts != 5 {
+		t.Errorf("unexpected taken event %+v: %v", taken, err)
+	}
+	if _, err := reloaded.Take(later.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("event taken twice: %v", err)
+	}
+	if events := reloaded.List(); len(events) != 1 || events[0].ID != earlier.ID {
+		t.Errorf("unexpected skipped events after take %+v", events)
+	}
+}
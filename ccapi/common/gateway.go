@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
@@ -22,9 +23,14 @@ import (
 
 var (
 	gatewayTLSCredentials *credentials.TransportCredentials
+	// Guards the credentials, created by the first of the concurrent event listeners
+	gatewayTLSMutex sync.Mutex
 )
 
 func CreateGrpcConnection(endpoint string) (*grpc.ClientConn, error) {
+	gatewayTLSMutex.Lock()
+	defer gatewayTLSMutex.Unlock()
+
 	// Check TLS credential was created
 	if gatewayTLSCredentials == nil {
 		gatewayServerName := os.Getenv("FABRIC_GATEWAY_NAME")
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/pkg/errors"
+)
+
+// SignAsUser signs the SHA-256 digest of message with the private key of the
+// given user and returns the signature and the name of the signature scheme.
+func SignAsUser(user string, message []byte) ([]byte, string, error) {
+	privateKeyPEM, err := os.ReadFile(getSignKey(user))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to read private key file")
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var scheme string
+	switch privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		scheme = "ECDSA-SHA256"
+	case ed25519.PrivateKey:
+		scheme = "Ed25519-SHA256"
+	default:
+		return nil, "", errors.New("unsupported private key type")
+	}
+
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to create signer function")
+	}
+
+	digest := sha256.Sum256(message)
+	signature, err := sign(digest[:])
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to sign message")
+	}
+
+	return signature, scheme, nil
+}
+
+// GetSignCertPEM returns the PEM encoded signing certificate of the given user
+func GetSignCertPEM(user string) ([]byte, error) {
+	certificatePEM, err := os.ReadFile(getSignCert(user))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read certificate file")
+	}
+
+	return certificatePEM, nil
+}
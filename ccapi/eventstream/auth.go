@@ -0,0 +1,166 @@
+// Package eventstream holds the parts of the sollytch event routes that do
+// not depend on Fabric: the token authentication shared by the event stream
+// and the webhook routes, the WebSocket origin check, the stream filters
+// and the SSE messages through which clients resume.
+package eventstream
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokensEnv names the variable listing, comma separated, the accepted tokens
+const TokensEnv = "EVENTS_STREAM_TOKENS"
+
+var (
+	errTokensNotSet = errors.New("event routes disabled, " + TokensEnv + " is not set")
+	errInvalidToken = errors.New("missing or invalid event stream token")
+)
+
+// TicketTTL is how long a ticket minted by IssueTicket is accepted
+const TicketTTL = time.Minute
+
+// RequireToken aborts the requests without a token listed in
+// EVENTS_STREAM_TOKENS, sent as a bearer token or, for browsers that cannot
+// send headers, as a short-lived ticket from IssueTicket in the access_token
+// query parameter. The routes are disabled without tokens.
+func RequireToken(c *gin.Context) {
+	status, err := authorize(c.Request, os.Getenv(TokensEnv), time.Now())
+	if err != nil {
+		if status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", "Bearer")
+		}
+		c.AbortWithStatusJSON(status, gin.H{
+			"status": status,
+			"error":  err.Error(),
+		})
+		c.Error(err)
+		return
+	}
+
+	c.Next()
+}
+
+// IssueTicket mints a ticket for the access_token query parameter,
+// accepted for TicketTTL. It requires a bearer token, so that a ticket
+// cannot be renewed with itself.
+func IssueTicket(c *gin.Context) {
+	token, ok := bearerToken(c.Request)
+	if !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"status": http.StatusUnauthorized,
+			"error":  errInvalidToken.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"access_token": ticket(token, time.Now().Add(TicketTTL)),
+		"expires_in":   int(TicketTTL.Seconds()),
+	})
+}
+
+// HideQueryToken removes the access_token query parameter before the
+// request is logged, moving it to the Authorization header when the request
+// has none. It must be installed before the logger.
+func HideQueryToken(c *gin.Context) {
+	query := c.Request.URL.Query()
+	if !query.Has("access_token") {
+		c.Next()
+		return
+	}
+
+	if c.Request.Header.Get("Authorization") == "" {
+		c.Request.Header.Set("Authorization", queryTicketScheme+" "+query.Get("access_token"))
+	}
+	query.Del("access_token")
+	c.Request.URL.RawQuery = query.Encode()
+	c.Request.RequestURI = c.Request.URL.RequestURI()
+
+	c.Next()
+}
+
+// queryTicketScheme marks, in the Authorization header, a ticket moved
+// there from the query by HideQueryToken
+const queryTicketScheme = "Ticket"
+
+// authorize checks the request token against the comma separated tokens,
+// returning the status to abort with when it is not accepted
+func authorize(r *http.Request, tokens string, now time.Time) (int, error) {
+	if strings.TrimSpace(tokens) == "" {
+		return http.StatusServiceUnavailable, errTokensNotSet
+	}
+
+	token, bearer := bearerToken(r)
+	if !bearer {
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, queryTicketScheme+" ") {
+			token = strings.TrimPrefix(header, queryTicketScheme+" ")
+		} else if header == "" {
+			token = r.URL.Query().Get("access_token")
+		}
+	}
+
+	if token != "" {
+		for _, allowed := range strings.Split(tokens, ",") {
+			allowed = strings.TrimSpace(allowed)
+			if allowed == "" {
+				continue
+			}
+			if bearer && subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+				return http.StatusOK, nil
+			}
+			if !bearer && validTicket(token, allowed, now) {
+				return http.StatusOK, nil
+			}
+		}
+	}
+
+	return http.StatusUnauthorized, errInvalidToken
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(header, "Bearer "), true
+}
+
+// ticket is "<expiry>.<signature>": the unix expiry and the hex
+// HMAC-SHA256 of it keyed by the token the ticket was minted with
+func ticket(token string, expiry time.Time) string {
+	expires := strconv.FormatInt(expiry.Unix(), 10)
+	return expires + "." + ticketSignature(token, expires)
+}
+
+func ticketSignature(token, expires string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validTicket checks that a ticket was minted with the token and has not
+// expired, nor lives longer than TicketTTL
+func validTicket(value, token string, now time.Time) bool {
+	expires, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > expiry || expiry > now.Add(TicketTTL).Unix() {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(ticketSignature(token, expires)))
+}
@@ -0,0 +1,124 @@
+package eventstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/events", RequireToken, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	cases := []struct {
+		name   string
+		tokens string
+		target string
+		header string
+		status int
+	}{
+		{"no tokens configured", "", "/events", "Bearer t1", http.StatusServiceUnavailable},
+		{"missing token", "t1,t2", "/events", "", http.StatusUnauthorized},
+		{"unknown token", "t1,t2", "/events", "Bearer t3", http.StatusUnauthorized},
+		{"not a bearer token", "t1,t2", "/events", "Basic t1", http.StatusUnauthorized},
+		{"empty token with a trailing comma", "t1,", "/events?access_token=", "", http.StatusUnauthorized},
+		{"bearer token", "t1, t2", "/events", "Bearer t2", http.StatusNoContent},
+		{"query token instead of a ticket", "t1,t2", "/events?access_token=t1", "", http.StatusUnauthorized},
+		{"query ticket", "t1,t2", "/events?access_token=" + ticket("t2", time.Now().Add(TicketTTL)), "", http.StatusNoContent},
+		{"expired ticket", "t1,t2", "/events?access_token=" + ticket("t2", time.Now().Add(-time.Second)), "", http.StatusUnauthorized},
+		{"ticket of an unknown token", "t1,t2", "/events?access_token=" + ticket("t3", time.Now().Add(TicketTTL)), "", http.StatusUnauthorized},
+		{"ticket as a bearer token", "t1,t2", "/events", "Bearer " + ticket("t1", time.Now().Add(TicketTTL)), http.StatusUnauthorized},
+		{"header wins over the query", "t1,t2", "/events?access_token=" + ticket("t1", time.Now().Add(TicketTTL)), "Bearer t3", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		t.Setenv(TokensEnv, c.tokens)
+
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		if res.Code != c.status {
+			t.Errorf("%s: got status %d, expected %d", c.name, res.Code, c.status)
+		}
+		if c.status == http.StatusUnauthorized && res.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: missing WWW-Authenticate challenge", c.name)
+		}
+	}
+}
+
+func TestTicketsAreShortLived(t *testing.T) {
+	now := time.Now()
+	if !validTicket(ticket("t1", now.Add(TicketTTL)), "t1", now) {
+		t.Error("fresh ticket refused")
+	}
+	if validTicket(ticket("t1", now.Add(TicketTTL)), "t1", now.Add(TicketTTL+time.Second)) {
+		t.Error("expired ticket accepted")
+	}
+	if validTicket(ticket("t1", now.Add(time.Hour)), "t1", now) {
+		t.Error("ticket living longer than TicketTTL accepted")
+	}
+	for _, value := range []string{"", "t1", "123", "abc.def"} {
+		if validTicket(value, "t1", now) {
+			t.Errorf("malformed ticket %q accepted", value)
+		}
+	}
+}
+
+func TestQueryTicketsAreNotLogged(t *testing.T) {
+	t.Setenv(TokensEnv, "t1")
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	router := gin.New()
+	router.Use(HideQueryToken, gin.LoggerWithWriter(&logs))
+	router.POST("/events/tickets", RequireToken, IssueTicket)
+	router.GET("/events/stream", RequireToken, func(c *gin.Context) {
+		c.String(http.StatusOK, c.Query("event"))
+	})
+
+	// Tickets are minted with the bearer token only
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/events/tickets", nil)
+	req.Header.Set("Authorization", "Bearer t1")
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("ticket not issued: %d %s", res.Code, res.Body)
+	}
+	var issued struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &issued); err != nil {
+		t.Fatal(err)
+	}
+
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/events/tickets?access_token="+issued.AccessToken, nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("ticket renewed with itself: %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/events/stream?event=HazardAlert&access_token="+issued.AccessToken, nil))
+	if res.Code != http.StatusOK || res.Body.String() != "HazardAlert" {
+		t.Errorf("stream with a query ticket answered %d %q", res.Code, res.Body)
+	}
+
+	if strings.Contains(logs.String(), issued.AccessToken) || strings.Contains(logs.String(), "access_token") {
+		t.Errorf("ticket logged:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "/events/stream?event=HazardAlert") {
+		t.Errorf("request not logged:\n%s", logs.String())
+	}
+}
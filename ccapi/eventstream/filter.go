@@ -0,0 +1,106 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Filter selects the events relayed to a client. Empty fields do not filter.
+type Filter struct {
+	Types       []string
+	CassetteLot string
+	KitID       string
+}
+
+// Identifiers looked up in the event data by the filters. Planilha and lot
+// status events spell the cassette lot "cassete_lot".
+type filterData struct {
+	CassetteLot string `json:"cassette_lot"`
+	CasseteLot  string `json:"cassete_lot"`
+	IDKit       string `json:"idKit"`
+}
+
+// ParseFilter reads the filter of a stream request: event types in "event",
+// comma separated or repeated, "cassette_lot" and "kit_id"
+func ParseFilter(r *http.Request) Filter {
+	query := r.URL.Query()
+	filter := Filter{
+		CassetteLot: query.Get("cassette_lot"),
+		KitID:       query.Get("kit_id"),
+	}
+	for _, value := range query["event"] {
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				filter.Types = append(filter.Types, eventType)
+			}
+		}
+	}
+
+	return filter
+}
+
+// Matches tells whether an event of the given type and JSON data passes the
+// filter
+func (f Filter) Matches(eventType string, data json.RawMessage) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if t == eventType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.CassetteLot == "" && f.KitID == "" {
+		return true
+	}
+
+	var ids filterData
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return false
+	}
+	if f.CassetteLot != "" && ids.CassetteLot != f.CassetteLot && ids.CasseteLot != f.CassetteLot {
+		return false
+	}
+	if f.KitID != "" && ids.IDKit != f.KitID {
+		return false
+	}
+
+	return true
+}
+
+// ResumeBlock returns the block a stream request replays events from: the
+// "from_block" query parameter or, for a reconnecting EventSource, the
+// Last-Event-ID header carrying the block of the last event received. It
+// reports false for a live-only stream.
+func ResumeBlock(r *http.Request) (uint64, bool, error) {
+	fromBlock := r.URL.Query().Get("from_block")
+	if fromBlock == "" {
+		fromBlock = r.Header.Get("Last-Event-ID")
+	}
+	if fromBlock == "" {
+		return 0, false, nil
+	}
+
+	blockNumber, err := strconv.ParseUint(fromBlock, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid from_block: %w", err)
+	}
+
+	return blockNumber, true, nil
+}
+
+// WriteSSE writes an event as an SSE message named after its type, with
+// the block number as id so that ResumeBlock picks it up on reconnection
+func WriteSSE(w io.Writer, blockNumber uint64, eventType string, data []byte) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", blockNumber, eventType, data)
+	return err
+}
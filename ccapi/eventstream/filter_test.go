@@ -0,0 +1,122 @@
+package eventstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/events/stream?event=TestStored,%20LoteStatusChanged&event=TestImageLinked&event=&cassette_lot=L1&kit_id=K1", nil)
+
+	filter := ParseFilter(req)
+	expected := Filter{
+		Types:       []string{"TestStored", "LoteStatusChanged", "TestImageLinked"},
+		CassetteLot: "L1",
+		KitID:       "K1",
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("got filter %+v, expected %+v", filter, expected)
+	}
+
+	if filter := ParseFilter(httptest.NewRequest(http.MethodGet, "/events/stream", nil)); !reflect.DeepEqual(filter, Filter{}) {
+		t.Errorf("got filter %+v without parameters", filter)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	test := json.RawMessage(`{"cassette_lot":"L1","idKit":"K1"}`)
+	planilha := json.RawMessage(`{"cassete_lot":"L2"}`)
+
+	cases := []struct {
+		name      string
+		filter    Filter
+		eventType string
+		data      json.RawMessage
+		matches   bool
+	}{
+		{"no filter", Filter{}, "TestStored", test, true},
+		{"no filter, invalid data", Filter{}, "TestStored", json.RawMessage(`x`), true},
+		{"listed type", Filter{Types: []string{"LoteStatusChanged", "TestStored"}}, "TestStored", test, true},
+		{"other type", Filter{Types: []string{"LoteStatusChanged"}}, "TestStored", test, false},
+		{"cassette lot", Filter{CassetteLot: "L1"}, "TestStored", test, true},
+		{"other cassette lot", Filter{CassetteLot: "L2"}, "TestStored", test, false},
+		{"cassete lot spelling", Filter{CassetteLot: "L2"}, "PlanilhaAnchored", planilha, true},
+		{"kit", Filter{KitID: "K1"}, "TestStored", test, true},
+		{"other kit", Filter{KitID: "K2"}, "TestStored", test, false},
+		{"kit missing from data", Filter{KitID: "K1"}, "PlanilhaAnchored", planilha, false},
+		{"lot and kit", Filter{CassetteLot: "L1", KitID: "K1"}, "TestStored", test, true},
+		{"type and other lot", Filter{Types: []string{"TestStored"}, CassetteLot: "L2"}, "TestStored", test, false},
+		{"invalid data", Filter{KitID: "K1"}, "TestStored", json.RawMessage(`x`), false},
+	}
+	for _, c := range cases {
+		if matches := c.filter.Matches(c.eventType, c.data); matches != c.matches {
+			t.Errorf("%s: got %v, expected %v", c.name, matches, c.matches)
+		}
+	}
+}
+
+func TestResumeBlock(t *testing.T) {
+	cases := []struct {
+		name        string
+		target      string
+		lastEventID string
+		block       uint64
+		resume      bool
+		fails       bool
+	}{
+		{"live only", "/events/stream", "", 0, false, false},
+		{"from block", "/events/stream?from_block=12", "", 12, true, false},
+		{"from block zero", "/events/stream?from_block=0", "", 0, true, false},
+		{"last event id", "/events/stream", "34", 34, true, false},
+		{"from block wins over last event id", "/events/stream?from_block=12", "34", 12, true, false},
+		{"invalid from block", "/events/stream?from_block=-1", "", 0, false, true},
+		{"invalid last event id", "/events/stream", "abc", 0, false, true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		if c.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", c.lastEventID)
+		}
+
+		block, resume, err := ResumeBlock(req)
+		if c.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if block != c.block || resume != c.resume {
+			t.Errorf("%s: got (%d, %v), expected (%d, %v)", c.name, block, resume, c.block, c.resume)
+		}
+	}
+}
+
+func TestWriteSSEResume(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSSE(&buf, 42, "TestStored", []byte(`{"idKit":"K1"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id: 42\nevent: TestStored\ndata: {\"idKit\":\"K1\"}\n\n"
+	if buf.String() != expected {
+		t.Fatalf("got message %q, expected %q", buf.String(), expected)
+	}
+
+	// A reconnecting EventSource sends back the id of the last message
+	id := bytes.TrimPrefix(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], []byte("id: "))
+	req := httptest.NewRequest(http.MethodGet, "/events/stream", nil)
+	req.Header.Set("Last-Event-ID", string(id))
+
+	block, resume, err := ResumeBlock(req)
+	if err != nil || !resume || block != 42 {
+		t.Errorf("got (%d, %v, %v) resuming from message id %q", block, resume, err, id)
+	}
+}
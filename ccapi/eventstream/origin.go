@@ -0,0 +1,41 @@
+package eventstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OriginsEnv names the variable listing, comma separated, the origins of
+// the browser pages allowed to open the event stream WebSocket
+const OriginsEnv = "EVENTS_STREAM_ORIGINS"
+
+// CheckOrigin accepts WebSocket handshakes without an Origin header, sent
+// by clients other than browsers, from the API's own origin or from an
+// origin listed in EVENTS_STREAM_ORIGINS ("*" accepts any). Other browser
+// pages could otherwise reuse a token stored for the API.
+func CheckOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return nil
+	}
+
+	for _, allowed := range strings.Split(os.Getenv(OriginsEnv), ",") {
+		allowed = strings.TrimRight(strings.TrimSpace(allowed), "/")
+		if allowed == "*" || (allowed != "" && strings.EqualFold(allowed, origin)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("origin %s not allowed, see %s", origin, OriginsEnv)
+}
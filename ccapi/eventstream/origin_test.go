@@ -0,0 +1,42 @@
+package eventstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	cases := []struct {
+		name    string
+		origins string
+		origin  string
+		allowed bool
+	}{
+		{"no origin header", "", "", true},
+		{"same host", "", "http://api.example.com:8080", true},
+		{"same host other case", "", "http://API.example.com:8080", true},
+		{"listed origin", "https://app.example.com, https://ops.example.com/", "https://ops.example.com", true},
+		{"any origin", "*", "https://evil.example.net", true},
+		{"origin not listed", "https://app.example.com", "https://evil.example.net", false},
+		{"no origins configured", "", "https://app.example.com", false},
+		{"scheme differs", "https://app.example.com", "http://app.example.com", false},
+		{"invalid origin", "*", "null", false},
+	}
+	for _, c := range cases {
+		t.Setenv(OriginsEnv, c.origins)
+
+		req := httptest.NewRequest(http.MethodGet, "http://api.example.com:8080/api/events/stream", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+
+		err := CheckOrigin(req)
+		if c.allowed && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if !c.allowed && err == nil {
+			t.Errorf("%s: origin %q accepted", c.name, c.origin)
+		}
+	}
+}
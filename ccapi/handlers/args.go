@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+var errPositionalArgs = errors.New("the @args parameter must be a JSON array of strings (base64-encoded when sent as a query parameter)")
+
+// Extracts the positional arguments of a query, used by chaincodes whose
+// transactions take plain arguments instead of a single JSON request
+// (e.g. paginated queries with a page size and a bookmark). On GET requests
+// they come from the base64-encoded @args query parameter and on POST
+// requests from the "@args" array in the request body, which is removed
+// from req. The values are forwarded unchanged, so opaque bookmarks
+// returned by a previous page can be sent back as received.
+func getPositionalArgs(c *gin.Context, req map[string]interface{}) ([]string, error) {
+	if c.Request.Method == "GET" {
+		argsQuery := c.Query("@args")
+		if argsQuery == "" {
+			return nil, nil
+		}
+
+		argsBytes, err := base64.StdEncoding.DecodeString(argsQuery)
+		if err != nil {
+			return nil, errPositionalArgs
+		}
+
+		var args []string
+		err = json.Unmarshal(argsBytes, &args)
+		if err != nil {
+			return nil, errPositionalArgs
+		}
+
+		return args, nil
+	}
+
+	raw, ok := req["@args"]
+	if !ok {
+		return nil, nil
+	}
+	delete(req, "@args")
+
+	rawList, ok := raw.([]interface{})
+	if !ok {
+		return nil, errPositionalArgs
+	}
+
+	args := make([]string, 0, len(rawList))
+	for _, value := range rawList {
+		arg, ok := value.(string)
+		if !ok {
+			return nil, errPositionalArgs
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
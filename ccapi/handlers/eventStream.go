@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/chaincode"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/common"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/eventstream"
+	"golang.org/x/net/websocket"
+)
+
+// Events buffered per live stream; a client slower than this misses events
+// and can resume from the block number of the last one it received
+const eventStreamBuffer = 256
+
+// Interval of the SSE comments keeping idle connections open through proxies
+const eventStreamKeepAlive = 15 * time.Second
+
+// StreamEvents relays the typed events of sollytch-chain and sollytch-image
+// over Server-Sent Events, or over a WebSocket when the request asks for an
+// upgrade. Query parameters:
+//   - event: event types to relay, comma separated or repeated
+//   - cassette_lot, kit_id: only events about that lot or kit
+//   - from_block: replay the events committed from that block on before the
+//     live ones; SSE clients reconnecting with Last-Event-ID resume from it
+//
+// Clients authenticate with a token listed in EVENTS_STREAM_TOKENS, checked
+// by eventstream.RequireToken on the route. Browser WebSockets must come from
+// the API's origin or one listed in EVENTS_STREAM_ORIGINS.
+func StreamEvents(c *gin.Context) {
+	webSocket := strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+	if webSocket {
+		if err := eventstream.CheckOrigin(c.Request); err != nil {
+			common.Abort(c, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	filter := eventstream.ParseFilter(c.Request)
+	blockNumber, replay, err := eventstream.ResumeBlock(c.Request)
+	if err != nil {
+		common.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var events <-chan chaincode.SollytchEvent
+	var cancel func()
+	if !replay {
+		events, cancel = chaincode.SollytchEvents.Subscribe(eventStreamBuffer, filter.Types...)
+	} else {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		events, err = chaincode.ReplaySollytchEvents(ctx, os.Getenv("CHANNEL"), blockNumber)
+		if err != nil {
+			cancel()
+			common.Abort(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	defer cancel()
+
+	// The bus already filters by type, the replay does not
+	relay := func(event chaincode.SollytchEvent) bool {
+		return filter.Matches(event.Type, event.Data)
+	}
+
+	if webSocket {
+		streamEventsWebSocket(c, events, relay)
+		return
+	}
+	streamEventsSSE(c, events, relay)
+}
+
+// streamEventsSSE writes each event as an SSE message named after its type,
+// with the block number as id and the JSON event as data
+func streamEventsSSE(c *gin.Context, events <-chan chaincode.SollytchEvent, relay func(chaincode.SollytchEvent) bool) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !relay(event) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := eventstream.WriteSSE(c.Writer, event.BlockNumber, event.Type, data); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// streamEventsWebSocket sends each event as a JSON text message. Messages
+// from the client are ignored; the stream ends when it disconnects.
+func streamEventsWebSocket(c *gin.Context, events <-chan chaincode.SollytchEvent, relay func(chaincode.SollytchEvent) bool) {
+	server := websocket.Server{
+		// Browser pages are limited to the allowed origins, other clients
+		// only need their token
+		Handshake: func(_ *websocket.Config, r *http.Request) error { return eventstream.CheckOrigin(r) },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			closed := make(chan struct{})
+			go func() {
+				io.Copy(io.Discard, ws)
+				close(closed)
+			}()
+
+			for {
+				select {
+				case <-closed:
+					return
+				case event, ok := <-events:
+					if !ok {
+						return
+					}
+					if !relay(event) {
+						continue
+					}
+					if err := websocket.JSON.Send(ws, event); err != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+
+	server.ServeHTTP(c.Writer, c.Request)
+}
@@ -12,6 +12,7 @@ import (
 
 func Query(c *gin.Context) {
 	var args []byte
+	var positionalArgs []string
 	var err error
 
 	if c.Request.Method == "GET" {
@@ -19,9 +20,22 @@ func Query(c *gin.Context) {
 		if request != "" {
 			args, _ = base64.StdEncoding.DecodeString(request)
 		}
+
+		positionalArgs, err = getPositionalArgs(c, nil)
+		if err != nil {
+			common.Abort(c, http.StatusBadRequest, err)
+			return
+		}
 	} else if c.Request.Method == "POST" {
 		req := make(map[string]interface{})
 		c.ShouldBind(&req)
+
+		positionalArgs, err = getPositionalArgs(c, req)
+		if err != nil {
+			common.Abort(c, http.StatusBadRequest, err)
+			return
+		}
+
 		args, err = json.Marshal(req)
 		if err != nil {
 			common.Abort(c, http.StatusInternalServerError, err)
@@ -34,7 +48,11 @@ func Query(c *gin.Context) {
 	txName := c.Param("txname")
 
 	argList := [][]byte{}
-	if args != nil {
+	if positionalArgs != nil {
+		for _, arg := range positionalArgs {
+			argList = append(argList, []byte(arg))
+		}
+	} else if args != nil {
 		argList = append(argList, args)
 	}
 
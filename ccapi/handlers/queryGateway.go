@@ -27,6 +27,7 @@ func QueryGatewayCustom(c *gin.Context) {
 
 func queryGateway(c *gin.Context, channelName, chaincodeName string) {
 	var args []byte
+	var positionalArgs []string
 	var err error
 
 	// Get request data
@@ -35,9 +36,22 @@ func queryGateway(c *gin.Context, channelName, chaincodeName string) {
 		if request != "" {
 			args, _ = base64.StdEncoding.DecodeString(request)
 		}
+
+		positionalArgs, err = getPositionalArgs(c, nil)
+		if err != nil {
+			common.Abort(c, http.StatusBadRequest, err)
+			return
+		}
 	} else if c.Request.Method == "POST" {
 		req := make(map[string]interface{})
 		c.ShouldBind(&req)
+
+		positionalArgs, err = getPositionalArgs(c, req)
+		if err != nil {
+			common.Abort(c, http.StatusBadRequest, err)
+			return
+		}
+
 		args, err = json.Marshal(req)
 		if err != nil {
 			common.Abort(c, http.StatusInternalServerError, err)
@@ -53,7 +67,13 @@ func queryGateway(c *gin.Context, channelName, chaincodeName string) {
 		user = "Admin"
 	}
 
-	result, err := chaincode.QueryGateway(channelName, chaincodeName, txName, user, []string{string(args)})
+	// Positional arguments replace the JSON request when present
+	txArgs := []string{string(args)}
+	if positionalArgs != nil {
+		txArgs = positionalArgs
+	}
+
+	result, err := chaincode.QueryGateway(channelName, chaincodeName, txName, user, txArgs)
 	if err != nil {
 		err, status := common.ParseError(err)
 		common.Abort(c, status, err)
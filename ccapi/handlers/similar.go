@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/chaincode"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/common"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/phash"
+)
+
+// Default Hamming distance below which two images are reported as copies
+const defaultSimilarDistance = 10
+
+// Default number of matches returned, closest first
+const defaultSimilarLimit = 20
+
+// SimilarImagesReport lists the anchored images close to an uploaded one
+type SimilarImagesReport struct {
+	Channel        string          `json:"channel"`
+	Chaincode      string          `json:"chaincode"`
+	FileName       string          `json:"file_name,omitempty"`
+	Algorithm      string          `json:"algorithm"`
+	PerceptualHash string          `json:"perceptual_hash"`
+	MaxDistance    int             `json:"max_distance"`
+	Limit          int             `json:"limit"`
+	Matches        json.RawMessage `json:"matches"`
+}
+
+func FindSimilarImagesDefault(c *gin.Context) {
+	channelName := os.Getenv("CHANNEL")
+
+	findSimilarImages(c, channelName)
+}
+
+func FindSimilarImagesCustom(c *gin.Context) {
+	channelName := c.Param("channelName")
+
+	findSimilarImages(c, channelName)
+}
+
+// findSimilarImages computes the perceptual hash of an uploaded image
+// (multipart field "file"), or takes a precomputed "perceptual_hash", and
+// returns up to "limit" images anchored in sollytch-image within
+// "max_distance" bits
+func findSimilarImages(c *gin.Context, channelName string) {
+	target := verifyTargets["image"]
+	chaincodeName := os.Getenv(target.chaincodeEnv)
+	if chaincodeName == "" {
+		chaincodeName = target.defaultChaincode
+	}
+
+	report := SimilarImagesReport{
+		Channel:        channelName,
+		Chaincode:      chaincodeName,
+		Algorithm:      strings.ToLower(c.DefaultPostForm("algorithm", phash.Default)),
+		PerceptualHash: strings.ToLower(c.PostForm("perceptual_hash")),
+		MaxDistance:    defaultSimilarDistance,
+		Limit:          defaultSimilarLimit,
+	}
+
+	if value := c.PostForm("max_distance"); value != "" {
+		maxDistance, err := strconv.Atoi(value)
+		if err != nil {
+			common.Abort(c, http.StatusBadRequest, fmt.Errorf("invalid max_distance: %w", err))
+			return
+		}
+		report.MaxDistance = maxDistance
+	}
+
+	if value := c.PostForm("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			common.Abort(c, http.StatusBadRequest, fmt.Errorf("invalid limit: %w", err))
+			return
+		}
+		report.Limit = limit
+	}
+
+	includeRevoked := c.DefaultPostForm("include_revoked", "false")
+	if _, err := strconv.ParseBool(includeRevoked); err != nil {
+		common.Abort(c, http.StatusBadRequest, fmt.Errorf("invalid include_revoked: %w", err))
+		return
+	}
+
+	if report.PerceptualHash == "" {
+		var err error
+		report.FileName, report.PerceptualHash, err = hashUploadedImage(c, report.Algorithm)
+		if err != nil {
+			common.Abort(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	user := c.GetHeader("User")
+	if user == "" {
+		user = "Admin"
+	}
+
+	args := []string{report.PerceptualHash, report.Algorithm, strconv.Itoa(report.MaxDistance), includeRevoked, strconv.Itoa(report.Limit)}
+	result, err := chaincode.QueryGateway(channelName, chaincodeName, "FindSimilarImages", user, args)
+	if err != nil {
+		err, status := common.ParseError(err)
+		common.Abort(c, status, err)
+		return
+	}
+	report.Matches = result
+
+	common.Respond(c, report, http.StatusOK, nil)
+}
+
+// PerceptualHashReport is the perceptual hash of an uploaded image, to be
+// sent as perceptualHash and perceptualHashAlgorithm in the StoreImage
+// metadata so that FindSimilarImages can match the image
+type PerceptualHashReport struct {
+	FileName       string `json:"file_name,omitempty"`
+	Algorithm      string `json:"algorithm"`
+	PerceptualHash string `json:"perceptual_hash"`
+}
+
+// PerceptualHash computes the perceptual hash of an uploaded image
+// (multipart field "file") with the given "algorithm", before it is anchored
+func PerceptualHash(c *gin.Context) {
+	report := PerceptualHashReport{
+		Algorithm: strings.ToLower(c.DefaultPostForm("algorithm", phash.Default)),
+	}
+
+	var err error
+	report.FileName, report.PerceptualHash, err = hashUploadedImage(c, report.Algorithm)
+	if err != nil {
+		common.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+
+	common.Respond(c, report, http.StatusOK, nil)
+}
+
+// hashUploadedImage returns the name and the perceptual hash of the image
+// uploaded in the multipart field "file"
+func hashUploadedImage(c *gin.Context, algorithm string) (string, string, error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return "", "", fmt.Errorf("missing multipart file field \"file\": %w", err)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	hash, err := phash.FromReader(file, algorithm)
+	if err != nil {
+		return "", "", err
+	}
+
+	return fileHeader.Filename, hash, nil
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/chaincode"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/checkpoint"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/common"
+)
+
+// ListSkippedEvents lists the chaincode events the listeners stopped
+// retrying after EVENT_HANDLER_MAX_ATTEMPTS failed attempts
+func ListSkippedEvents(c *gin.Context) {
+	common.Respond(c, checkpoint.DefaultSkipped().List(), http.StatusOK, nil)
+}
+
+// ReplaySkippedEvent hands a skipped event to its listener again
+func ReplaySkippedEvent(c *gin.Context) {
+	if err := chaincode.ReplaySkippedEvent(c.Param("id")); err != nil {
+		common.Abort(c, skippedEventErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func DeleteSkippedEvent(c *gin.Context) {
+	if _, err := checkpoint.DefaultSkipped().Take(c.Param("id")); err != nil {
+		common.Abort(c, skippedEventErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func skippedEventErrorStatus(err error) int {
+	if errors.Is(err, checkpoint.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/chaincode"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/common"
+	protos "github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"google.golang.org/protobuf/proto"
+)
+
+// Default hash algorithm, the one used by the clients when anchoring files
+const defaultVerifyAlgorithm = "sha512"
+
+// Hash algorithms accepted by the verification endpoint
+var verifyHashAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Chaincode and transactions used to look up each kind of anchored file
+type verifyTarget struct {
+	chaincodeEnv     string
+	defaultChaincode string
+	existsTx         string
+	getTx            string
+	historyTx        string
+}
+
+var verifyTargets = map[string]verifyTarget{
+	"planilha": {"SOLLYTCH_CHAIN_CCNAME", "sollytch-chain", "PlanilhaExists", "GetPlanilhaByHash", "GetPlanilhaHistory"},
+	"image":    {"SOLLYTCH_IMAGE_CCNAME", "sollytch-image", "ImageExists", "GetImageByID", "GetImageHistory"},
+}
+
+// VerificationAnchor identifies the transaction and block that wrote a hash
+type VerificationAnchor struct {
+	TxID        string `json:"tx_id"`
+	Timestamp   string `json:"timestamp"`
+	BlockNumber uint64 `json:"block_number"`
+}
+
+// VerificationReport is the signed result of checking a file against the ledger
+type VerificationReport struct {
+	AssetType  string              `json:"asset_type"`
+	Channel    string              `json:"channel"`
+	Chaincode  string              `json:"chaincode"`
+	FileName   string              `json:"file_name"`
+	FileSize   int64               `json:"file_size"`
+	MimeType   string              `json:"mime_type"`
+	Algorithm  string              `json:"algorithm"`
+	Encoding   string              `json:"encoding"`
+	Hash       string              `json:"hash"`
+	Verified   bool                `json:"verified"`
+	Record     json.RawMessage     `json:"record,omitempty"`
+	Anchor     *VerificationAnchor `json:"anchor,omitempty"`
+	LastUpdate *VerificationAnchor `json:"last_update,omitempty"`
+	VerifiedAt string              `json:"verified_at"`
+	SignerMSP  string              `json:"signer_msp"`
+}
+
+// SignedVerificationReport carries the report exactly as signed, so that the
+// signature can be checked over the raw bytes of the "report" field
+type SignedVerificationReport struct {
+	Report             json.RawMessage `json:"report"`
+	Signature          string          `json:"signature"`
+	SignatureAlgorithm string          `json:"signature_algorithm"`
+	Certificate        string          `json:"certificate"`
+}
+
+func VerifyFileDefault(c *gin.Context) {
+	channelName := os.Getenv("CHANNEL")
+
+	verifyFile(c, channelName)
+}
+
+func VerifyFileCustom(c *gin.Context) {
+	channelName := c.Param("channelName")
+
+	verifyFile(c, channelName)
+}
+
+// verifyFile hashes an uploaded spreadsheet or image (multipart field "file"),
+// looks the hash up on the ledger and returns a signed verification report
+func verifyFile(c *gin.Context, channelName string) {
+	assetType := c.Param("assetType")
+	target, ok := verifyTargets[assetType]
+	if !ok {
+		common.Abort(c, http.StatusNotFound, fmt.Errorf("unknown asset type: %s", assetType))
+		return
+	}
+
+	chaincodeName := os.Getenv(target.chaincodeEnv)
+	if chaincodeName == "" {
+		chaincodeName = target.defaultChaincode
+	}
+
+	algorithm := strings.ToLower(c.DefaultPostForm("algorithm", defaultVerifyAlgorithm))
+	newHash, ok := verifyHashAlgorithms[algorithm]
+	if !ok {
+		common.Abort(c, http.StatusBadRequest, fmt.Errorf("unsupported algorithm %s, expected one of: %s", algorithm, strings.Join(supportedVerifyAlgorithms(), ", ")))
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		common.Abort(c, http.StatusBadRequest, fmt.Errorf("missing multipart file field \"file\": %w", err))
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		common.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	// Sniff the MIME type from the content instead of trusting the client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		common.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	head = head[:n]
+
+	// Canonical hash: digest of the raw file bytes, lowercase hex
+	hasher := newHash()
+	hasher.Write(head)
+	rest, err := io.Copy(hasher, file)
+	if err != nil {
+		common.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+
+	user := c.GetHeader("User")
+	if user == "" {
+		user = "Admin"
+	}
+
+	report := VerificationReport{
+		AssetType: assetType,
+		Channel:   channelName,
+		Chaincode: chaincodeName,
+		FileName:  fileHeader.Filename,
+		FileSize:  int64(n) + rest,
+		MimeType:  http.DetectContentType(head),
+		Algorithm: algorithm,
+		Encoding:  "hex",
+		Hash:      hex.EncodeToString(hasher.Sum(nil)),
+		SignerMSP: common.GetMSPID(),
+	}
+
+	if err := lookupAnchoredHash(&report, target, user); err != nil {
+		err, status := common.ParseError(err)
+		common.Abort(c, status, err)
+		return
+	}
+
+	report.VerifiedAt = time.Now().UTC().Format(time.RFC3339)
+
+	signed, err := signVerificationReport(&report, user)
+	if err != nil {
+		common.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	common.Respond(c, signed, http.StatusOK, nil)
+}
+
+// lookupAnchoredHash fills the on-chain record and the transactions that
+// first anchored and last updated the hash. A hash that is not on the
+// ledger is reported with verified set to false.
+func lookupAnchoredHash(report *VerificationReport, target verifyTarget, user string) error {
+	existsResult, err := chaincode.QueryGateway(report.Channel, report.Chaincode, target.existsTx, user, []string{report.Hash})
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := json.Unmarshal(existsResult, &exists); err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	record, err := chaincode.QueryGateway(report.Channel, report.Chaincode, target.getTx, user, []string{report.Hash})
+	if err != nil {
+		return err
+	}
+
+	historyResult, err := chaincode.QueryGateway(report.Channel, report.Chaincode, target.historyTx, user, []string{report.Hash})
+	if err != nil {
+		return err
+	}
+
+	// History entries are chronological and use either snake or camel case
+	var history []map[string]interface{}
+	if err := json.Unmarshal(historyResult, &history); err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		return fmt.Errorf("no history found for %s", report.Hash)
+	}
+
+	report.Anchor, err = anchorFromHistory(report.Channel, user, history[0])
+	if err != nil {
+		return err
+	}
+	report.LastUpdate, err = anchorFromHistory(report.Channel, user, history[len(history)-1])
+	if err != nil {
+		return err
+	}
+
+	report.Record = record
+	report.Verified = true
+
+	return nil
+}
+
+// anchorFromHistory resolves the block number of a history entry through qscc
+func anchorFromHistory(channelName, user string, entry map[string]interface{}) (*VerificationAnchor, error) {
+	txID, _ := entry["tx_id"].(string)
+	if txID == "" {
+		txID, _ = entry["txId"].(string)
+	}
+	timestamp, _ := entry["timestamp"].(string)
+
+	result, err := chaincode.QueryGateway(channelName, "qscc", "GetBlockByTxID", user, []string{channelName, txID})
+	if err != nil {
+		return nil, err
+	}
+
+	var block protos.Block
+	if err := proto.Unmarshal(result, &block); err != nil {
+		return nil, err
+	}
+
+	return &VerificationAnchor{
+		TxID:        txID,
+		Timestamp:   timestamp,
+		BlockNumber: block.GetHeader().GetNumber(),
+	}, nil
+}
+
+// signVerificationReport signs the JSON encoding of the report with the key
+// of the API user, attaching its certificate for independent verification
+func signVerificationReport(report *VerificationReport, user string) (*SignedVerificationReport, error) {
+	reportBytes, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, scheme, err := common.SignAsUser(user, reportBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := common.GetSignCertPEM(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedVerificationReport{
+		Report:             reportBytes,
+		Signature:          base64.StdEncoding.EncodeToString(signature),
+		SignatureAlgorithm: scheme,
+		Certificate:        string(certificate),
+	}, nil
+}
+
+func supportedVerifyAlgorithms() []string {
+	algorithms := make([]string, 0, len(verifyHashAlgorithms))
+	for algorithm := range verifyHashAlgorithms {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
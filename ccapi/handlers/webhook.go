@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/common"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/webhook"
+)
+
+// RegisterWebhook registers a URL for the events in "event_types" (all of
+// them when empty). The secret used to sign the deliveries is generated
+// when not given and is only returned here.
+func RegisterWebhook(c *gin.Context) {
+	var req webhook.Registration
+	if err := c.BindJSON(&req); err != nil {
+		common.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+
+	registration, err := webhook.Default.Registry.Add(webhook.Registration{
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+	})
+	if err != nil {
+		common.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, registration)
+}
+
+// ListWebhooks lists the registered webhooks, without their secrets
+func ListWebhooks(c *gin.Context) {
+	registrations := webhook.Default.Registry.List()
+	for i := range registrations {
+		registrations[i].Secret = ""
+	}
+
+	common.Respond(c, registrations, http.StatusOK, nil)
+}
+
+func DeleteWebhook(c *gin.Context) {
+	if err := webhook.Default.Registry.Remove(c.Param("id")); err != nil {
+		common.Abort(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeadLetters lists the deliveries that could not be completed
+func ListWebhookDeadLetters(c *gin.Context) {
+	common.Respond(c, webhook.Default.DeadLetters.List(), http.StatusOK, nil)
+}
+
+// RetryWebhookDeadLetter delivers a dead letter again in the background
+func RetryWebhookDeadLetter(c *gin.Context) {
+	if err := webhook.Default.Retry(c.Param("id")); err != nil {
+		common.Abort(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": http.StatusAccepted})
+}
+
+func DeleteWebhookDeadLetter(c *gin.Context) {
+	if _, err := webhook.Default.DeadLetters.Take(c.Param("id")); err != nil {
+		common.Abort(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, webhook.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -9,32 +9,45 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/hyperledger-labs/cc-tools-demo/ccapi/chaincode"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/eventstream"
 	"github.com/hyperledger-labs/cc-tools-demo/ccapi/server"
-	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/webhook"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Create gin handler and start server
-	r := gin.Default()
+	// Create gin handler and start server. Query tickets of the event
+	// routes are removed before the request is logged.
+	r := gin.New()
+	r.Use(eventstream.HideQueryToken, gin.Logger(), gin.Recovery())
 	r.Use(cors.New(cors.Config{
 		AllowOrigins: []string{
 			"http://localhost:8080", // Test addresses
 			"*",
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Authorization", "Origin", "Content-Type"},
+		AllowHeaders:     []string{"Authorization", "Origin", "Content-Type", "Last-Event-ID"},
 		AllowCredentials: true,
 	}))
 	go server.Serve(r, ctx)
 
 	// Register to chaincode events
-	go chaincode.WaitForEvent(os.Getenv("CHANNEL"), os.Getenv("CCNAME"), "eventName", func(ccEvent *fab.CCEvent) {
+	go chaincode.WaitForEvent(ctx, os.Getenv("CHANNEL"), os.Getenv("CCNAME"), "eventName", func(ccEvent *client.ChaincodeEvent) {
 		log.Println("Received CC event: ", ccEvent)
 	})
 
-	chaincode.RegisterForEvents()
+	chaincode.RegisterForEvents(ctx)
+
+	// Resume the webhook deliveries interrupted by the last shutdown
+	webhook.Default.ResumeInFlight()
+
+	// Fan out the typed events of the sollytch chaincodes to their consumers
+	for _, ccName := range chaincode.SollytchChaincodes() {
+		go chaincode.HandleSollytchEvents(ctx, os.Getenv("CHANNEL"), ccName)
+	}
+	go chaincode.LogSollytchEvents()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
@@ -0,0 +1,194 @@
+// Package phash computes 64-bit perceptual hashes of cassette images, the
+// values anchored as perceptualHash in sollytch-image. Unlike a
+// cryptographic hash, re-encoding, resizing or slightly cropping a photo
+// changes only a few bits, so copies are found by Hamming distance.
+package phash
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported algorithms, with the names used by sollytch-image
+const (
+	DHash = "dhash"
+	PHash = "phash"
+)
+
+// Default is the algorithm used when none is given
+const Default = DHash
+
+// Algorithms lists the supported algorithms
+var Algorithms = []string{DHash, PHash}
+
+// FromReader decodes a JPEG or PNG image and returns its perceptual hash as
+// 16 lowercase hex characters
+func FromReader(r io.Reader, algorithm string) (string, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return "", fmt.Errorf("could not decode image: %w", err)
+	}
+
+	return FromImage(img, algorithm)
+}
+
+// FromImage returns the perceptual hash of an already decoded image
+func FromImage(img image.Image, algorithm string) (string, error) {
+	var hash uint64
+	switch strings.ToLower(algorithm) {
+	case "", DHash:
+		hash = dHash(img)
+	case PHash:
+		hash = pHash(img)
+	default:
+		return "", fmt.Errorf("unsupported perceptual hash algorithm %s, expected one of: %s", algorithm, strings.Join(Algorithms, ", "))
+	}
+
+	return fmt.Sprintf("%016x", hash), nil
+}
+
+// Distance returns the number of differing bits between two hex hashes
+func Distance(a, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q: %w", a, err)
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q: %w", b, err)
+	}
+
+	return bits.OnesCount64(x ^ y), nil
+}
+
+// dHash compares each pixel with its right neighbour on a 9x8 grayscale
+// thumbnail, one bit per comparison
+func dHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pixels[y][x] < pixels[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// pHash keeps the 8x8 lowest frequencies of the DCT of a 32x32 grayscale
+// thumbnail, one bit per coefficient above their median
+func pHash(img image.Image) uint64 {
+	const size, low = 32, 8
+
+	coefficients := dct2D(grayscale(img, size, size))
+
+	values := make([]float64, 0, low*low)
+	for y := 0; y < low; y++ {
+		values = append(values, coefficients[y][:low]...)
+	}
+
+	// The DC term only carries the mean brightness, so it is left out of
+	// the median
+	sorted := append([]float64(nil), values[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for _, value := range values {
+		hash <<= 1
+		if value > median {
+			hash |= 1
+		}
+	}
+
+	return hash
+}
+
+// grayscale shrinks the image to width x height by averaging the luma of the
+// source pixels covered by each cell
+func grayscale(img image.Image, width, height int) [][]float64 {
+	bounds := img.Bounds()
+	pixels := make([][]float64, height)
+
+	for y := 0; y < height; y++ {
+		pixels[y] = make([]float64, width)
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum float64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			pixels[y][x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	return pixels
+}
+
+// dct2D applies a type-II discrete cosine transform to the rows and then to
+// the columns of a square matrix
+func dct2D(matrix [][]float64) [][]float64 {
+	n := len(matrix)
+
+	rows := make([][]float64, n)
+	for y := range matrix {
+		rows[y] = dct1D(matrix[y])
+	}
+
+	result := make([][]float64, n)
+	for y := range result {
+		result[y] = make([]float64, n)
+	}
+	column := make([]float64, n)
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			column[y] = rows[y][x]
+		}
+		for y, value := range dct1D(column) {
+			result[y][x] = value
+		}
+	}
+
+	return result
+}
+
+func dct1D(values []float64) []float64 {
+	n := len(values)
+	result := make([]float64, n)
+
+	for k := 0; k < n; k++ {
+		var sum float64
+		for i, value := range values {
+			sum += value * math.Cos(math.Pi/float64(n)*(float64(i)+0.5)*float64(k))
+		}
+		result[k] = sum
+	}
+
+	return result
+}
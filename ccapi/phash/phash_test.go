@@ -0,0 +1,186 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// blocks draws an 8x8 grid of pseudo-random gray levels stretched over a
+// width x height image, so the same picture can be rendered at any size
+func blocks(width, height int, seed uint32) *image.Gray {
+	levels := make([]uint8, 64)
+	for i := range levels {
+		seed = seed*1664525 + 1013904223
+		levels[i] = uint8(seed >> 24)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: levels[(y*8/height)*8+x*8/width]})
+		}
+	}
+
+	return img
+}
+
+// gradient draws a horizontal ramp, brighter to the right when rising
+func gradient(width, height int, rising bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			level := uint8(x * 255 / (width - 1))
+			if !rising {
+				level = 255 - level
+			}
+			img.SetGray(x, y, color.Gray{Y: level})
+		}
+	}
+
+	return img
+}
+
+// flat draws a single gray level
+func flat(width, height int, level uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = level
+	}
+
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestKnownVectors(t *testing.T) {
+	cases := []struct {
+		name      string
+		img       image.Image
+		algorithm string
+		hash      string
+	}{
+		// Every pixel is darker than its right neighbour, or never is
+		{"rising gradient", gradient(90, 80, true), DHash, "ffffffffffffffff"},
+		{"falling gradient", gradient(90, 80, false), DHash, "0000000000000000"},
+		{"flat", flat(64, 64, 128), "", "0000000000000000"},
+
+		// Reference values of this implementation, kept stable across releases
+		// because they are anchored on the ledger
+		{"blocks 1", blocks(64, 64, 1), DHash, "e69d618e9c9a9a59"},
+		{"blocks 2", blocks(64, 64, 2), DHash, "b3ccca4ecda766e5"},
+		{"blocks 1", blocks(64, 64, 1), PHash, "b0060bf486556fef"},
+		{"blocks 2", blocks(64, 64, 2), PHash, "a611daec1a7d898f"},
+	}
+	for _, c := range cases {
+		hash, err := FromImage(c.img, c.algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != c.hash {
+			t.Errorf("%s %s: got %s, expected %s", c.name, c.algorithm, hash, c.hash)
+		}
+	}
+}
+
+func TestHashSurvivesReencodingAndResizing(t *testing.T) {
+	for _, algorithm := range Algorithms {
+		original, err := FromImage(blocks(64, 64, 1), algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reencoded, err := FromReader(encodeJPEG(t, blocks(64, 64, 1)), algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resized, err := FromImage(blocks(256, 192, 1), algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := FromImage(blocks(64, 64, 2), algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, hash := range map[string]string{"jpeg": reencoded, "resized": resized} {
+			distance, err := Distance(original, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if distance > 4 {
+				t.Errorf("%s %s copy is %d bits away from the original", algorithm, name, distance)
+			}
+		}
+
+		distance, err := Distance(original, other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if distance < 16 {
+			t.Errorf("%s: different images only %d bits apart", algorithm, distance)
+		}
+	}
+}
+
+func TestFromReaderDecodesPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, blocks(64, 64, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := FromReader(&buf, DHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "e69d618e9c9a9a59" {
+		t.Errorf("got %s from the PNG, expected the hash of the decoded image", hash)
+	}
+
+	if _, err := FromReader(strings.NewReader("not an image"), DHash); err == nil {
+		t.Error("expected an error for undecodable input")
+	}
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	if _, err := FromImage(blocks(8, 8, 1), "ahash"); err == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"0000000000000000", "0000000000000000", 0},
+		{"0000000000000000", "ffffffffffffffff", 64},
+		{"8000000000000001", "0000000000000000", 2},
+		{"e69d618e9c9a9a59", "E69D618E9C9A9A59", 0},
+	}
+	for _, c := range cases {
+		distance, err := Distance(c.a, c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if distance != c.distance {
+			t.Errorf("Distance(%s, %s) = %d, expected %d", c.a, c.b, distance, c.distance)
+		}
+	}
+
+	if _, err := Distance("not hex", "0000000000000000"); err == nil {
+		t.Error("expected an error for an invalid hash")
+	}
+}
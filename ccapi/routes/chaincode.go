@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/hyperledger-labs/cc-tools-demo/ccapi/eventstream"
 	"github.com/hyperledger-labs/cc-tools-demo/ccapi/handlers"
 
 	"github.com/gin-gonic/gin"
@@ -39,4 +40,33 @@ func addCCRoutes(rg *gin.RouterGroup) {
 	rg.GET("/query/:txname", handlers.QueryV1)
 
 	rg.GET("/:channelName/qscc/:txname", handlers.QueryQSCC)
+
+	// File verification routes
+	rg.POST("/verify/:assetType", handlers.VerifyFileDefault)
+	rg.POST("/:channelName/verify/:assetType", handlers.VerifyFileCustom)
+
+	// Perceptual hash of images before anchoring, and lookup of reused images
+	rg.POST("/images/phash", handlers.PerceptualHash)
+	rg.POST("/images/similar", handlers.FindSimilarImagesDefault)
+	rg.POST("/:channelName/images/similar", handlers.FindSimilarImagesCustom)
+
+	// Webhooks receiving the sollytch chaincode events, behind the same
+	// tokens as the event stream
+	webhooks := rg.Group("/webhooks", eventstream.RequireToken)
+	webhooks.POST("", handlers.RegisterWebhook)
+	webhooks.GET("", handlers.ListWebhooks)
+	webhooks.DELETE("/:id", handlers.DeleteWebhook)
+	webhooks.GET("/dead-letters", handlers.ListWebhookDeadLetters)
+	webhooks.POST("/dead-letters/:id/retry", handlers.RetryWebhookDeadLetter)
+	webhooks.DELETE("/dead-letters/:id", handlers.DeleteWebhookDeadLetter)
+
+	// Stream of the sollytch chaincode events (SSE or WebSocket)
+	rg.GET("/events/stream", eventstream.RequireToken, handlers.StreamEvents)
+	rg.POST("/events/tickets", eventstream.RequireToken, eventstream.IssueTicket)
+
+	// Chaincode events the listeners gave up on, behind the same tokens
+	skipped := rg.Group("/events/skipped", eventstream.RequireToken)
+	skipped.GET("", handlers.ListSkippedEvents)
+	skipped.POST("/:id/replay", handlers.ReplaySkippedEvent)
+	skipped.DELETE("/:id", handlers.DeleteSkippedEvent)
 }
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DeadLetter is a delivery that could not be completed, kept until it is
+// retried or discarded. InFlight marks a delivery still running when its
+// event was checkpointed: it is removed once the delivery succeeds, and
+// delivered again by ResumeInFlight if the process stopped before that.
+type DeadLetter struct {
+	Delivery       Delivery `json:"delivery"`
+	RegistrationID string   `json:"registration_id"`
+	URL            string   `json:"url"`
+	Attempts       int      `json:"attempts"`
+	LastStatus     int      `json:"last_status,omitempty"`
+	LastError      string   `json:"last_error"`
+	FailedAt       string   `json:"failed_at"`
+	InFlight       bool     `json:"in_flight,omitempty"`
+}
+
+// DeadLetterStore keeps the failed deliveries, optionally persisted to a JSON file
+type DeadLetterStore struct {
+	mu      sync.RWMutex
+	path    string
+	letters map[string]*DeadLetter
+}
+
+// NewDeadLetterStore creates a store backed by the file at path, loading
+// the dead letters already stored there. An empty path keeps them in memory.
+func NewDeadLetterStore(path string) (*DeadLetterStore, error) {
+	s := &DeadLetterStore{path: path, letters: map[string]*DeadLetter{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []*DeadLetter
+	if err := json.Unmarshal(data, &letters); err != nil {
+		return nil, fmt.Errorf("invalid dead letter file %s: %w", path, err)
+	}
+	for _, letter := range letters {
+		s.letters[letter.Delivery.ID] = letter
+	}
+
+	return s, nil
+}
+
+// Put stores a dead letter, replacing a previous failure of the same delivery
+func (s *DeadLetterStore) Put(letter DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.letters[letter.Delivery.ID]
+	s.letters[letter.Delivery.ID] = &letter
+	if err := s.save(); err != nil {
+		if previous != nil {
+			s.letters[letter.Delivery.ID] = previous
+		} else {
+			delete(s.letters, letter.Delivery.ID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Take removes a dead letter and returns it
+func (s *DeadLetterStore) Take(deliveryID string) (DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, ok := s.letters[deliveryID]
+	if !ok {
+		return DeadLetter{}, ErrNotFound
+	}
+
+	delete(s.letters, deliveryID)
+	if err := s.save(); err != nil {
+		s.letters[deliveryID] = letter
+		return DeadLetter{}, err
+	}
+
+	return *letter, nil
+}
+
+// List returns copies of the dead letters, oldest failures first
+func (s *DeadLetterStore) List() []DeadLetter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letters := make([]DeadLetter, 0, len(s.letters))
+	for _, letter := range s.letters {
+		letters = append(letters, *letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].FailedAt != letters[j].FailedAt {
+			return letters[i].FailedAt < letters[j].FailedAt
+		}
+		return letters[i].Delivery.ID < letters[j].Delivery.ID
+	})
+
+	return letters
+}
+
+// save writes the dead letters to the backing file; callers hold the lock
+func (s *DeadLetterStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	letters := make([]*DeadLetter, 0, len(s.letters))
+	for _, letter := range s.letters {
+		letters = append(letters, letter)
+	}
+
+	return writeJSONFile(s.path, letters)
+}
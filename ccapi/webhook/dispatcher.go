@@ -0,0 +1,417 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Sollytch-Event"
+	HeaderDelivery  = "X-Sollytch-Delivery"
+	HeaderTimestamp = "X-Sollytch-Timestamp"
+	HeaderSignature = "X-Sollytch-Signature"
+)
+
+// Delivery is the JSON body POSTed to the registered URLs
+type Delivery struct {
+	ID        string          `json:"id"`
+	EventID   string          `json:"event_id,omitempty"`
+	Event     string          `json:"event"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Dispatcher POSTs events to the registered webhooks, retrying failed
+// deliveries with exponential backoff and keeping the ones that never
+// succeed in the dead letter store
+type Dispatcher struct {
+	Registry       *Registry
+	DeadLetters    *DeadLetterStore
+	Client         *http.Client
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	WaitTimeout    time.Duration
+
+	pending sync.WaitGroup
+}
+
+// Default is the dispatcher used by the event handlers and the API routes
+var Default = NewFromEnv()
+
+// New creates a dispatcher with the default client and retry policy. The
+// client connects straight to the webhooks, without proxy, and refuses
+// private addresses unless the registry allows them.
+func New(registry *Registry, deadLetters *DeadLetterStore) *Dispatcher {
+	d := &Dispatcher{
+		Registry:       registry,
+		DeadLetters:    deadLetters,
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		WaitTimeout:    30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   d.dialControl,
+	}).DialContext
+	d.Client = &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	return d
+}
+
+// NewFromEnv creates a dispatcher persisting its registrations to
+// WEBHOOKS_FILE and its dead letters to WEBHOOK_DEAD_LETTER_FILE, with up to
+// WEBHOOK_MAX_ATTEMPTS attempts per delivery and DispatchWait returning
+// after WEBHOOK_WAIT_TIMEOUT (a Go duration). WEBHOOK_ALLOW_PRIVATE_TARGETS
+// set to true accepts webhooks on private networks, e.g. in a local docker
+// network. Files that cannot be loaded are logged and replaced by in-memory
+// storage.
+func NewFromEnv() *Dispatcher {
+	registry, err := NewRegistry(os.Getenv("WEBHOOKS_FILE"))
+	if err != nil {
+		log.Println("error loading webhooks, keeping them in memory: ", err)
+		registry, _ = NewRegistry("")
+	}
+
+	deadLetters, err := NewDeadLetterStore(os.Getenv("WEBHOOK_DEAD_LETTER_FILE"))
+	if err != nil {
+		log.Println("error loading webhook dead letters, keeping them in memory: ", err)
+		deadLetters, _ = NewDeadLetterStore("")
+	}
+
+	d := New(registry, deadLetters)
+	if value := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			log.Printf("invalid WEBHOOK_MAX_ATTEMPTS %q, using %d\n", value, d.MaxAttempts)
+		} else {
+			d.MaxAttempts = attempts
+		}
+	}
+	if value := os.Getenv("WEBHOOK_WAIT_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			log.Printf("invalid WEBHOOK_WAIT_TIMEOUT %q, using %s\n", value, d.WaitTimeout)
+		} else {
+			d.WaitTimeout = timeout
+		}
+	}
+	if value := os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("invalid WEBHOOK_ALLOW_PRIVATE_TARGETS %q, refusing private targets\n", value)
+		}
+		registry.AllowPrivateTargets = allow
+	}
+
+	return d
+}
+
+// Sign returns the signature header value of a delivery body: the hex
+// HMAC-SHA256, keyed by the registration secret, of "<timestamp>.<body>"
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a received signature header in constant time
+func VerifySignature(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Dispatch delivers the event in the background to every registration
+// receiving its type. The key identifies the event across replays: the
+// deliveries of the same event to the same webhook share their ID, which
+// receivers can use to discard duplicates. Without a key the ID is random.
+// Data that is not JSON is sent as a base64 string.
+func (d *Dispatcher) Dispatch(eventType, key string, data []byte) {
+	d.dispatch(eventType, key, data)
+}
+
+// DispatchWait is Dispatch, returning once every delivery has either
+// succeeded or been moved to the dead letter store, or once WaitTimeout
+// has elapsed. In that case the remaining deliveries are first recorded as
+// in-flight dead letters, so that they survive a restart, and go on in the
+// background. A zero WaitTimeout waits for every delivery. It returns
+// whether all finished, and the error recording the in-flight ones.
+func (d *Dispatcher) DispatchWait(eventType, key string, data []byte) (bool, error) {
+	deliveries, flights := d.dispatch(eventType, key, data)
+	if d.WaitTimeout <= 0 {
+		deliveries.Wait()
+		return true, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		deliveries.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(d.WaitTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true, nil
+	case <-timer.C:
+		return false, d.recordInFlight(flights)
+	}
+}
+
+// inFlight is a dispatched delivery, recorded in the dead letter store
+// while it runs once DispatchWait stopped waiting for it
+type inFlight struct {
+	mu           sync.Mutex
+	registration Registration
+	delivery     Delivery
+	finished     bool
+	recorded     bool
+}
+
+func (d *Dispatcher) dispatch(eventType, key string, data []byte) (*sync.WaitGroup, []*inFlight) {
+	if !json.Valid(data) {
+		data, _ = json.Marshal(data)
+	}
+
+	var deliveries sync.WaitGroup
+	var flights []*inFlight
+	for _, registration := range d.Registry.List() {
+		if !registration.Matches(eventType) {
+			continue
+		}
+
+		id, err := deliveryID(key, registration.ID)
+		if err != nil {
+			log.Println("error creating webhook delivery: ", err)
+			break
+		}
+		flight := &inFlight{
+			registration: registration,
+			delivery: Delivery{
+				ID:        id,
+				EventID:   key,
+				Event:     eventType,
+				CreatedAt: time.Now().UTC().Format(time.RFC3339),
+				Data:      data,
+			},
+		}
+		flights = append(flights, flight)
+
+		d.pending.Add(1)
+		deliveries.Add(1)
+		go func() {
+			defer d.pending.Done()
+			defer deliveries.Done()
+			letter := d.deliver(flight.registration, flight.delivery)
+
+			flight.mu.Lock()
+			defer flight.mu.Unlock()
+			flight.finished = true
+			if letter != nil {
+				d.storeDeadLetter(*letter)
+			} else if flight.recorded {
+				if _, err := d.DeadLetters.Take(flight.delivery.ID); err != nil && !errors.Is(err, ErrNotFound) {
+					log.Println("error removing in-flight webhook delivery: ", err)
+				}
+			}
+		}()
+	}
+
+	return &deliveries, flights
+}
+
+// recordInFlight stores the deliveries that are still running as
+// in-flight dead letters
+func (d *Dispatcher) recordInFlight(flights []*inFlight) error {
+	for _, flight := range flights {
+		flight.mu.Lock()
+		if !flight.finished && !flight.recorded {
+			err := d.DeadLetters.Put(DeadLetter{
+				Delivery:       flight.delivery,
+				RegistrationID: flight.registration.ID,
+				URL:            flight.registration.URL,
+				LastError:      "delivery still running when its event was checkpointed",
+				FailedAt:       time.Now().UTC().Format(time.RFC3339),
+				InFlight:       true,
+			})
+			if err != nil {
+				flight.mu.Unlock()
+				return fmt.Errorf("failed to record in-flight delivery %s: %w", flight.delivery.ID, err)
+			}
+			flight.recorded = true
+		}
+		flight.mu.Unlock()
+	}
+
+	return nil
+}
+
+// deliveryID derives the ID of the delivery of an event to a webhook
+func deliveryID(key, registrationID string) (string, error) {
+	if key == "" {
+		return randomHex(16)
+	}
+
+	digest := sha256.Sum256([]byte(key + "\n" + registrationID))
+	return hex.EncodeToString(digest[:16]), nil
+}
+
+// Retry takes a dead letter out of the store and delivers it again in the
+// background. Its registration must still exist.
+func (d *Dispatcher) Retry(deliveryID string) error {
+	letter, err := d.DeadLetters.Take(deliveryID)
+	if err != nil {
+		return err
+	}
+
+	registration, ok := d.Registry.Get(letter.RegistrationID)
+	if !ok {
+		if err := d.DeadLetters.Put(letter); err != nil {
+			log.Println("error restoring webhook dead letter: ", err)
+		}
+		return fmt.Errorf("registration %s of delivery %s: %w", letter.RegistrationID, deliveryID, ErrNotFound)
+	}
+
+	d.pending.Add(1)
+	go func() {
+		defer d.pending.Done()
+		d.Deliver(registration, letter.Delivery)
+	}()
+
+	return nil
+}
+
+// ResumeInFlight delivers again, in the background, the in-flight dead
+// letters left by a previous process that stopped before they finished
+func (d *Dispatcher) ResumeInFlight() {
+	for _, letter := range d.DeadLetters.List() {
+		if !letter.InFlight {
+			continue
+		}
+		if err := d.Retry(letter.Delivery.ID); err != nil {
+			log.Printf("error resuming webhook delivery %s: %v\n", letter.Delivery.ID, err)
+		}
+	}
+}
+
+// Wait blocks until the background deliveries are finished
+func (d *Dispatcher) Wait() {
+	d.pending.Wait()
+}
+
+// Deliver POSTs the delivery to the registration until it is accepted.
+// Network errors, 429 and 5xx responses are retried with exponential
+// backoff; other responses, or running out of attempts, move the delivery
+// to the dead letter store. It returns whether the delivery was accepted.
+func (d *Dispatcher) Deliver(registration Registration, delivery Delivery) bool {
+	letter := d.deliver(registration, delivery)
+	if letter == nil {
+		return true
+	}
+
+	d.storeDeadLetter(*letter)
+	return false
+}
+
+// deliver makes the delivery attempts of Deliver, returning the dead
+// letter of a delivery that was not accepted
+func (d *Dispatcher) deliver(registration Registration, delivery Delivery) *DeadLetter {
+	body, err := json.Marshal(delivery)
+	if err != nil {
+		log.Println("error encoding webhook delivery: ", err)
+		return &DeadLetter{
+			Delivery:       delivery,
+			RegistrationID: registration.ID,
+			URL:            registration.URL,
+			LastError:      err.Error(),
+			FailedAt:       time.Now().UTC().Format(time.RFC3339),
+		}
+	}
+
+	backoff := d.InitialBackoff
+	var status int
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		status, retry, err = d.post(registration, delivery, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= d.MaxAttempts {
+			log.Printf("webhook delivery %s of %s to %s failed after %d attempt(s): %s\n", delivery.ID, delivery.Event, registration.URL, attempt, err)
+			return &DeadLetter{
+				Delivery:       delivery,
+				RegistrationID: registration.ID,
+				URL:            registration.URL,
+				Attempts:       attempt,
+				LastStatus:     status,
+				LastError:      err.Error(),
+				FailedAt:       time.Now().UTC().Format(time.RFC3339),
+			}
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > d.MaxBackoff {
+			backoff = d.MaxBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) storeDeadLetter(letter DeadLetter) {
+	if err := d.DeadLetters.Put(letter); err != nil {
+		log.Println("error storing webhook dead letter: ", err)
+	}
+}
+
+// post makes a single signed delivery attempt, returning the response
+// status and whether a failure is worth retrying
+func (d *Dispatcher) post(registration Registration, delivery Delivery, body []byte) (int, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, registration.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(registration.Secret, timestamp, body))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res.StatusCode, false, nil
+	}
+
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return res.StatusCode, retry, fmt.Errorf("webhook responded %s", res.Status)
+}
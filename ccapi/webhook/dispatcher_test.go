@@ -0,0 +1,440 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubServer records the deliveries it receives and answers them with the
+// given statuses, the last one being repeated
+type stubServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newStubServer(t *testing.T, statuses ...int) *stubServer {
+	s := &stubServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		status := s.statuses[0]
+		if len(s.statuses) > 1 {
+			s.statuses = s.statuses[1:]
+		}
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadLetters, err := NewDeadLetterStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stub servers listen on the loopback interface
+	registry.AllowPrivateTargets = true
+
+	d := New(registry, deadLetters)
+	d.MaxAttempts = 3
+	d.InitialBackoff = time.Millisecond
+	d.MaxBackoff = 2 * time.Millisecond
+	return d
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	server := newStubServer(t, http.StatusNoContent)
+	d := newTestDispatcher(t)
+
+	registration, err := d.Registry.Add(Registration{URL: server.URL, EventTypes: []string{"HazardAlert"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Dispatch("TestStored", "", []byte(`{"test_id":"TEST-1"}`))
+	d.Dispatch("HazardAlert", "", []byte(`{"test_id":"TEST-1"}`))
+	d.Wait()
+
+	if len(server.requests) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(server.requests))
+	}
+	req, body := server.requests[0], server.bodies[0]
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(registration.Secret, timestamp, body, req.Header.Get(HeaderSignature)) {
+		t.Errorf("invalid signature %q", req.Header.Get(HeaderSignature))
+	}
+	if VerifySignature("other secret", timestamp, body, req.Header.Get(HeaderSignature)) {
+		t.Error("signature accepted with the wrong secret")
+	}
+
+	var delivery Delivery
+	if err := json.Unmarshal(body, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Event != "HazardAlert" || req.Header.Get(HeaderEvent) != "HazardAlert" || req.Header.Get(HeaderDelivery) != delivery.ID {
+		t.Errorf("unexpected delivery %+v with headers %v", delivery, req.Header)
+	}
+	if string(delivery.Data) != `{"test_id":"TEST-1"}` {
+		t.Errorf("unexpected data %s", delivery.Data)
+	}
+}
+
+func TestDeliveryRetriesWithBackoff(t *testing.T) {
+	server := newStubServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	d := newTestDispatcher(t)
+
+	if _, err := d.Registry.Add(Registration{URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Dispatch("TestStored", "", []byte(`{}`))
+	d.Wait()
+
+	if len(server.requests) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(server.requests))
+	}
+	ids := map[string]bool{}
+	for _, req := range server.requests {
+		ids[req.Header.Get(HeaderDelivery)] = true
+	}
+	if len(ids) != 1 {
+		t.Errorf("retries should keep the delivery id, got %v", ids)
+	}
+	if letters := d.DeadLetters.List(); len(letters) != 0 {
+		t.Errorf("unexpected dead letters %+v", letters)
+	}
+}
+
+func TestFailedDeliveriesAreDeadLettered(t *testing.T) {
+	d := newTestDispatcher(t)
+	unavailable := newStubServer(t, http.StatusBadGateway)
+	rejecting := newStubServer(t, http.StatusBadRequest)
+
+	if _, err := d.Registry.Add(Registration{URL: unavailable.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Registry.Add(Registration{URL: rejecting.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.DispatchWait("HazardAlert", "", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rejected deliveries are not retried
+	if len(unavailable.requests) != d.MaxAttempts || len(rejecting.requests) != 1 {
+		t.Errorf("unexpected attempts: %d and %d", len(unavailable.requests), len(rejecting.requests))
+	}
+
+	letters := d.DeadLetters.List()
+	if len(letters) != 2 {
+		t.Fatalf("expected 2 dead letters, got %+v", letters)
+	}
+	attempts := map[string]DeadLetter{}
+	for _, letter := range letters {
+		attempts[letter.URL] = letter
+	}
+	if letter := attempts[unavailable.URL]; letter.Attempts != d.MaxAttempts || letter.LastStatus != http.StatusBadGateway {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+	if letter := attempts[rejecting.URL]; letter.Attempts != 1 || letter.LastStatus != http.StatusBadRequest {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+
+	// A retried dead letter that succeeds leaves the store
+	unavailable.mu.Lock()
+	unavailable.statuses = []int{http.StatusOK}
+	unavailable.mu.Unlock()
+
+	letter := attempts[unavailable.URL]
+	if err := d.Retry(letter.Delivery.ID); err != nil {
+		t.Fatal(err)
+	}
+	d.Wait()
+
+	if letters := d.DeadLetters.List(); len(letters) != 1 || letters[0].URL != rejecting.URL {
+		t.Errorf("unexpected dead letters after retry %+v", letters)
+	}
+	if err := d.Retry(letter.Delivery.ID); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoresArePersisted(t *testing.T) {
+	dir := t.TempDir()
+	registry, err := NewRegistry(filepath.Join(dir, "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.lookupIP = func(string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("93.184.216.34")}, nil
+	}
+	if _, err := registry.Add(Registration{URL: "ftp://example.com"}); err == nil {
+		t.Error("non-http url accepted")
+	}
+	registration, err := registry.Add(Registration{URL: "https://example.com/hook", Secret: "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters, err := NewDeadLetterStore(filepath.Join(dir, "dead-letters.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := deadLetters.Put(DeadLetter{Delivery: Delivery{ID: "d1"}, RegistrationID: registration.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewRegistry(filepath.Join(dir, "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, ok := reloaded.Get(registration.ID); !ok || stored.Secret != "s3cr3t" {
+		t.Errorf("registration not persisted: %+v", stored)
+	}
+
+	reloadedLetters, err := NewDeadLetterStore(filepath.Join(dir, "dead-letters.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadedLetters.Take("d1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplayedEventsKeepTheirDeliveryID(t *testing.T) {
+	server := newStubServer(t, http.StatusOK)
+	d := newTestDispatcher(t)
+
+	if _, err := d.Registry.Add(Registration{URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	key := "mainchannel/sollytch-chain/12/tx1#0"
+	for _, eventKey := range []string{key, key, "mainchannel/sollytch-chain/12/tx2#0"} {
+		if _, err := d.DispatchWait("TestStored", eventKey, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(server.requests) != 3 {
+		t.Fatalf("expected 3 deliveries, got %d", len(server.requests))
+	}
+	first, replayed, other := server.requests[0].Header.Get(HeaderDelivery), server.requests[1].Header.Get(HeaderDelivery), server.requests[2].Header.Get(HeaderDelivery)
+	if first != replayed || first == other {
+		t.Errorf("unexpected delivery ids %q, %q and %q", first, replayed, other)
+	}
+
+	var delivery Delivery
+	if err := json.Unmarshal(server.bodies[0], &delivery); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.EventID != key {
+		t.Errorf("unexpected event id %q", delivery.EventID)
+	}
+}
+
+func TestAddRefusesPrivateTargets(t *testing.T) {
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.lookupIP = func(host string) ([]net.IP, error) {
+		switch host {
+		case "localhost":
+			return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, nil
+		case "internal.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.7")}, nil
+		case "hooks.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.1.2.3/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.1.10/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://internal.example.com/hook",
+	} {
+		if _, err := registry.Add(Registration{URL: url}); !errors.Is(err, ErrPrivateTarget) {
+			t.Errorf("%s: expected ErrPrivateTarget, got %v", url, err)
+		}
+	}
+
+	if _, err := registry.Add(Registration{URL: "https://unknown.example.com/hook"}); err == nil {
+		t.Error("unresolvable host accepted")
+	}
+	for _, url := range []string{"https://hooks.example.com/sollytch", "http://93.184.216.34/hook", "http://172.32.0.1/hook"} {
+		if _, err := registry.Add(Registration{URL: url}); err != nil {
+			t.Errorf("%s: %v", url, err)
+		}
+	}
+
+	registry.AllowPrivateTargets = true
+	if _, err := registry.Add(Registration{URL: "http://10.1.2.3/hook"}); err != nil {
+		t.Errorf("private target refused although allowed: %v", err)
+	}
+	if len(registry.List()) != 4 {
+		t.Errorf("expected 4 registrations, got %d", len(registry.List()))
+	}
+}
+
+func TestDeliveryRefusesPrivateAddress(t *testing.T) {
+	server := newStubServer(t, http.StatusOK)
+	d := newTestDispatcher(t)
+
+	// Registered while allowed, e.g. a host that later resolves elsewhere
+	registration, err := d.Registry.Add(Registration{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Registry.AllowPrivateTargets = false
+
+	if d.Deliver(*registration, Delivery{ID: "d1", Event: "HazardAlert", Data: []byte(`{}`)}) {
+		t.Fatal("delivery to a loopback address succeeded")
+	}
+	if len(server.requests) != 0 {
+		t.Errorf("the loopback server received %d requests", len(server.requests))
+	}
+
+	letters := d.DeadLetters.List()
+	if len(letters) != 1 || !strings.Contains(letters[0].LastError, ErrPrivateTarget.Error()) {
+		t.Errorf("unexpected dead letters %+v", letters)
+	}
+}
+
+func TestDispatchWaitIsBounded(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	d := newTestDispatcher(t)
+	d.WaitTimeout = 20 * time.Millisecond
+	if _, err := d.Registry.Add(Registration{URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	finished, err := d.DispatchWait("TestStored", "key", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished {
+		t.Error("DispatchWait reported a blocked delivery as finished")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("DispatchWait returned after %s", elapsed)
+	}
+
+	// The running delivery is recorded until it finishes
+	if letters := d.DeadLetters.List(); len(letters) != 1 || !letters[0].InFlight || letters[0].Delivery.EventID != "key" {
+		t.Errorf("in-flight delivery not recorded: %+v", letters)
+	}
+
+	// The delivery goes on in the background and succeeds once released
+	close(release)
+	d.Wait()
+	if letters := d.DeadLetters.List(); len(letters) != 0 {
+		t.Errorf("unexpected dead letters %+v", letters)
+	}
+
+	d.WaitTimeout = 0
+	if finished, err := d.DispatchWait("TestStored", "key", []byte(`{}`)); !finished || err != nil {
+		t.Errorf("DispatchWait without timeout returned before the delivery finished: %v", err)
+	}
+}
+
+func TestInFlightDeliveriesSurviveRestart(t *testing.T) {
+	// The first delivery hangs until the end of the test, as if the process
+	// stopped while it was running
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get(HeaderDelivery))
+		first := len(ids) == 1
+		mu.Unlock()
+
+		if first {
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "dead-letters.json")
+	deadLetters, err := NewDeadLetterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestDispatcher(t)
+	d.DeadLetters = deadLetters
+	d.WaitTimeout = 20 * time.Millisecond
+	defer d.Wait()
+	defer close(release)
+	if _, err := d.Registry.Add(Registration{URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	if finished, err := d.DispatchWait("HazardAlert", "mainchannel/sollytch-chain/7/tx1#0", []byte(`{}`)); finished || err != nil {
+		t.Fatalf("expected a running delivery, got %v, %v", finished, err)
+	}
+
+	// A new process loads the in-flight delivery and resumes it with the same id
+	reloaded, err := NewDeadLetterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := New(d.Registry, reloaded)
+	restarted.ResumeInFlight()
+	restarted.Wait()
+
+	if letters := reloaded.List(); len(letters) != 0 {
+		t.Errorf("unexpected dead letters %+v", letters)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 2 || ids[0] != ids[1] {
+		t.Errorf("unexpected delivery ids %q", ids)
+	}
+}
@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a registration or dead letter does not exist
+var ErrNotFound = errors.New("webhook not found")
+
+// Registration is a URL receiving the events of the given types, all of
+// them when EventTypes is empty. Deliveries are signed with Secret.
+type Registration struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// Matches tells whether the registration receives events of the given type
+func (r *Registration) Matches(eventType string) bool {
+	if len(r.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range r.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry keeps the webhook registrations, optionally persisted to a JSON
+// file. Unless AllowPrivateTargets is set, URLs whose host resolves to a
+// loopback, link-local or private address are refused.
+type Registry struct {
+	AllowPrivateTargets bool
+
+	mu            sync.RWMutex
+	path          string
+	registrations map[string]*Registration
+	lookupIP      func(host string) ([]net.IP, error)
+}
+
+// NewRegistry creates a registry backed by the file at path, loading the
+// registrations already stored there. An empty path keeps them in memory.
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path, registrations: map[string]*Registration{}, lookupIP: net.LookupIP}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var registrations []*Registration
+	if err := json.Unmarshal(data, &registrations); err != nil {
+		return nil, fmt.Errorf("invalid webhooks file %s: %w", path, err)
+	}
+	for _, registration := range registrations {
+		r.registrations[registration.ID] = registration
+	}
+
+	return r, nil
+}
+
+// Add validates and stores a registration, generating its ID and, when
+// not given, its secret. The stored registration is returned.
+func (r *Registry) Add(registration Registration) (*Registration, error) {
+	target, err := url.Parse(registration.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q", registration.URL)
+	}
+	if err := r.checkHost(target.Hostname()); err != nil {
+		return nil, err
+	}
+
+	registration.ID, err = randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	if registration.Secret == "" {
+		registration.Secret, err = randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if registration.EventTypes == nil {
+		registration.EventTypes = []string{}
+	}
+	registration.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.registrations[registration.ID] = &registration
+	if err := r.save(); err != nil {
+		delete(r.registrations, registration.ID)
+		return nil, err
+	}
+
+	return &registration, nil
+}
+
+// Remove deletes a registration
+func (r *Registry) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registration, ok := r.registrations[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(r.registrations, id)
+	if err := r.save(); err != nil {
+		r.registrations[id] = registration
+		return err
+	}
+
+	return nil
+}
+
+// Get returns a copy of a registration
+func (r *Registry) Get(id string) (Registration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	registration, ok := r.registrations[id]
+	if !ok {
+		return Registration{}, false
+	}
+	return *registration, true
+}
+
+// List returns copies of the registrations ordered by creation
+func (r *Registry) List() []Registration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	registrations := make([]Registration, 0, len(r.registrations))
+	for _, registration := range r.registrations {
+		registrations = append(registrations, *registration)
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		if registrations[i].CreatedAt != registrations[j].CreatedAt {
+			return registrations[i].CreatedAt < registrations[j].CreatedAt
+		}
+		return registrations[i].ID < registrations[j].ID
+	})
+
+	return registrations
+}
+
+// save writes the registrations to the backing file; callers hold the lock
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	registrations := make([]*Registration, 0, len(r.registrations))
+	for _, registration := range r.registrations {
+		registrations = append(registrations, registration)
+	}
+
+	return writeJSONFile(r.path, registrations)
+}
+
+// writeJSONFile replaces the file at path, going through a temporary file
+// synced to disk so that a crash never leaves it half written
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
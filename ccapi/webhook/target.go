@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ErrPrivateTarget is returned for webhook URLs reaching an address inside
+// the network of the API: loopback, link-local, private and the like
+var ErrPrivateTarget = errors.New("webhook url targets a private address")
+
+// publicAddress tells whether deliveries may reach ip. Loopback, link-local
+// (including the 169.254.169.254 cloud metadata endpoint), private (RFC 1918
+// and fc00::/7), unspecified and multicast addresses are refused.
+func publicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified())
+}
+
+// checkHost resolves the host of a webhook URL and refuses it when any of
+// its addresses is not public, unless the registry allows private targets
+func (r *Registry) checkHost(host string) error {
+	if r.AllowPrivateTargets {
+		return nil
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		ips, err = r.lookupIP(host)
+		if err != nil {
+			return fmt.Errorf("could not resolve webhook host %s: %w", host, err)
+		}
+	}
+
+	for _, ip := range ips {
+		if !publicAddress(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateTarget, host, ip)
+		}
+	}
+
+	return nil
+}
+
+// dialControl checks the address each delivery connects to, so that a host
+// resolving to a private address after its registration, or a redirect to
+// one, is refused as well
+func (d *Dispatcher) dialControl(network, address string, _ syscall.RawConn) error {
+	if d.Registry.AllowPrivateTargets {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, host)
+	}
+
+	return nil
+}
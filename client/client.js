@@ -48,11 +48,18 @@ const peerHostAlias = 'peer0.org1.example.com';
 
 const utf8Decoder = new TextDecoder();
 
-const controleInternoEncoder = {
-    'ok': 2,
-    'fail': 1,
-    'invalid': 0
-};
+// Campos preenchidos pelo chaincode, que o UpdateTest rejeita
+const LEDGER_FIELDS = [
+    'version', 'created_at', 'last_updated_at', 'last_updated_by_msp', 'last_updated_by',
+    'lote_flags', 'predictions',
+];
+
+function removeLedgerFields(test) {
+    for (const field of LEDGER_FIELDS) {
+        delete test[field];
+    }
+    return test;
+}
 
 function setNestedField(obj, path, value) {
     const keys = path.split('.');
@@ -69,77 +76,6 @@ function setNestedField(obj, path, value) {
 }
 
 
-function preprocessForPrediction(testData) {
-    console.log("Processando dados para predição...");
-    
-    // 1. IDENTIFICAR FEATURES (igual ao Python)
-    const numericFeatures = [
-        'expiry_days_left', 'distance_mm', 'time_to_migrate_s', 'sample_volume_uL',
-        'sample_pH', 'sample_turbidity_NTU', 'sample_temp_C', 'ambient_T_C',
-        'ambient_RH_pct', 'lighting_lux', 'tilt_deg', 'preincubation_time_s',
-        'time_since_sampling_min', 'tempo_transporte_horas', 'estimated_concentration_ppb',
-        'incerteza_estimativa_ppb'
-    ];
-    
-    const categoricalFeatures = ['control_line_ok', 'controle_interno_result'];
-    const allFeatures = [...numericFeatures, ...categoricalFeatures];
-    
-    const processedData = {...testData};
-    
-    if (typeof processedData.control_line_ok === 'boolean') {
-        processedData.control_line_ok = processedData.control_line_ok ? 1 : 0;
-        console.log(`Booleano convertido: control_line_ok → ${processedData.control_line_ok}`);
-    }
-    
-    if (processedData.controle_interno_result in controleInternoEncoder) {
-        processedData.controle_interno_result = controleInternoEncoder[processedData.controle_interno_result];
-        console.log(`Codificada 'controle_interno_result': ${testData.controle_interno_result} → ${processedData.controle_interno_result}`);
-    } else {
-        processedData.controle_interno_result = 0; // valor padrão
-        console.log(`Valor desconhecido 'controle_interno_result': ${testData.controle_interno_result} → 0`);
-    }
-    
-    allFeatures.forEach(feature => {
-        if (processedData[feature] === null || processedData[feature] === undefined) {
-            processedData[feature] = 0;
-            console.log(`Preenchido valor nulo: ${feature} → 0`);
-        }
-    });
-    
-    if (processedData.image_blur_score === null || processedData.image_blur_score === undefined) {
-        processedData.image_blur_score = 0.0;
-    }
-    
-    const csvData = [
-        processedData.lat,
-        processedData.lon,
-        processedData.expiry_days_left,
-        processedData.distance_mm,
-        processedData.time_to_migrate_s,
-        processedData.sample_volume_uL,
-        processedData.sample_pH,
-        processedData.sample_turbidity_NTU,
-        processedData.sample_temp_C,
-        processedData.ambient_T_C,
-        processedData.ambient_RH_pct,
-        processedData.lighting_lux,
-        processedData.tilt_deg,
-        processedData.preincubation_time_s,
-        processedData.time_since_sampling_min,
-        processedData.image_blur_score,
-        processedData.tempo_transporte_horas,
-        processedData.estimated_concentration_ppb,
-        processedData.incerteza_estimativa_ppb,
-        processedData.control_line_ok,
-        processedData.controle_interno_result
-    ].join(',');
-    
-    console.log("Dados pré-processados com sucesso");
-    console.log(`CSV gerado: ${csvData}`);
-    
-    return csvData;
-}
-
 async function newGrpcConnection() {
     const tlsRootCert = await fs.readFile(tlsCertPath);
     const tlsCredentials = grpc.credentials.createSsl(tlsRootCert);
@@ -176,14 +112,11 @@ async function invoke(contract) {
     const testID = testData.test_id;
     console.log(testID)
     
-    // Pré-processar os dados
-    const predictStr = preprocessForPrediction(testData);
-    
-    // String JSON original
+    // String JSON original (a linha de predição é montada pelo chaincode)
     const jsonStr = JSON.stringify(testData);
 
     try {
-        await contract.submitTransaction("StoreTest", testID, jsonStr, predictStr);
+        await contract.submitTransaction("StoreTest", testID, jsonStr, "");
         console.log("Teste armazenado com sucesso");
     } catch (error) {
         console.error("Erro:", error);
@@ -234,6 +167,54 @@ function hashImage(path) {
   return hash;
 }
 
+// Metadados do arquivo enviados junto com o hash (mesmo algoritmo do hashImage)
+const MIME_TYPES = {
+  ".png": "image/png",
+  ".jpg": "image/jpeg",
+  ".jpeg": "image/jpeg",
+  ".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+  ".csv": "text/csv",
+};
+
+function fileMetadata(filePath) {
+  return JSON.stringify({
+    algorithm: "sha512",
+    encoding: "hex",
+    file_size: fsRead.statSync(filePath).size,
+    mime_type: MIME_TYPES[path.extname(filePath).toLowerCase()] || "application/octet-stream",
+    file_name: path.basename(filePath),
+  });
+}
+
+// Hash perceptual da imagem calculado pela ccapi, usado por FindSimilarImages
+const ccapiURL = process.env.CCAPI_URL || "http://localhost:80/api";
+
+async function perceptualHash(filePath) {
+  const form = new FormData();
+  form.append("file", new Blob([fsRead.readFileSync(filePath)]), path.basename(filePath));
+
+  const response = await fetch(`${ccapiURL}/images/phash`, { method: "POST", body: form });
+  const result = await response.json();
+  if (!response.ok) {
+    throw new Error(`erro ao calcular hash perceptual: ${result.error || response.status}`);
+  }
+  return result;
+}
+
+async function imageMetadata(filePath) {
+  const metadata = JSON.parse(fileMetadata(filePath));
+  const perceptual = await perceptualHash(filePath);
+  return JSON.stringify({
+    algorithm: metadata.algorithm,
+    encoding: metadata.encoding,
+    fileSize: metadata.file_size,
+    mimeType: metadata.mime_type,
+    fileName: metadata.file_name,
+    perceptualHash: perceptual.perceptual_hash,
+    perceptualHashAlgorithm: perceptual.algorithm,
+  });
+}
+
 async function getImageByID(contract,imageID) {
     try {
         const rawResult = await contract.evaluateTransaction("GetImageByID", imageID);
@@ -255,7 +236,7 @@ async function getImageByID(contract,imageID) {
 
 async function getImagesByKit(contract,kitID) {
     try {
-        const rawResult = await contract.evaluateTransaction("GetImagesByKit", kitID);
+        const rawResult = await contract.evaluateTransaction("GetImagesByKit", kitID, "false");
         
         let jsonString = "";
         for (const byte of rawResult) {
@@ -278,7 +259,8 @@ async function storeImage(contract,imagePath) {
     await contract.submitTransaction(
         "StoreImage",
         kitID,
-        imageHash
+        imageHash,
+        await imageMetadata(imagePath)
     );
 
     console.log("Imagem armazenada com sucesso!");
@@ -290,7 +272,8 @@ async function storePlanilha(contract, planilhaPath) {
     await contract.submitTransaction(
         "StorePlanilha",
         lote,
-        planilhaHash
+        planilhaHash,
+        fileMetadata(planilhaPath)
     );
 
     console.log("planilha armazenada com sucesso!");
@@ -337,14 +320,15 @@ async function getPlanilhasByLote(contract,lote) {
 async function editTest(contract) {
     const testID = (await askQuestion('testID do teste: ')).trim();
 
-    const testData = await query(contract, testID);
-    if (!testData) return;
+    const stored = await query(contract, testID);
+    if (!stored) return;
+    const testData = removeLedgerFields(stored);
 
     console.log('\nJSON atual:\n');
     console.log(JSON.stringify(testData, null, 2));
 
     const fieldPath = (await askQuestion(
-        '\nCampo a editar (ex: sample_pH ou predictions.qc_status): '
+        '\nCampo a editar (ex: sample_pH ou operator_id): '
     )).trim();
 
     const rawValue = (await askQuestion(
@@ -43,82 +43,6 @@ const peerHostAlias = 'peer0.org1.example.com';
 
 const utf8Decoder = new TextDecoder();
 
-const controleInternoEncoder = {
-    'ok': 2,
-    'fail': 1,
-    'invalid': 0
-};
-
-function preprocessForPrediction(testData) {
-    console.log("Processando dados para predição...");
-    
-    const numericFeatures = [
-        'expiry_days_left', 'distance_mm', 'time_to_migrate_s', 'sample_volume_uL',
-        'sample_pH', 'sample_turbidity_NTU', 'sample_temp_C', 'ambient_T_C',
-        'ambient_RH_pct', 'lighting_lux', 'tilt_deg', 'preincubation_time_s',
-        'time_since_sampling_min', 'tempo_transporte_horas', 'estimated_concentration_ppb',
-        'incerteza_estimativa_ppb'
-    ];
-
-    const categoricalFeatures = ['control_line_ok', 'controle_interno_result'];
-    const allFeatures = [...numericFeatures, ...categoricalFeatures];
-
-    const processedData = {...testData};
-
-    if (typeof processedData.control_line_ok === 'boolean') {
-        processedData.control_line_ok = processedData.control_line_ok ? 1 : 0;
-        console.log(`Booleano convertido: control_line_ok → ${processedData.control_line_ok}`);
-    }
-
-    if (processedData.controle_interno_result in controleInternoEncoder) {
-        processedData.controle_interno_result = controleInternoEncoder[processedData.controle_interno_result];
-        console.log(`Codificada 'controle_interno_result': ${testData.controle_interno_result} → ${processedData.controle_interno_result}`);
-    } else {
-        processedData.controle_interno_result = 0; // valor padrão
-        console.log(`Valor desconhecido 'controle_interno_result': ${testData.controle_interno_result} → 0`);
-    }
-
-    allFeatures.forEach(feature => {
-        if (processedData[feature] === null || processedData[feature] === undefined) {
-            processedData[feature] = 0;
-            console.log(`Preenchido valor nulo: ${feature} → 0`);
-        }
-    });
-
-    if (processedData.image_blur_score === null || processedData.image_blur_score === undefined) {
-        processedData.image_blur_score = 0.0;
-    }
-
-    const csvData = [
-        processedData.lat,
-        processedData.lon,
-        processedData.expiry_days_left,
-        processedData.distance_mm,
-        processedData.time_to_migrate_s,
-        processedData.sample_volume_uL,
-        processedData.sample_pH,
-        processedData.sample_turbidity_NTU,
-        processedData.sample_temp_C,
-        processedData.ambient_T_C,
-        processedData.ambient_RH_pct,
-        processedData.lighting_lux,
-        processedData.tilt_deg,
-        processedData.preincubation_time_s,
-        processedData.time_since_sampling_min,
-        processedData.image_blur_score,
-        processedData.tempo_transporte_horas,
-        processedData.estimated_concentration_ppb,
-        processedData.incerteza_estimativa_ppb,
-        processedData.control_line_ok,
-        processedData.controle_interno_result
-    ].join(',');
-
-    console.log("Dados pré-processados com sucesso");
-    console.log(`CSV gerado: ${csvData}`);
-
-    return csvData;
-}
-
 async function newGrpcConnection() {
     const tlsRootCert = await fs.readFile(tlsCertPath);
     const tlsCredentials = grpc.credentials.createSsl(tlsRootCert);
@@ -154,13 +78,13 @@ async function storeTest(jsonStr) {
     const testID = testData.test_id;
     console.log(testID)
     
-    const predictStr = preprocessForPrediction(testData);
+    // a linha de predição é montada pelo chaincode a partir do JSON
     try {
         await sollytchChainContract.submitTransaction(
             "StoreTest",
             testID,
             jsonStr,
-            predictStr
+            ""
         );
         console.log(`Teste ${testID} armazenado com sucesso`)
     } catch (err) {
@@ -169,6 +93,24 @@ async function storeTest(jsonStr) {
     }
 }
 
+// envia varios testes em uma unica transacao; batchJSON e um array de
+// { test_id, test, predict_str? } e o retorno traz o resultado de cada item
+async function storeTests(batchJSON) {
+    try {
+        const resultBytes = await sollytchChainContract.submitTransaction(
+            "StoreTests",
+            batchJSON
+        );
+        const results = JSON.parse(utf8Decoder.decode(resultBytes));
+        const stored = results.filter((result) => result.success).length;
+        console.log(`Lote processado: ${stored}/${results.length} testes armazenados`)
+        return results
+    } catch (err) {
+        console.error(`Falha ao armazenar lote de testes: ${err}`)
+        throw err
+    }
+}
+
 async function updateTest(jsonStr, testID) {
     try{
         await sollytchChainContract.submitTransaction(
@@ -217,6 +159,35 @@ async function queryTestByID(testID){
     }
 }
 
+async function linkTestImage(testID, imageHash) {
+    try {
+        await sollytchChainContract.submitTransaction(
+            "LinkTestImage",
+            testID,
+            imageHash
+        );
+        console.log(`Imagem ${imageHash} vinculada ao teste ${testID}`)
+    } catch (err) {
+        console.error(`Falha ao vincular imagem ao teste ${testID}: ${err}`)
+        throw err
+    }
+}
+
+async function queryTestWithEvidence(testID) {
+    try {
+        const rawResult = await sollytchChainContract.evaluateTransaction(
+            "GetTestWithEvidence",
+            testID
+        );
+        const result = JSON.parse(utf8Decoder.decode(rawResult));
+        console.log("Resultado do query do teste com evidencias:")
+        console.log(result)
+        return result
+    } catch (err) {
+        console.error("Erro ao buscar evidencias do teste: ", err)
+    }
+}
+
 async function queryTestByLote(lote){
     try{
         const rawResult = await sollytchChainContract.evaluateTransaction(
@@ -238,12 +209,14 @@ async function queryTestByLote(lote){
     }
 }
 
-async function storePlanilha(lote,planilhaHash){
+// metadataJSON: { algorithm, encoding, file_size, mime_type, file_name } (padrão sha512/hex)
+async function storePlanilha(lote,planilhaHash,metadataJSON = '{}'){
     try{
         await sollytchChainContract.submitTransaction(
             "StorePlanilha",
             lote,
-            planilhaHash
+            planilhaHash,
+            metadataJSON
         );
         console.log(`Planilha ${planilhaHash} armazenada com sucesso`)
     }catch(err){
@@ -293,12 +266,35 @@ async function queryPlanilhaByLote(lote){
     }   
 }
 
-async function storeImage(imageHash, kitID) {
+const ccapiURL = process.env.CCAPI_URL || 'http://localhost:80/api';
+
+// Calcula o hash perceptual (dhash ou phash) da imagem pela ccapi, antes de ancorá-la
+async function computePerceptualHash(fileBuffer, fileName, algorithm = 'dhash') {
+    const form = new FormData();
+    form.append('file', new Blob([fileBuffer]), fileName);
+    form.append('algorithm', algorithm);
+
+    const response = await fetch(`${ccapiURL}/images/phash`, { method: 'POST', body: form });
+    const result = await response.json();
+    if (!response.ok) {
+        throw new Error(`erro ao calcular hash perceptual: ${result.error || response.status}`);
+    }
+    return {
+        perceptualHash: result.perceptual_hash,
+        perceptualHashAlgorithm: result.algorithm
+    };
+}
+
+// metadataJSON: { algorithm, encoding, fileSize, mimeType, fileName } (padrão sha512/hex)
+// e, para quadros de um teste: { testId, frameRole, captureTime, deviceId, resolution, blurScore,
+// perceptualHash, perceptualHashAlgorithm } - use storeImageFile para calcular os hashes do arquivo
+async function storeImage(imageHash, kitID, metadataJSON = '{}') {
     try{
         await sollytchImageContract.submitTransaction(
             "StoreImage",
             kitID,
-            imageHash
+            imageHash,
+            metadataJSON
         );
         console.log("Imagem armazenada com sucesso!");
     } catch(err){
@@ -306,6 +302,52 @@ async function storeImage(imageHash, kitID) {
     }
 }
 
+// Ancora um arquivo de imagem: hash sha512 do conteúdo e hash perceptual calculado pela ccapi
+async function storeImageFile(filePath, kitID, metadata = {}) {
+    const fileBuffer = await fs.readFile(filePath);
+    const imageHash = crypto.createHash('sha512').update(fileBuffer).digest('hex');
+    const perceptual = await computePerceptualHash(fileBuffer, path.basename(filePath));
+
+    await storeImage(imageHash, kitID, JSON.stringify({
+        algorithm: 'sha512',
+        encoding: 'hex',
+        fileSize: fileBuffer.length,
+        fileName: path.basename(filePath),
+        ...metadata,
+        ...perceptual
+    }));
+    return imageHash;
+}
+
+async function reassignImageKit(imageHash, newKitID, reason) {
+    try {
+        await sollytchImageContract.submitTransaction(
+            "ReassignImageKit",
+            imageHash,
+            newKitID,
+            reason
+        );
+        console.log(`Imagem ${imageHash} movida para o kit ${newKitID}`)
+    } catch (err) {
+        console.error(`Falha ao reatribuir imagem ${imageHash}: ${err}`)
+        throw err
+    }
+}
+
+async function revokeImage(imageHash, reason) {
+    try {
+        await sollytchImageContract.submitTransaction(
+            "RevokeImage",
+            imageHash,
+            reason
+        );
+        console.log(`Imagem ${imageHash} revogada`)
+    } catch (err) {
+        console.error(`Falha ao revogar imagem ${imageHash}: ${err}`)
+        throw err
+    }
+}
+
 async function queryImageByHash(imageHash){
     try {
         const rawResult = await sollytchImageContract.evaluateTransaction(
@@ -327,11 +369,61 @@ async function queryImageByHash(imageHash){
     }
 }
 
-async function queryImageByKit(kitID){
+async function queryImageByKit(kitID, includeRevoked = false){
     try {
         const rawResult = await sollytchImageContract.evaluateTransaction(
             "GetImagesByKit",
-            kitID);
+            kitID,
+            String(includeRevoked));
+        
+        let jsonString = "";
+        for (const byte of rawResult) {
+            jsonString += String.fromCharCode(byte);
+        }
+        
+        const result = JSON.parse(jsonString);
+        console.log(result)
+        return result;
+        
+    } catch (error) {
+        console.error("Erro:", error);
+        return null;
+    }
+}
+
+async function queryImagesByTest(testID, includeRevoked = false){
+    try {
+        const rawResult = await sollytchImageContract.evaluateTransaction(
+            "GetImagesByTest",
+            testID,
+            String(includeRevoked));
+        
+        let jsonString = "";
+        for (const byte of rawResult) {
+            jsonString += String.fromCharCode(byte);
+        }
+        
+        const result = JSON.parse(jsonString);
+        console.log(result)
+        return result;
+        
+    } catch (error) {
+        console.error("Erro:", error);
+        return null;
+    }
+}
+
+// perceptualHash: 16 caracteres hex (dhash ou phash); maxDistance: bits diferentes aceitos;
+// limit: quantidade máxima de imagens retornadas (0 usa o padrão do chaincode)
+async function querySimilarImages(perceptualHash, algorithm = 'dhash', maxDistance = 10, includeRevoked = false, limit = 0){
+    try {
+        const rawResult = await sollytchImageContract.evaluateTransaction(
+            "FindSimilarImages",
+            perceptualHash,
+            algorithm,
+            String(maxDistance),
+            String(includeRevoked),
+            String(limit));
         
         let jsonString = "";
         for (const byte of rawResult) {
@@ -379,13 +471,22 @@ module.exports={
     initialize,
     disconnect,
     storeTest,
+    storeTests,
     queryTestByID,
     queryTestByLote,
+    linkTestImage,
+    queryTestWithEvidence,
     storeModel,
     updateTest,
     storeImage,
+    storeImageFile,
+    computePerceptualHash,
+    reassignImageKit,
+    revokeImage,
     queryImageByHash,
     queryImageByKit,
+    queryImagesByTest,
+    querySimilarImages,
     storePlanilha,
     queryPlanilhaByHash,
     queryPlanilhaByLote
@@ -235,21 +235,37 @@ app.post('/query',       authRequired, handleTransaction);
 
 const STANDALONE_FN_MAP = {
   // sollytch-chain
-  // StoreTest args: [testID, jsonStr, predictStr] - standalone_client.storeTest(jsonStr) extrai test_id internamente
+  // StoreTest args: [testID, jsonStr, predictStr?] - standalone_client.storeTest(jsonStr) extrai test_id internamente
   StoreTest:           (c, a) => c.storeTest(a[1]),
+  // StoreTests args: [batchJSON] - array de { test_id, test, predict_str? }
+  StoreTests:          (c, a) => c.storeTests(a[0]),
   // UpdateTest args: [testID, jsonStr] - standalone_client.updateTest(jsonStr, testID)
   UpdateTest:          (c, a) => c.updateTest(a[1], a[0]),
   // StoreModel args: [modelKey, modelBase64] - standalone_client.storeModel(modelBase64, modelKey)
   StoreModel:          (c, a) => c.storeModel(a[1], a[0]),
   GetTestByID:         (c, a) => c.queryTestByID(a[0]),
   GetTestsByLote:      (c, a) => c.queryTestByLote(a[0]),
-  StorePlanilha:       (c, a) => c.storePlanilha(a[0], a[1]),
+  // LinkTestImage args: [testID, imageHash]
+  LinkTestImage:       (c, a) => c.linkTestImage(a[0], a[1]),
+  GetTestWithEvidence: (c, a) => c.queryTestWithEvidence(a[0]),
+  // StorePlanilha args: [lote, hash, metadataJSON?]
+  StorePlanilha:       (c, a) => c.storePlanilha(a[0], a[1], a[2]),
   GetPlanilhaByHash:   (c, a) => c.queryPlanilhaByHash(a[0]),
   GetPlanilhasByLote:  (c, a) => c.queryPlanilhaByLote(a[0]),
   // sollytch-image
-  StoreImage:          (c, a) => c.storeImage(a[1], a[0]),
+  // StoreImage args: [kitID, hash, metadataJSON?]
+  StoreImage:          (c, a) => c.storeImage(a[1], a[0], a[2]),
   GetImageByID:        (c, a) => c.queryImageByHash(a[0]),
-  GetImagesByKit:      (c, a) => c.queryImageByKit(a[0]),
+  // GetImagesByKit args: [kitID, includeRevoked?] - "true" inclui imagens revogadas
+  GetImagesByKit:      (c, a) => c.queryImageByKit(a[0], a[1] === 'true' || a[1] === true),
+  // GetImagesByTest args: [testID, includeRevoked?] - quadros em ordem de captura
+  GetImagesByTest:     (c, a) => c.queryImagesByTest(a[0], a[1] === 'true' || a[1] === true),
+  // FindSimilarImages args: [perceptualHash, algorithm?, maxDistance?, includeRevoked?, limit?]
+  FindSimilarImages:   (c, a) => c.querySimilarImages(a[0], a[1] || 'dhash', a[2] === undefined ? 10 : Number(a[2]), a[3] === 'true' || a[3] === true, a[4] === undefined ? 0 : Number(a[4])),
+  // ReassignImageKit args: [imageHash, newKitID, reason]
+  ReassignImageKit:    (c, a) => c.reassignImageKit(a[0], a[1], a[2]),
+  // RevokeImage args: [imageHash, reason]
+  RevokeImage:         (c, a) => c.revokeImage(a[0], a[1]),
 };
 
 app.post('/transaction-standalone', async (req, res) => {
@@ -277,6 +293,28 @@ app.post('/transaction-standalone', async (req, res) => {
   }
 });
 
+// ---------------------------------------------------------------------------
+// Hash perceptual de imagens (calculado pela ccapi antes do StoreImage)
+// ---------------------------------------------------------------------------
+
+app.post('/images/phash', upload.single('file'), async (req, res) => {
+  if (!req.file) {
+    return res.status(400).json({ error: 'arquivo obrigatorio' });
+  }
+
+  try {
+    const fileBuffer = await fsRead.promises.readFile(req.file.path);
+    const result = await standaloneClient.computePerceptualHash(
+      fileBuffer, req.file.originalname, req.body.algorithm || 'dhash');
+    res.json(result);
+  } catch (err) {
+    console.error('Erro ao calcular hash perceptual:', err);
+    res.status(502).json({ error: err.message });
+  } finally {
+    fsRead.promises.unlink(req.file.path).catch(() => {});
+  }
+});
+
 // ---------------------------------------------------------------------------
 // HEALTH CHECK
 // ---------------------------------------------------------------------------
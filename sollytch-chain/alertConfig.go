@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Chave do limite de concentração aplicado às matrizes sem limite próprio
+const defaultMatrixLimit = "default"
+
+// struct json das regras de alerta de resultados perigosos armazenadas no ledger
+type AlertConfig struct {
+	//trackers
+	Version      int    `json:"version"`
+	UpdatedAt    string `json:"updated_at"`
+	UpdatedByMSP string `json:"updated_by_msp"`
+	UpdatedBy    string `json:"updated_by"`
+
+	//valores de acao_recomendada que disparam alerta (ex.: interdição do lote)
+	AcoesRecomendadas []string `json:"acoes_recomendadas"`
+	//classes de resultado que disparam alerta
+	ResultClasses []string `json:"result_classes"`
+	//limite legal (ppb) de estimated_concentration_ppb por matrix_type;
+	//a chave "default" vale para as matrizes sem limite próprio
+	ConcentrationLimitsPpb map[string]float64 `json:"concentration_limits_ppb"`
+}
+
+// Regras usadas enquanto nenhuma outra for gravada no ledger
+func defaultAlertConfig() *AlertConfig {
+	return &AlertConfig{
+		AcoesRecomendadas:      []string{"bloquear_lote_e_confirmar_laboratorio"},
+		ResultClasses:          []string{"positive"},
+		ConcentrationLimitsPpb: map[string]float64{},
+	}
+}
+
+// Cria a chave composta sob a qual as regras de alerta são armazenadas
+func alertConfigKey(ctx contractapi.TransactionContextInterface) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("config", []string{"alertas"})
+}
+
+/*
+	Função que valida as regras de alerta: valores de acao_recomendada e
+	de result_class não vazios e sem repetição, e limites de concentração
+	positivos associados a uma matriz
+*/
+func validateAlertConfig(config *AlertConfig) error {
+	for name, values := range map[string][]string{
+		"acoes_recomendadas": config.AcoesRecomendadas,
+		"result_classes":     config.ResultClasses,
+	} {
+		seen := map[string]bool{}
+		for _, value := range values {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("%s nao pode conter valores vazios", name)
+			}
+			if seen[value] {
+				return fmt.Errorf("valor %s repetido em %s", value, name)
+			}
+			seen[value] = true
+		}
+	}
+
+	for matrix, limit := range config.ConcentrationLimitsPpb {
+		if matrix == "" {
+			return fmt.Errorf("concentration_limits_ppb nao pode ter matriz vazia")
+		}
+		if limit <= 0 {
+			return fmt.Errorf("limite de concentracao da matriz %s deve ser positivo", matrix)
+		}
+	}
+
+	return nil
+}
+
+/*
+	Função que recupera as regras de alerta do ledger. Enquanto nenhuma
+	for gravada, alertam o bloqueio do lote e os resultados positivos,
+	sem limites de concentração
+*/
+func getAlertConfig(ctx contractapi.TransactionContextInterface) (*AlertConfig, error) {
+	key, err := alertConfigKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if configBytes == nil {
+		return defaultAlertConfig(), nil
+	}
+
+	var config AlertConfig
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+/*
+	Função que avalia um teste contra as regras de alerta e retorna os
+	motivos encontrados: <campo>:<valor> para acao_recomendada e
+	result_class, e estimated_concentration_ppb:<valor>>=<limite> quando
+	a concentração atinge o limite da matriz do teste
+*/
+func (config *AlertConfig) reasons(record *TestRecord) []string {
+	var reasons []string
+
+	for _, acao := range config.AcoesRecomendadas {
+		if record.AcaoRecomendada == acao {
+			reasons = append(reasons, "acao_recomendada:"+acao)
+		}
+	}
+	for _, class := range config.ResultClasses {
+		if record.ResultClass == class {
+			reasons = append(reasons, "result_class:"+class)
+		}
+	}
+
+	limit, ok := config.ConcentrationLimitsPpb[record.MatrixType]
+	if !ok {
+		limit, ok = config.ConcentrationLimitsPpb[defaultMatrixLimit]
+	}
+	if ok && record.EstimatedConcentrationPpb >= limit {
+		reasons = append(reasons, fmt.Sprintf("estimated_concentration_ppb:%s>=%s",
+			strconv.FormatFloat(record.EstimatedConcentrationPpb, 'f', -1, 64),
+			strconv.FormatFloat(limit, 'f', -1, 64)))
+	}
+
+	return reasons
+}
+
+// Função que consulta as regras de alerta vigentes
+func (s *SmartContract) GetAlertConfig(ctx contractapi.TransactionContextInterface) (*AlertConfig, error) {
+	return getAlertConfig(ctx)
+}
+
+/*
+	Função que substitui as regras de alerta no ledger. Recebe um JSON com
+	acoes_recomendadas, result_classes e concentration_limits_ppb (por
+	matrix_type). Restrita a administradores; a versão, a data e a
+	identidade de quem alterou são controladas pelo ledger
+*/
+func (s *SmartContract) SetAlertConfig(ctx contractapi.TransactionContextInterface, configJSON string) error {
+	// Apenas administradores podem alterar as regras
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	var config AlertConfig
+	decoder := json.NewDecoder(strings.NewReader(configJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("regras de alerta invalidas: %v", err)
+	}
+	if err := validateAlertConfig(&config); err != nil {
+		return err
+	}
+
+	// Listas ausentes são gravadas vazias, desativando a regra
+	if config.AcoesRecomendadas == nil {
+		config.AcoesRecomendadas = []string{}
+	}
+	if config.ResultClasses == nil {
+		config.ResultClasses = []string{}
+	}
+	if config.ConcentrationLimitsPpb == nil {
+		config.ConcentrationLimitsPpb = map[string]float64{}
+	}
+
+	current, err := getAlertConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Obtém timestamp da transação atual
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	config.Version = current.Version + 1
+	config.UpdatedAt = time.Unix(
+		txTime.Seconds,
+		int64(txTime.Nanos),
+	).UTC().Format(time.RFC3339)
+	config.UpdatedByMSP = mspID
+	config.UpdatedBy = subject
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	key, err := alertConfigKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(key, configBytes); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventAlertConfigChanged, &ConfigEventData{Version: config.Version})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Retorna os dados do HazardAlert entre os eventos entregues, ou nil
+func hazardAlert(t *testing.T, events []map[string]interface{}) *HazardAlertEventData {
+	t.Helper()
+
+	for _, event := range events {
+		if event["type"] != EventHazardAlert {
+			continue
+		}
+		data, err := json.Marshal(event["data"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var alert HazardAlertEventData
+		if err := json.Unmarshal(data, &alert); err != nil {
+			t.Fatal(err)
+		}
+		return &alert
+	}
+	return nil
+}
+
+func TestHazardAlertFollowsAlertConfig(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("config")
+	for _, invalid := range []string{
+		`{"concentration_limits_ppb":{"agua":0}}`,
+		`{"result_classes":["positive","positive"]}`,
+		`{"limite":10}`,
+	} {
+		if err := contract.SetAlertConfig(ctx, invalid); err == nil {
+			t.Errorf("regras invalidas aceitas: %s", invalid)
+		}
+	}
+	if err := contract.SetAlertConfig(ctx, `{"concentration_limits_ppb":{"agua":30,"default":100}}`); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("config")
+
+	config, err := contract.GetAlertConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != 1 || len(config.ResultClasses) != 0 || config.AcoesRecomendadas == nil {
+		t.Errorf("regras inesperadas: %+v", config)
+	}
+
+	stub.MockTransactionStart("registro")
+	if err := contract.StoreTest(ctx, "TEST-1", fixture, ""); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("registro")
+
+	// A concentração da fixture (31.76 ppb em agua) atinge o limite da matriz
+	alert := hazardAlert(t, decodeEvents(t, lastEvent(t, stub)))
+	if alert == nil {
+		t.Fatal("HazardAlert nao emitido")
+	}
+	expected := []string{"estimated_concentration_ppb:31.76>=30"}
+	if alert.TestID != "TEST-1" || alert.MatrixType != "agua" || alert.ConfigVersion != 1 || !reflect.DeepEqual(alert.Reasons, expected) {
+		t.Errorf("alerta inesperado: %+v", alert)
+	}
+
+	// Apenas administradores alteram as regras
+	stub.Creator = newTestCreator(t, "org1MSP", "operador")
+	operator := newTestContext(t, stub)
+	stub.MockTransactionStart("operador")
+	defer stub.MockTransactionEnd("operador")
+	if err := contract.SetAlertConfig(operator, `{}`); err == nil || !strings.Contains(err.Error(), "administradores") {
+		t.Errorf("operador nao deveria alterar as regras, erro: %v", err)
+	}
+}
+
+func TestAlertReasons(t *testing.T) {
+	config := &AlertConfig{
+		AcoesRecomendadas:      []string{"bloquear_lote_e_confirmar_laboratorio"},
+		ResultClasses:          []string{"positive"},
+		ConcentrationLimitsPpb: map[string]float64{"agua": 10, defaultMatrixLimit: 50},
+	}
+
+	cases := []struct {
+		record   TestRecord
+		expected []string
+	}{
+		{TestRecord{MatrixType: "agua", ResultClass: "negative", EstimatedConcentrationPpb: 9.9}, nil},
+		{TestRecord{MatrixType: "agua", ResultClass: "positive", EstimatedConcentrationPpb: 10}, []string{"result_class:positive", "estimated_concentration_ppb:10>=10"}},
+		{TestRecord{MatrixType: "milho", AcaoRecomendada: "bloquear_lote_e_confirmar_laboratorio", EstimatedConcentrationPpb: 20}, []string{"acao_recomendada:bloquear_lote_e_confirmar_laboratorio"}},
+		{TestRecord{MatrixType: "milho", EstimatedConcentrationPpb: 50.5}, []string{"estimated_concentration_ppb:50.5>=50"}},
+	}
+
+	for i, c := range cases {
+		if reasons := config.reasons(&c.record); !reflect.DeepEqual(reasons, c.expected) {
+			t.Errorf("caso %d: motivos %v, esperado %v", i, reasons, c.expected)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Versão do formato dos eventos; muda apenas com alterações incompatíveis
+const eventSchemaVersion = 1
+
+// Tipos de evento emitidos pelo chaincode
+const (
+	EventTestStored              = "TestStored"
+	EventTestUpdated             = "TestUpdated"
+	EventTestRepredicted         = "TestRepredicted"
+	EventTestImageLinked         = "TestImageLinked"
+	EventPredictionFlagged       = "PredictionFlagged"
+	EventHazardAlert             = "HazardAlert"
+	EventModelRegistered         = "ModelRegistered"
+	EventModelPromoted           = "ModelPromoted"
+	EventPlanilhaAnchored        = "PlanilhaAnchored"
+	EventLoteStatusChanged       = "LoteStatusChanged"
+	EventPredictionConfigChanged = "PredictionConfigChanged"
+	EventAlertConfigChanged      = "AlertConfigChanged"
+	EventStateKeysMigrated       = "StateKeysMigrated"
+)
+
+/*
+	O Fabric entrega apenas um evento por transação (o último SetEvent).
+	Quando uma transação gera mais de um, eles são emitidos juntos com
+	este nome, em um EventBatch
+*/
+const eventBatchName = "SollytchEvents"
+
+// Predições que sinalizam o teste para revisão (variável-alvo -> valores)
+var flaggedPredictions = map[string]map[string]bool{
+	"qc_status":        {"fail": true, "warn": true},
+	"result_class":     {"invalid": true},
+	"acao_recomendada": {"bloquear_lote_e_confirmar_laboratorio": true},
+}
+
+/*
+	struct json de um evento do chaincode. Os eventos levam apenas os
+	identificadores necessários para o consumidor buscar o registro;
+	nenhum dado do teste ou conteúdo de arquivo é incluído
+*/
+type ChaincodeEvent struct {
+	Type      string      `json:"type"`
+	Version   int         `json:"version"`
+	TxID      string      `json:"tx_id"`
+	Timestamp string      `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// eventos emitidos juntos por uma mesma transação, na ordem em que ocorreram
+type EventBatch struct {
+	Version int               `json:"version"`
+	Events  []*ChaincodeEvent `json:"events"`
+}
+
+// dados dos eventos de teste (TestStored, TestUpdated, TestRepredicted)
+type TestEventData struct {
+	TestID      string `json:"test_id"`
+	CassetteLot string `json:"cassette_lot"`
+	Version     int    `json:"version"`
+}
+
+// dados do evento TestImageLinked
+type TestImageEventData struct {
+	TestID     string `json:"test_id"`
+	HashImagem string `json:"hash_imagem"`
+	Version    int    `json:"version"`
+}
+
+// dados do evento PredictionFlagged: cada flag no formato <variável>:<valor>
+type PredictionFlaggedEventData struct {
+	TestID      string   `json:"test_id"`
+	CassetteLot string   `json:"cassette_lot"`
+	Version     int      `json:"version"`
+	Flags       []string `json:"flags"`
+}
+
+// dados do evento HazardAlert: motivos encontrados pelas regras de alerta (AlertConfig)
+type HazardAlertEventData struct {
+	TestID        string   `json:"test_id"`
+	CassetteLot   string   `json:"cassette_lot"`
+	MatrixType    string   `json:"matrix_type"`
+	Version       int      `json:"version"`
+	Reasons       []string `json:"reasons"`
+	ConfigVersion int      `json:"config_version"`
+}
+
+// dados dos eventos de modelo (ModelRegistered, ModelPromoted)
+type ModelEventData struct {
+	ModelKey    string `json:"model_key"`
+	Version     int    `json:"version"`
+	ContentHash string `json:"content_hash"`
+}
+
+// dados do evento PlanilhaAnchored
+type PlanilhaEventData struct {
+	CasseteLot    string `json:"cassete_lot"`
+	HashPlanilha  string `json:"hash_planilha"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	Version       int    `json:"version"`
+}
+
+// dados do evento LoteStatusChanged
+type LoteStatusEventData struct {
+	CasseteLot string `json:"cassete_lot"`
+	Status     string `json:"status"`
+	Version    int    `json:"version"`
+}
+
+// dados dos eventos de configuração (PredictionConfigChanged, AlertConfigChanged)
+type ConfigEventData struct {
+	Version int `json:"version"`
+}
+
+// dados do evento StateKeysMigrated
+type StateKeysMigratedEventData struct {
+	Tests     int  `json:"tests"`
+	Planilhas int  `json:"planilhas"`
+	Models    int  `json:"models"`
+	Done      bool `json:"done"`
+}
+
+/*
+	Contexto de transação que acumula os eventos emitidos, para que todos
+	cheguem ao consumidor mesmo quando a transação gera mais de um.
+	Os eventos são associados ao txID, então um contexto reaproveitado
+	entre transações começa sempre vazio
+*/
+type eventContext struct {
+	contractapi.TransactionContext
+	txID   string
+	events []*ChaincodeEvent
+}
+
+// Acumula um evento da transação e retorna todos os emitidos até agora
+func (ctx *eventContext) collectEvent(txID string, event *ChaincodeEvent) []*ChaincodeEvent {
+	if ctx.txID != txID {
+		ctx.txID = txID
+		ctx.events = nil
+	}
+	ctx.events = append(ctx.events, event)
+	return ctx.events
+}
+
+// contexto capaz de acumular os eventos da transação
+type eventCollector interface {
+	collectEvent(txID string, event *ChaincodeEvent) []*ChaincodeEvent
+}
+
+/*
+	Função que emite um evento tipado. Com um único evento na transação
+	o nome do evento é o seu tipo; a partir do segundo, todos são
+	reemitidos juntos sob o nome SollytchEvents
+*/
+func emitEvent(ctx contractapi.TransactionContextInterface, eventType string, data interface{}) error {
+	stub := ctx.GetStub()
+
+	txTime, err := stub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	event := &ChaincodeEvent{
+		Type:    eventType,
+		Version: eventSchemaVersion,
+		TxID:    stub.GetTxID(),
+		Timestamp: time.Unix(
+			txTime.Seconds,
+			int64(txTime.Nanos),
+		).UTC().Format(time.RFC3339),
+		Data: data,
+	}
+
+	events := []*ChaincodeEvent{event}
+	if collector, ok := ctx.(eventCollector); ok {
+		events = collector.collectEvent(event.TxID, event)
+	}
+
+	name := eventType
+	var payload []byte
+	if len(events) == 1 {
+		payload, err = json.Marshal(event)
+	} else {
+		name = eventBatchName
+		payload, err = json.Marshal(EventBatch{Version: eventSchemaVersion, Events: events})
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao serializar evento %s: %v", eventType, err)
+	}
+
+	return stub.SetEvent(name, payload)
+}
+
+/*
+	Função que emite um evento de teste. Testes que passaram por predição
+	nesta transação geram também PredictionFlagged, se alguma predição
+	sinalizar o teste, e HazardAlert, se as regras de alerta forem atingidas
+*/
+func emitTestEvent(ctx contractapi.TransactionContextInterface, eventType string, record *TestRecord) error {
+	err := emitEvent(ctx, eventType, &TestEventData{
+		TestID:      record.TestID,
+		CassetteLot: record.CassetteLot,
+		Version:     record.Version,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Apenas testes que passaram por predição nesta transação são avaliados
+	if eventType == EventTestUpdated {
+		return nil
+	}
+
+	if flags := predictionFlags(record); len(flags) > 0 {
+		err := emitEvent(ctx, EventPredictionFlagged, &PredictionFlaggedEventData{
+			TestID:      record.TestID,
+			CassetteLot: record.CassetteLot,
+			Version:     record.Version,
+			Flags:       flags,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := getAlertConfig(ctx)
+	if err != nil {
+		return err
+	}
+	reasons := config.reasons(record)
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	return emitEvent(ctx, EventHazardAlert, &HazardAlertEventData{
+		TestID:        record.TestID,
+		CassetteLot:   record.CassetteLot,
+		MatrixType:    record.MatrixType,
+		Version:       record.Version,
+		Reasons:       reasons,
+		ConfigVersion: config.Version,
+	})
+}
+
+// Lista as predições do teste que o sinalizam, em ordem alfabética
+func predictionFlags(record *TestRecord) []string {
+	var flags []string
+	for target, prediction := range record.Predictions {
+		if flaggedPredictions[target][prediction.Prediction] {
+			flags = append(flags, target+":"+prediction.Prediction)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Retorna o último evento emitido, que é o entregue pelo Fabric, descartando os demais
+func lastEvent(t *testing.T, stub *shimtest.MockStub) *peer.ChaincodeEvent {
+	t.Helper()
+
+	var last *peer.ChaincodeEvent
+	for {
+		select {
+		case event := <-stub.ChaincodeEventsChannel:
+			last = event
+		default:
+			if last == nil {
+				t.Fatal("nenhum evento emitido")
+			}
+			return last
+		}
+	}
+}
+
+// Desserializa o evento entregue, seja ele único ou um lote
+func decodeEvents(t *testing.T, event *peer.ChaincodeEvent) []map[string]interface{} {
+	t.Helper()
+
+	if event.EventName != eventBatchName {
+		var single map[string]interface{}
+		if err := json.Unmarshal(event.Payload, &single); err != nil {
+			t.Fatal(err)
+		}
+		if single["type"] != event.EventName {
+			t.Errorf("evento %s com tipo %v", event.EventName, single["type"])
+		}
+		return []map[string]interface{}{single}
+	}
+
+	var batch struct {
+		Version int                      `json:"version"`
+		Events  []map[string]interface{} `json:"events"`
+	}
+	if err := json.Unmarshal(event.Payload, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch.Version != eventSchemaVersion {
+		t.Errorf("versao do lote inesperada: %d", batch.Version)
+	}
+	return batch.Events
+}
+
+func TestStateChangesEmitEvents(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	// Cada StoreModel do setup registra e promove um modelo, todos na mesma transação
+	setup := decodeEvents(t, lastEvent(t, stub))
+	if len(setup) != 6 {
+		t.Fatalf("eventos do setup inesperados: %v", setup)
+	}
+	for i, event := range setup {
+		expected := EventModelRegistered
+		if i%2 == 1 {
+			expected = EventModelPromoted
+		}
+		if event["type"] != expected || event["tx_id"] != "setup" {
+			t.Errorf("evento %d do setup inesperado: %v", i, event)
+		}
+	}
+
+	digest := sha512.Sum512([]byte("planilha do lote"))
+	hash := hex.EncodeToString(digest[:])
+
+	stub.MockTransactionStart("planilha")
+	if err := contract.StorePlanilha(ctx, "C22009", hash, `{"file_name":"lote.xlsx"}`); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("planilha")
+
+	event := lastEvent(t, stub)
+	if event.EventName != EventPlanilhaAnchored {
+		t.Fatalf("evento inesperado: %s", event.EventName)
+	}
+	planilha := decodeEvents(t, event)[0]
+	if planilha["tx_id"] != "planilha" || planilha["version"] != float64(eventSchemaVersion) {
+		t.Errorf("envelope inesperado: %v", planilha)
+	}
+	expected := map[string]interface{}{"cassete_lot": "C22009", "hash_planilha": hash, "hash_algorithm": "sha512", "version": float64(0)}
+	if !reflect.DeepEqual(planilha["data"], expected) {
+		t.Errorf("dados inesperados: %v", planilha["data"])
+	}
+
+	stub.MockTransactionStart("registro")
+	if err := contract.StoreTest(ctx, "TEST-1", fixture, ""); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("registro")
+
+	stored := decodeEvents(t, lastEvent(t, stub))
+	if stored[0]["type"] != EventTestStored || stored[0]["tx_id"] != "registro" {
+		t.Errorf("evento do StoreTest inesperado: %v", stored[0])
+	}
+	record, err := contract.GetTestByID(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[interface{}]bool{}
+	for _, event := range stored {
+		types[event["type"]] = true
+	}
+	if flags := predictionFlags(record); types[EventPredictionFlagged] != (len(flags) > 0) {
+		t.Errorf("predicoes sinalizadas %v, eventos: %v", flags, stored)
+	}
+	if reasons := defaultAlertConfig().reasons(record); types[EventHazardAlert] != (len(reasons) > 0) {
+		t.Errorf("motivos de alerta %v, eventos: %v", reasons, stored)
+	}
+
+	// Uma nova transação começa sem os eventos da anterior
+	stub.MockTransactionStart("atualizacao")
+	if err := contract.UpdateTest(ctx, "TEST-1", fixture); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("atualizacao")
+
+	updated := decodeEvents(t, lastEvent(t, stub))
+	if len(updated) != 1 || updated[0]["type"] != EventTestUpdated {
+		t.Errorf("eventos do UpdateTest inesperados: %v", updated)
+	}
+	data := updated[0]["data"].(map[string]interface{})
+	if len(data) != 3 || data["test_id"] != "TEST-1" || data["version"] != float64(1) {
+		t.Errorf("dados do teste inesperados: %v", data)
+	}
+}
+
+func TestPredictionFlags(t *testing.T) {
+	record := &TestRecord{Predictions: map[string]PredictionMetadata{
+		"qc_status":        {Prediction: "fail"},
+		"result_class":     {Prediction: "positive"},
+		"acao_recomendada": {Prediction: "bloquear_lote_e_confirmar_laboratorio"},
+	}}
+
+	flags := predictionFlags(record)
+	expected := []string{"acao_recomendada:bloquear_lote_e_confirmar_laboratorio", "qc_status:fail"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Errorf("flags inesperadas: %v", flags)
+	}
+}
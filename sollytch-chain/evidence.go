@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+	Nome do chaincode de imagens no mesmo canal. Fixo no código, e não lido
+	do ambiente do peer, para que todos os peers consultem o mesmo chaincode
+	e produzam o mesmo endosso
+*/
+const imageChaincode = "sollytch-image"
+
+// struct json de uma imagem ancorada no chaincode sollytch-image
+// (campos do ImageAsset daquele chaincode usados aqui)
+type ImageAnchor struct {
+	Version       int    `json:"version"`
+	LastUpdatedAt string `json:"lastUpdatedAt"`
+	Timestamp     string `json:"timestamp"`
+	IDKit         string `json:"idKit"`
+	HashData      string `json:"hashData"`
+	HashAlgorithm string `json:"hashAlgorithm"`
+	HashEncoding  string `json:"hashEncoding"`
+	FileSize      int64  `json:"fileSize"`
+	MimeType      string `json:"mimeType"`
+	FileName      string `json:"fileName"`
+	TestID        string `json:"testId"`
+	FrameRole     string `json:"frameRole"`
+	CaptureTime   string `json:"captureTime"`
+	Revoked       bool   `json:"revoked"`
+	ChangeReason  string `json:"changeReason,omitempty" metadata:",optional"`
+}
+
+// imagem vinculada a um teste, com o registro encontrado no sollytch-image
+type ImageEvidence struct {
+	HashImagem string       `json:"hash_imagem"`
+	Anchor     *ImageAnchor `json:"anchor,omitempty" metadata:",optional"`
+	Error      string       `json:"error,omitempty" metadata:",optional"`
+}
+
+// struct json de um teste acompanhado das suas evidências
+type TestEvidence struct {
+	Test      *TestRecord      `json:"test"`
+	Images    []*ImageEvidence `json:"images"`
+	Planilhas []*LoteRecord    `json:"planilhas"`
+}
+
+/*
+	Função que consulta uma imagem no chaincode sollytch-image por meio de
+	uma chamada entre chaincodes (InvokeChaincode) à função GetImageByID,
+	no mesmo canal. Retorna erro se a imagem não estiver ancorada.
+	Imagens revogadas são retornadas com revoked=true
+*/
+func getImageAnchor(ctx contractapi.TransactionContextInterface, hashImagem string) (*ImageAnchor, error) {
+	response := ctx.GetStub().InvokeChaincode(
+		imageChaincode,
+		[][]byte{[]byte("GetImageByID"), []byte(hashImagem)},
+		"",
+	)
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("imagem %s nao encontrada em %s: %s", hashImagem, imageChaincode, response.Message)
+	}
+
+	var anchor ImageAnchor
+	if err := json.Unmarshal(response.Payload, &anchor); err != nil {
+		return nil, fmt.Errorf("resposta invalida de %s: %v", imageChaincode, err)
+	}
+
+	return &anchor, nil
+}
+
+// Confere se uma imagem pode ser vinculada ao teste: não revogada e,
+// quando capturada para um teste, capturada para este
+func checkImageForTest(anchor *ImageAnchor, testID string) error {
+	if anchor.Revoked {
+		return fmt.Errorf("imagem %s revogada: %s", anchor.HashData, anchor.ChangeReason)
+	}
+	if anchor.TestID != "" && anchor.TestID != testID {
+		return fmt.Errorf("imagem %s capturada para o teste %s", anchor.HashData, anchor.TestID)
+	}
+	return nil
+}
+
+/*
+	Função que confere as imagens informadas em um teste. Cada hash deve
+	existir no sollytch-image, sem ter sido revogado nem capturado para
+	outro teste, e é gravado na forma canônica devolvida por aquele
+	chaincode; hashes repetidos são descartados
+*/
+func verifyTestImages(ctx contractapi.TransactionContextInterface, record *TestRecord) error {
+	if len(record.ImageHashes) == 0 {
+		return nil
+	}
+
+	hashes := make([]string, 0, len(record.ImageHashes))
+	seen := map[string]bool{}
+	for _, hashImagem := range record.ImageHashes {
+		anchor, err := getImageAnchor(ctx, hashImagem)
+		if err != nil {
+			return err
+		}
+		if err := checkImageForTest(anchor, record.TestID); err != nil {
+			return err
+		}
+		if seen[anchor.HashData] {
+			continue
+		}
+		seen[anchor.HashData] = true
+		hashes = append(hashes, anchor.HashData)
+	}
+
+	record.ImageHashes = hashes
+	return nil
+}
+
+/*
+	Função que vincula uma imagem já ancorada no sollytch-image a um teste.
+	A existência da imagem é conferida por InvokeChaincode e o vínculo gera
+	uma nova versão do teste, com a identidade de quem o registrou
+*/
+func (s *SmartContract) LinkTestImage(ctx contractapi.TransactionContextInterface, testID string, hashImagem string) error {
+	if testID == "" || hashImagem == "" {
+		return fmt.Errorf("testID e hashImagem são obrigatórios")
+	}
+
+	data, foundKey, err := getTestState(ctx, testID)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("teste %s não encontrado", testID)
+	}
+
+	var record TestRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+
+	anchor, err := getImageAnchor(ctx, hashImagem)
+	if err != nil {
+		return err
+	}
+	if err := checkImageForTest(anchor, testID); err != nil {
+		return err
+	}
+	for _, linked := range record.ImageHashes {
+		if linked == anchor.HashData {
+			return fmt.Errorf("imagem %s ja vinculada ao teste %s", anchor.HashData, testID)
+		}
+	}
+
+	// Obtém timestamp da transação atual
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	// Identifica quem vinculou a imagem
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	record.ImageHashes = append(record.ImageHashes, anchor.HashData)
+	record.Version++
+	record.LastUpdatedAt = time.Unix(
+		txTime.Seconds,
+		int64(txTime.Nanos),
+	).UTC().Format(time.RFC3339)
+	record.LastUpdatedByMSP = mspID
+	record.LastUpdatedBy = subject
+
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := putStateMigrating(ctx, testStateKey(testID), foundKey, bytes); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventTestImageLinked, &TestImageEventData{
+		TestID:     testID,
+		HashImagem: anchor.HashData,
+		Version:    record.Version,
+	})
+}
+
+/*
+	Função que retorna um teste junto com as suas evidências: as imagens
+	vinculadas, consultadas no sollytch-image, e as planilhas ancoradas
+	para o lote do cassete. Imagens que não puderem ser consultadas são
+	retornadas com o erro correspondente, sem impedir a consulta
+*/
+func (s *SmartContract) GetTestWithEvidence(ctx contractapi.TransactionContextInterface, testID string) (*TestEvidence, error) {
+	test, err := s.GetTestByID(ctx, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	evidence := &TestEvidence{
+		Test:      test,
+		Images:    []*ImageEvidence{},
+		Planilhas: []*LoteRecord{},
+	}
+
+	for _, hashImagem := range test.ImageHashes {
+		image := &ImageEvidence{HashImagem: hashImagem}
+		if anchor, err := getImageAnchor(ctx, hashImagem); err != nil {
+			image.Error = err.Error()
+		} else {
+			image.Anchor = anchor
+		}
+		evidence.Images = append(evidence.Images, image)
+	}
+
+	planilhas, err := s.GetPlanilhasByLote(ctx, test.CassetteLot)
+	if err != nil {
+		return nil, err
+	}
+	evidence.Planilhas = append(evidence.Planilhas, planilhas...)
+
+	return evidence, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Chaincode de imagens simulado: responde GetImageByID a partir de um mapa
+type fakeImageChaincode struct {
+	images map[string]*ImageAnchor
+}
+
+func (f *fakeImageChaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+func (f *fakeImageChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function != "GetImageByID" || len(args) != 1 {
+		return shim.Error("funcao desconhecida")
+	}
+
+	image, ok := f.images[strings.ToLower(args[0])]
+	if !ok {
+		return shim.Error("imagem " + args[0] + " não encontrada")
+	}
+
+	payload, err := json.Marshal(image)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(payload)
+}
+
+func TestLinkTestImageAndEvidence(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	digest := sha512.Sum512([]byte("imagem do cassete"))
+	imageHash := hex.EncodeToString(digest[:])
+	revokedDigest := sha512.Sum512([]byte("imagem revogada"))
+	revokedHash := hex.EncodeToString(revokedDigest[:])
+	otherDigest := sha512.Sum512([]byte("imagem de outro teste"))
+	otherHash := hex.EncodeToString(otherDigest[:])
+	images := &fakeImageChaincode{images: map[string]*ImageAnchor{
+		imageHash:   {IDKit: "KIT-1", HashData: imageHash, HashAlgorithm: "sha512", HashEncoding: "hex"},
+		revokedHash: {IDKit: "KIT-1", HashData: revokedHash, Revoked: true, ChangeReason: "kit errado"},
+		otherHash:   {IDKit: "KIT-1", HashData: otherHash, TestID: "TEST-2"},
+	}}
+	stub.MockPeerChaincode(imageChaincode, shimtest.NewMockStub(imageChaincode, images), "")
+
+	stub.MockTransactionStart("evidencia")
+	defer stub.MockTransactionEnd("evidencia")
+
+	planilhaDigest := sha512.Sum512([]byte("planilha do lote"))
+	if err := contract.StorePlanilha(ctx, "C22009", hex.EncodeToString(planilhaDigest[:]), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := contract.StoreTest(ctx, "TEST-1", fixture, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Imagens que não estão ancoradas no sollytch-image são recusadas
+	missing := sha512.Sum512([]byte("outra imagem"))
+	if err := contract.LinkTestImage(ctx, "TEST-1", hex.EncodeToString(missing[:])); err == nil {
+		t.Error("imagem inexistente nao deveria ser vinculada")
+	}
+
+	if err := contract.LinkTestImage(ctx, "TEST-1", revokedHash); err == nil || !strings.Contains(err.Error(), "revogada") {
+		t.Errorf("imagem revogada nao deveria ser vinculada, erro: %v", err)
+	}
+	if err := contract.LinkTestImage(ctx, "TEST-1", otherHash); err == nil || !strings.Contains(err.Error(), "TEST-2") {
+		t.Errorf("imagem de outro teste nao deveria ser vinculada, erro: %v", err)
+	}
+
+	if err := contract.LinkTestImage(ctx, "TEST-1", strings.ToUpper(imageHash)); err != nil {
+		t.Fatal(err)
+	}
+	if err := contract.LinkTestImage(ctx, "TEST-1", imageHash); err == nil || !strings.Contains(err.Error(), "ja vinculada") {
+		t.Errorf("vinculo repetido deveria ser recusado, erro: %v", err)
+	}
+
+	evidence, err := contract.GetTestWithEvidence(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evidence.Test.Version != 1 || len(evidence.Test.ImageHashes) != 1 || evidence.Test.ImageHashes[0] != imageHash {
+		t.Errorf("teste inesperado: version=%d images=%v", evidence.Test.Version, evidence.Test.ImageHashes)
+	}
+	if len(evidence.Images) != 1 || evidence.Images[0].Anchor == nil || evidence.Images[0].Anchor.IDKit != "KIT-1" {
+		t.Errorf("imagens inesperadas: %+v", evidence.Images)
+	}
+	if len(evidence.Planilhas) != 1 || evidence.Planilhas[0].CasseteLot != "C22009" {
+		t.Errorf("planilhas inesperadas: %+v", evidence.Planilhas)
+	}
+
+	// Uma atualização sem image_hashes mantém o vínculo
+	if err := contract.UpdateTest(ctx, "TEST-1", fixture); err != nil {
+		t.Fatal(err)
+	}
+	record, err := contract.GetTestByID(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.ImageHashes) != 1 {
+		t.Errorf("vinculo com a imagem perdido na atualizacao: %v", record.ImageHashes)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Codificação de controle_interno_result usada no treino dos modelos
+// (valores desconhecidos são codificados como 0)
+var controleInternoEncoder = map[string]int{
+	"ok":      2,
+	"fail":    1,
+	"invalid": 0,
+}
+
+// Codificações das colunas categóricas aceitas como features
+var featureEncoders = map[string]map[string]int{
+	"controle_interno_result": controleInternoEncoder,
+}
+
+// Formata um número para a linha CSV sem notação exponencial
+func formatFeature(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Codifica um booleano como 1 (true) ou 0 (false)
+func encodeBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+// Mapeia o nome json de cada campo do TestRecord para o seu índice na struct
+func testRecordFieldIndexes() map[string]int {
+	indexes := map[string]int{}
+	recordType := reflect.TypeOf(TestRecord{})
+
+	for i := 0; i < recordType.NumField(); i++ {
+		name := strings.Split(recordType.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		indexes[name] = i
+	}
+
+	return indexes
+}
+
+/*
+	Função que codifica o valor de uma coluna de features a partir do campo
+	de mesmo nome json do teste. Booleanos são codificados como 1/0,
+	campos categóricos segundo featureEncoders e números sem notação
+	exponencial (image_blur_score nulo já é desserializado como 0)
+*/
+func encodeFeature(record *TestRecord, fieldIndexes map[string]int, column string) (string, error) {
+	index, ok := fieldIndexes[column]
+	if !ok {
+		return "", fmt.Errorf("coluna %s nao existe no teste", column)
+	}
+	value := reflect.ValueOf(record).Elem().Field(index)
+
+	if encoder, ok := featureEncoders[column]; ok {
+		return strconv.Itoa(encoder[value.String()]), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		return encodeBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return formatFeature(value.Float()), nil
+	}
+
+	return "", fmt.Errorf("coluna %s nao e numerica, booleana ou categorica codificada", column)
+}
+
+/*
+	Função que monta a linha CSV de predição a partir dos campos do teste,
+	na ordem de colunas do cabeçalho informado (baseHeader ou o cabeçalho
+	configurado para a variável-alvo), reproduzindo o pré-processamento do treino
+*/
+func buildFeatureRow(record *TestRecord, header string) (string, error) {
+	fieldIndexes := testRecordFieldIndexes()
+	columns := strings.Split(header, ",")
+	features := make([]string, 0, len(columns))
+
+	for _, column := range columns {
+		feature, err := encodeFeature(record, fieldIndexes, column)
+		if err != nil {
+			return "", err
+		}
+		features = append(features, feature)
+	}
+
+	return strings.Join(features, ","), nil
+}
+
+/*
+	Função que confere a linha CSV enviada pelo cliente (predictStr) contra a
+	linha derivada do JSON do teste. Os valores são comparados numericamente,
+	coluna a coluna, e todas as divergências são listadas no erro
+*/
+func checkFeatureRow(predictStr string, derivedRow string) error {
+	columns := strings.Split(baseHeader, ",")
+	received := strings.Split(strings.TrimSpace(predictStr), ",")
+	derived := strings.Split(derivedRow, ",")
+
+	if len(received) != len(columns) {
+		return fmt.Errorf("predictStr deve conter %d colunas, recebidas %d", len(columns), len(received))
+	}
+
+	var mismatches []string
+	for i, column := range columns {
+		expected, _ := strconv.ParseFloat(derived[i], 64)
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(received[i]), 64)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s (valor nao numerico %q)", column, received[i]))
+			continue
+		}
+
+		tolerance := 1e-9 * math.Max(1, math.Max(math.Abs(expected), math.Abs(value)))
+		if math.Abs(expected-value) > tolerance {
+			mismatches = append(mismatches, fmt.Sprintf("%s (json=%s, predictStr=%s)", column, derived[i], received[i]))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("predictStr diverge do JSON do teste: %s", strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildFeatureRowFromFixture(t *testing.T) {
+	record, err := decodeTestRecord(readTestFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := buildFeatureRow(record, baseHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row != fixtureFeatureRow {
+		t.Errorf("linha derivada %s, esperada %s", row, fixtureFeatureRow)
+	}
+
+	if _, err := buildFeatureRow(record, "lat,operator_id"); err == nil {
+		t.Error("coluna textual deveria ser rejeitada")
+	}
+	if _, err := buildFeatureRow(record, "lat,coluna_inexistente"); err == nil {
+		t.Error("coluna inexistente deveria ser rejeitada")
+	}
+}
+
+func TestCheckFeatureRow(t *testing.T) {
+	columns := strings.Split(fixtureFeatureRow, ",")
+	withColumn := func(index int, value string) string {
+		row := append([]string{}, columns...)
+		row[index] = value
+		return strings.Join(row, ",")
+	}
+
+	accepted := []string{
+		fixtureFeatureRow,
+		" " + fixtureFeatureRow + "\n",
+		// Representações equivalentes e diferenças abaixo da tolerância relativa
+		withColumn(2, "42.0"),
+		withColumn(3, "2.487e1"),
+		withColumn(4, "466.30000000001"),
+	}
+	for _, row := range accepted {
+		if err := checkFeatureRow(row, fixtureFeatureRow); err != nil {
+			t.Errorf("linha %q deveria ser aceita: %v", row, err)
+		}
+	}
+
+	rejected := []struct{ row, message string }{
+		{"1,2,3", "deve conter 21 colunas"},
+		{withColumn(0, "-22.8749"), "lat (json=-22.87496, predictStr=-22.8749)"},
+		{withColumn(19, "sim"), `control_line_ok (valor nao numerico "sim")`},
+		{withColumn(4, "466.31"), "time_to_migrate_s"},
+	}
+	for _, c := range rejected {
+		err := checkFeatureRow(c.row, fixtureFeatureRow)
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("linha %q: erro %v, esperado contendo %q", c.row, err, c.message)
+		}
+	}
+
+	// Todas as divergências são listadas
+	err := checkFeatureRow(withColumn(1, "0"), withColumn(0, "0"))
+	if err == nil || !strings.Contains(err.Error(), "lat (") || !strings.Contains(err.Error(), "lon (") {
+		t.Errorf("erro deveria listar lat e lon: %v", err)
+	}
+}
@@ -2,7 +2,12 @@ module github.com/hyperledger/fabric-samples/chaincode/sollytch-chain
 
 go 1.21
 
-require github.com/sjwhitworth/golearn v0.0.0-20221228163002-74ae077eafb2
+require (
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20230731094759-d626e9ab09b9
+	github.com/hyperledger/fabric-protos-go v0.3.0
+	github.com/sjwhitworth/golearn v0.0.0-20221228163002-74ae077eafb2
+	google.golang.org/protobuf v1.31.0
+)
 
 require (
 	cloud.google.com/go v0.110.8 // indirect
@@ -15,8 +20,6 @@ require (
 	github.com/gobuffalo/packr v1.30.1 // indirect
 	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/guptarohit/asciigraph v0.5.1 // indirect
-	github.com/hyperledger/fabric-chaincode-go v0.0.0-20230731094759-d626e9ab09b9 // indirect
-	github.com/hyperledger/fabric-protos-go v0.3.0 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
@@ -32,12 +35,11 @@ require (
 	golang.org/x/sync v0.3.0 // indirect
 	gonum.org/v1/gonum v0.8.1 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231030173426-d783a09b4405 // indirect
-	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
-	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/golang/protobuf v1.5.3
 	github.com/hyperledger/fabric-contract-api-go v1.2.2
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.14.0 // indirect
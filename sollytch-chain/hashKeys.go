@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Tamanho em bytes do digest de cada algoritmo de hash aceito
+var hashAlgorithmSizes = map[string]int{
+	"sha1":   20,
+	"sha256": 32,
+	"sha384": 48,
+	"sha512": 64,
+}
+
+// Algoritmo e codificação usados pelos clientes quando não declarados
+const (
+	defaultHashAlgorithm = "sha512"
+	defaultHashEncoding  = "hex"
+)
+
+// Namespace das chaves principais das planilhas
+const planilhaNamespace = "planilha"
+
+// metadados do hash e do arquivo de origem informados na gravação
+type FileMetadata struct {
+	Algorithm string `json:"algorithm"`
+	Encoding  string `json:"encoding"`
+	FileSize  int64  `json:"file_size"`
+	MimeType  string `json:"mime_type"`
+	FileName  string `json:"file_name"`
+}
+
+/*
+	Função que desserializa e valida os metadados do arquivo.
+	Algoritmo e codificação ausentes assumem sha512 e hex,
+	o padrão usado pelos clientes ao calcular os hashes
+*/
+func parseFileMetadata(metadataJSON string) (*FileMetadata, error) {
+	metadata := &FileMetadata{}
+	if metadataJSON != "" {
+		decoder := json.NewDecoder(strings.NewReader(metadataJSON))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(metadata); err != nil {
+			return nil, fmt.Errorf("metadados do arquivo invalidos: %v", err)
+		}
+	}
+
+	metadata.Algorithm = strings.ToLower(metadata.Algorithm)
+	if metadata.Algorithm == "" {
+		metadata.Algorithm = defaultHashAlgorithm
+	}
+	if _, ok := hashAlgorithmSizes[metadata.Algorithm]; !ok {
+		return nil, fmt.Errorf("algoritmo de hash %q nao suportado, esperado um de: %s", metadata.Algorithm, strings.Join(sortedKeys(hashAlgorithmSizes), ", "))
+	}
+
+	metadata.Encoding = strings.ToLower(metadata.Encoding)
+	if metadata.Encoding == "" {
+		metadata.Encoding = defaultHashEncoding
+	}
+	if metadata.Encoding != "hex" && metadata.Encoding != "base64" {
+		return nil, fmt.Errorf("codificacao de hash %q nao suportada, esperado hex ou base64", metadata.Encoding)
+	}
+
+	if metadata.FileSize < 0 {
+		return nil, fmt.Errorf("file_size nao pode ser negativo")
+	}
+
+	return metadata, nil
+}
+
+/*
+	Função que valida um hash contra o algoritmo e a codificação declarados
+	(tamanho e alfabeto) e retorna a sua forma canônica: hex minúsculo
+*/
+func canonicalHash(hashValue string, algorithm string, encoding string) (string, error) {
+	var digest []byte
+	var err error
+
+	switch encoding {
+	case "hex":
+		digest, err = hex.DecodeString(strings.ToLower(hashValue))
+	case "base64":
+		digest, err = base64.StdEncoding.DecodeString(hashValue)
+	default:
+		return "", fmt.Errorf("codificacao de hash %q nao suportada", encoding)
+	}
+	if err != nil {
+		return "", fmt.Errorf("hash %s nao esta em %s valido", hashValue, encoding)
+	}
+
+	if len(digest) != hashAlgorithmSizes[algorithm] {
+		return "", fmt.Errorf("hash %s nao corresponde ao algoritmo %s (%d bytes, esperado %d)", hashValue, algorithm, len(digest), hashAlgorithmSizes[algorithm])
+	}
+
+	return hex.EncodeToString(digest), nil
+}
+
+// Monta a chave principal com namespace, ex.: "planilha:sha256:<hex>"
+func namespacedHashKey(namespace string, algorithm string, canonical string) string {
+	return namespace + ":" + algorithm + ":" + canonical
+}
+
+/*
+	Função que resolve a chave principal a partir de um hash informado em
+	uma consulta. O algoritmo é identificado pelo tamanho do digest;
+	o hash pode estar em hex ou em base64
+*/
+func resolveHashKey(namespace string, hashValue string) (string, error) {
+	var digest []byte
+	if decoded, err := hex.DecodeString(strings.ToLower(hashValue)); err == nil {
+		digest = decoded
+	} else if decoded, err := base64.StdEncoding.DecodeString(hashValue); err == nil {
+		digest = decoded
+	} else {
+		return "", fmt.Errorf("hash %s nao esta em hex nem em base64", hashValue)
+	}
+
+	for algorithm, size := range hashAlgorithmSizes {
+		if len(digest) == size {
+			return namespacedHashKey(namespace, algorithm, hex.EncodeToString(digest)), nil
+		}
+	}
+
+	return "", fmt.Errorf("hash %s nao corresponde a nenhum algoritmo suportado", hashValue)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestStorePlanilhaNamespacedKey(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	digest := sha256.Sum256([]byte("planilha de teste"))
+	hexHash := hex.EncodeToString(digest[:])
+	b64Hash := base64.StdEncoding.EncodeToString(digest[:])
+
+	stub.MockTransactionStart("planilha")
+	metadata := `{"algorithm":"sha256","encoding":"base64","file_size":2048,"mime_type":"text/csv","file_name":"lote.csv"}`
+	if err := contract.StorePlanilha(ctx, "C22009", b64Hash, metadata); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("planilha")
+
+	// O registro fica sob a chave com namespace, nunca sob o hash puro
+	if data, _ := stub.GetState("planilha:sha256:" + hexHash); data == nil {
+		t.Fatal("planilha nao gravada sob a chave com namespace")
+	}
+	if data, _ := stub.GetState(hexHash); data != nil {
+		t.Error("planilha nao deveria ser gravada sob o hash puro")
+	}
+
+	// A consulta aceita o hash em hex ou em base64
+	for _, hashValue := range []string{hexHash, b64Hash} {
+		record, err := contract.GetPlanilhaByHash(ctx, hashValue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.HashPlanilha != hexHash || record.HashAlgorithm != "sha256" || record.HashEncoding != "base64" ||
+			record.FileSize != 2048 || record.MimeType != "text/csv" || record.FileName != "lote.csv" {
+			t.Errorf("registro inesperado: %+v", record)
+		}
+	}
+
+	planilhas, err := contract.GetPlanilhasByLote(ctx, "C22009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planilhas) != 1 || planilhas[0].HashPlanilha != hexHash {
+		t.Errorf("planilhas do lote inesperadas: %+v", planilhas)
+	}
+}
+
+func TestStorePlanilhaRejectsInvalidHash(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	sha512Hex := hex.EncodeToString(make([]byte, 64))
+
+	cases := map[string]struct {
+		hash     string
+		metadata string
+	}{
+		"tamanho diferente do algoritmo": {sha512Hex, `{"algorithm":"sha256"}`},
+		"alfabeto hex invalido":          {"zz" + sha512Hex[2:], ``},
+		"base64 invalido":                {"***", `{"encoding":"base64"}`},
+		"algoritmo nao suportado":        {sha512Hex, `{"algorithm":"md5"}`},
+		"campo desconhecido":             {sha512Hex, `{"size":10}`},
+		"tamanho negativo":               {sha512Hex, `{"file_size":-1}`},
+	}
+
+	stub.MockTransactionStart("invalidos")
+	defer stub.MockTransactionEnd("invalidos")
+
+	for name, tc := range cases {
+		if err := contract.StorePlanilha(ctx, "C22009", tc.hash, tc.metadata); err == nil {
+			t.Errorf("%s: hash %s deveria ser recusado", name, tc.hash)
+		}
+	}
+
+	// Sem metadados, o hash SHA-512 em hex dos clientes continua aceito
+	if err := contract.StorePlanilha(ctx, "C22009", sha512Hex, ""); err != nil {
+		t.Fatal(err)
+	}
+}
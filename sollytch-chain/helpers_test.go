@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Teste de exemplo usado pelo cliente, reaproveitado como fixture
+const testFixturePath = "../client/test.json"
+
+// Cria a identidade serializada (MSP + certificado X.509) de um cliente
+func newTestCreator(tb testing.TB, mspID string, commonName string, units ...string) []byte {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: units},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return creator
+}
+
+// Cria o contexto de transação sobre o stub, com a identidade do creator
+func newTestContext(tb testing.TB, stub *shimtest.MockStub) *eventContext {
+	tb.Helper()
+
+	ctx := new(eventContext)
+	ctx.SetStub(stub)
+
+	identity, err := cid.New(stub)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ctx.SetClientIdentity(identity)
+
+	return ctx
+}
+
+/*
+	Cria um stub em memória com um administrador como cliente e os
+	três modelos de modelos/ já armazenados, pronto para StoreTest
+*/
+func newTestContract(tb testing.TB) (*SmartContract, *shimtest.MockStub, *eventContext) {
+	tb.Helper()
+
+	contract := new(SmartContract)
+	stub := shimtest.NewMockStub("sollytch-chain", nil)
+	stub.Creator = newTestCreator(tb, "org1MSP", "admin", "admin")
+	ctx := newTestContext(tb, stub)
+
+	stub.MockTransactionStart("setup")
+	defer stub.MockTransactionEnd("setup")
+
+	for _, modelKey := range []string{"acao_recomendada", "result_class", "qc_status"} {
+		modelBytes, err := os.ReadFile("modelos/" + modelKey)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := contract.StoreModel(ctx, modelKey, base64.StdEncoding.EncodeToString(modelBytes)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return contract, stub, ctx
+}
+
+// Lê o JSON de teste usado como fixture
+func readTestFixture(tb testing.TB) string {
+	tb.Helper()
+
+	fixture, err := os.ReadFile(testFixturePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return string(fixture)
+}
+
+// Descarta a saída padrão (linhas BENCHMARK_METRIC) durante o teste
+func silenceStdout(tb testing.TB) {
+	tb.Helper()
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = devNull
+	tb.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+// Retorna o JSON da fixture com os campos informados substituídos
+func fixtureWith(tb testing.TB, fields map[string]interface{}) string {
+	tb.Helper()
+
+	var test map[string]interface{}
+	if err := json.Unmarshal([]byte(readTestFixture(tb)), &test); err != nil {
+		tb.Fatal(err)
+	}
+	for field, value := range fields {
+		test[field] = value
+	}
+
+	data, err := json.Marshal(test)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// Iterador em memória sobre resultados já carregados
+type sliceIterator struct {
+	results []*queryresult.KV
+}
+
+func (it *sliceIterator) HasNext() bool {
+	return len(it.results) > 0
+}
+
+func (it *sliceIterator) Next() (*queryresult.KV, error) {
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+func (it *sliceIterator) Close() error {
+	return nil
+}
+
+/*
+	MockStub com consultas paginadas, que o shimtest não implementa.
+	O bookmark é a chave do primeiro registro da página seguinte
+*/
+type pagingStub struct {
+	*shimtest.MockStub
+}
+
+func (stub *pagingStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	iterator, err := stub.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iterator.Close()
+
+	page := &sliceIterator{}
+	next := ""
+	for iterator.HasNext() {
+		result, err := iterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if result.Key < bookmark {
+			continue
+		}
+		if int32(len(page.results)) == pageSize {
+			next = result.Key
+			break
+		}
+		page.results = append(page.results, result)
+	}
+
+	metadata := &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(page.results)),
+		Bookmark:            next,
+	}
+	return page, metadata, nil
+}
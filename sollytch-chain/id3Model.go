@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/sjwhitworth/golearn/base"
+	"github.com/sjwhitworth/golearn/trees"
+)
+
+/*
+	Função que reconstrói um modelo ID3 diretamente dos bytes serializados
+	pelo golearn (trees.ID3DecisionTree.Save), sem passar pelo sistema de
+	arquivos. O formato é um tar compactado com gzip contendo CLS_MANIFEST,
+	METADATA, a árvore em JSON ("tree") e o atributo de classe ("treeClassAttr"),
+	lidos aqui da mesma forma que o Load da biblioteca
+*/
+func decodeID3Model(modelBytes []byte) (*trees.ID3DecisionTree, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(modelBytes))
+	if err != nil {
+		return nil, fmt.Errorf("modelo nao esta no formato gzip: %v", err)
+	}
+	defer gzipReader.Close()
+
+	// Lê todas as entradas do tar; entradas repetidas mantêm a mais recente.
+	// O Save do golearn não fecha o tar nem o gzip, então o fim truncado
+	// do arquivo é aceito desde que as entradas lidas estejam completas
+	entries := map[string][]byte{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler modelo: %v", err)
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler %s do modelo: %v", header.Name, err)
+		}
+		entries[header.Name] = content
+	}
+
+	entry := func(name string) ([]byte, error) {
+		content, ok := entries[name]
+		if !ok {
+			return nil, fmt.Errorf("modelo sem a entrada %s", name)
+		}
+		return content, nil
+	}
+
+	// Confere o formato de serialização
+	manifest, err := entry("CLS_MANIFEST")
+	if err != nil {
+		return nil, err
+	}
+	if string(manifest) != base.SerializationFormatVersion {
+		return nil, fmt.Errorf("CLS_MANIFEST nao suportado: %s", manifest)
+	}
+
+	metadataBytes, err := entry("METADATA")
+	if err != nil {
+		return nil, err
+	}
+	var metadata base.ClassifierMetadataV1
+	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+		return nil, fmt.Errorf("METADATA invalido: %v", err)
+	}
+	if metadata.FormatVersion != 1 || metadata.ClassifierName != "ID3" {
+		return nil, fmt.Errorf("modelo nao e uma arvore ID3 suportada (%s, formato %d)", metadata.ClassifierName, metadata.FormatVersion)
+	}
+
+	// Reconstrói a árvore e o atributo de classe da raiz
+	treeBytes, err := entry("tree")
+	if err != nil {
+		return nil, err
+	}
+	root := &trees.DecisionTreeNode{}
+	if err := json.Unmarshal(treeBytes, root); err != nil {
+		return nil, fmt.Errorf("arvore invalida: %v", err)
+	}
+
+	classAttrBytes, err := entry("treeClassAttr")
+	if err != nil {
+		return nil, err
+	}
+	root.ClassAttr, err = base.DeserializeAttribute(classAttrBytes)
+	if err != nil {
+		return nil, fmt.Errorf("atributo de classe invalido: %v", err)
+	}
+
+	model := trees.NewID3DecisionTree(0.1)
+	model.Root = root
+
+	return model, nil
+}
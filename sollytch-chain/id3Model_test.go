@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sjwhitworth/golearn/trees"
+)
+
+// Linha de features do teste de exemplo (client/test.json) na ordem de baseHeader
+const fixtureFeatureRow = "-22.87496,-43.246872,42,24.87,466.3,66.2,6.79,3.1,26.3,19.6,80.8,308.2,0.1,27.2,23,0,9.76,31.76,2.82,1,0"
+
+// Linhas variadas para comparar as predições dos dois caminhos de carga
+var featureRows = []string{
+	fixtureFeatureRow,
+	"-15.7801,-47.9292,5,12.4,310,50,7.2,1.2,24,22,60,500,2,30,45,0.3,2,0.5,0.1,1,2",
+	"-3.1,-60.02,120,40,900,80,5.1,80,30,34,95,90,15,10,600,1.2,30,250,40,0,1",
+	"-29.9,-51.2,0,0,0,10,9.5,500,4,5,20,10000,-30,0,5,0,100,5000,800,0,0",
+}
+
+func TestDecodeID3ModelMatchesLibraryLoad(t *testing.T) {
+	for _, target := range []string{"acao_recomendada", "result_class", "qc_status"} {
+		modelBytes, err := os.ReadFile(filepath.Join("modelos", target))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := decodeID3Model(modelBytes)
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+
+		loaded := trees.NewID3DecisionTree(0.1)
+		if err := loaded.Load(filepath.Join("modelos", target)); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, row := range featureRows {
+			want, err := predictFromCSV(loaded, baseHeader, target, row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := predictFromCSV(decoded, baseHeader, target, row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("%s: predicao %q, Load da biblioteca %q (linha %s)", target, got, want, row)
+			}
+		}
+	}
+}
+
+func TestDecodeID3ModelRejectsInvalidBytes(t *testing.T) {
+	if _, err := decodeID3Model([]byte("nao e um modelo")); err == nil {
+		t.Fatal("bytes invalidos deveriam ser rejeitados")
+	}
+}
+
+func TestConcurrentPredictions(t *testing.T) {
+	modelCache.reset()
+	contract, stub, ctx := newTestContract(t)
+	stub.MockTransactionStart("predict")
+	defer stub.MockTransactionEnd("predict")
+
+	// Predição sequencial de referência
+	models, err := contract.loadPredictionModels(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected TestRecord
+	if err := applyPredictions(&expected, models); err != nil {
+		t.Fatal(err)
+	}
+
+	// Esvazia o cache para que as goroutines também decodifiquem em paralelo
+	modelCache.reset()
+
+	const workers = 64
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			models, err := contract.loadPredictionModels(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			var record TestRecord
+			if err := applyPredictions(&record, models); err != nil {
+				errs <- err
+				return
+			}
+
+			if record.AcaoRecomendada != expected.AcaoRecomendada ||
+				record.ResultClass != expected.ResultClass ||
+				record.QCStatus != expected.QCStatus {
+				errs <- fmt.Errorf("predicao divergente: %s/%s/%s", record.AcaoRecomendada, record.ResultClass, record.QCStatus)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
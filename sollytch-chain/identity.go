@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+	Função que identifica quem submeteu a transação atual.
+	Retorna o MSP da organização e o subject do certificado X.509
+	do cliente, usados como trilha de auditoria nos registros
+*/
+func getSubmitter(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", "", fmt.Errorf("erro ao obter MSP do cliente: %v", err)
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return "", "", fmt.Errorf("erro ao obter certificado do cliente: %v", err)
+	}
+	if cert == nil {
+		return mspID, "", nil
+	}
+
+	return mspID, cert.Subject.String(), nil
+}
+
+/*
+	Organizações (MSPs) cujos administradores governam o chaincode:
+	registro e promoção de modelos, configurações compartilhadas e status
+	dos lotes. Administradores de outras organizações do canal não são
+	aceitos. Definida no código para que todos os peers endossem igual
+*/
+var adminMSPs = []string{"org1MSP", "orgMSP"}
+
+/*
+	Função que exige que a transação tenha sido submetida por um administrador
+	de uma das organizações em adminMSPs. Aceita identidades com o atributo
+	"role=admin" emitido pela Fabric CA ou certificados com OU=admin
+	(NodeOUs do MSP)
+*/
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("erro ao obter MSP do cliente: %v", err)
+	}
+
+	adminMSP := false
+	for _, allowed := range adminMSPs {
+		if mspID == allowed {
+			adminMSP = true
+			break
+		}
+	}
+	if !adminMSP {
+		return fmt.Errorf("operacao restrita a administradores de %v", adminMSPs)
+	}
+
+	role, found, err := ctx.GetClientIdentity().GetAttributeValue("role")
+	if err != nil {
+		return fmt.Errorf("erro ao obter atributos do cliente: %v", err)
+	}
+	if found && role == "admin" {
+		return nil
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("erro ao obter certificado do cliente: %v", err)
+	}
+	if cert != nil {
+		for _, unit := range cert.Subject.OrganizationalUnit {
+			if unit == "admin" {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("operacao restrita a administradores")
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Status do ciclo de vida de um lote de cassetes
+const (
+	LoteReleased    = "released"
+	LoteQuarantined = "quarantined"
+	LoteRecalled    = "recalled"
+	LoteExpired     = "expired"
+)
+
+// Status aceitos pelo SetLoteStatus
+var loteStatuses = []string{LoteReleased, LoteQuarantined, LoteRecalled, LoteExpired}
+
+// Formato da data de validade do lote
+const loteExpiryLayout = "2006-01-02"
+
+// struct json do status de um lote de cassetes
+type LoteStatus struct {
+	//trackers
+	Version          int    `json:"version"`
+	LastUpdatedAt    string `json:"last_updated_at"`
+	LastUpdatedByMSP string `json:"last_updated_by_msp"`
+	LastUpdatedBy    string `json:"last_updated_by"`
+
+	//chave de busca
+	CasseteLot       string `json:"cassete_lot"`
+
+	//conteudo
+	Status           string `json:"status"`
+	Reason           string `json:"reason"`
+	EvidenceHash     string `json:"evidence_hash"`
+	ExpiryDate       string `json:"expiry_date"`
+}
+
+// struct json de uma alteração de status no histórico do lote
+type LoteStatusChange struct {
+	TxID      string      `json:"tx_id"`
+	Timestamp string      `json:"timestamp"`
+	Record    *LoteStatus `json:"record"`
+}
+
+// Cria a chave composta sob a qual o status do lote é armazenado
+func loteStatusKey(ctx contractapi.TransactionContextInterface, casseteLot string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("lote~status", []string{casseteLot})
+}
+
+// Recupera o status gravado de um lote (nil quando o lote nunca teve status definido)
+func getLoteStatus(ctx contractapi.TransactionContextInterface, casseteLot string) (*LoteStatus, error) {
+	key, err := loteStatusKey(ctx, casseteLot)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao acessar o ledger: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var status LoteStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("erro ao deserializar status do lote: %v", err)
+	}
+
+	return &status, nil
+}
+
+/*
+	Função que confere o status do lote de um novo teste antes da gravação.
+	Testes de lotes recolhidos (recalled) são recusados. Testes de lotes
+	em quarentena ou vencidos são aceitos, mas sinalizados em lote_flags
+	(ver setLoteFlags)
+*/
+func checkLoteForTest(ctx contractapi.TransactionContextInterface, record *TestRecord) error {
+	status, err := setLoteFlags(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	if status != nil && status.Status == LoteRecalled {
+		return fmt.Errorf("lote %s recolhido: %s", record.CassetteLot, status.Reason)
+	}
+
+	return nil
+}
+
+/*
+	Função que recalcula os alertas do lote de um teste em lote_flags, sem
+	recusar o teste. Usada diretamente pelo UpdateTest, para que testes de
+	um lote recolhido depois da gravação continuem corrigíveis.
+	O lote é considerado vencido pelo status expired, pela data de validade
+	do lote anterior à data do teste ou por expiry_days_left negativo.
+	Retorna o status gravado do lote (nil se nunca foi definido)
+*/
+func setLoteFlags(ctx contractapi.TransactionContextInterface, record *TestRecord) (*LoteStatus, error) {
+	var flags []string
+
+	status, err := getLoteStatus(ctx, record.CassetteLot)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := record.ExpiryDaysLeft < 0
+
+	if status != nil {
+		switch status.Status {
+		case LoteRecalled, LoteQuarantined:
+			flags = append(flags, status.Status)
+		case LoteExpired:
+			expired = true
+		}
+
+		if status.ExpiryDate != "" && testDate(ctx, record) > status.ExpiryDate {
+			expired = true
+		}
+	}
+
+	if expired {
+		flags = append(flags, LoteExpired)
+	}
+
+	record.LoteFlags = flags
+
+	return status, nil
+}
+
+// Data (AAAA-MM-DD) em que o teste foi realizado, ou a da transação
+// quando o timestamp do teste não estiver nesse formato
+func testDate(ctx contractapi.TransactionContextInterface, record *TestRecord) string {
+	if len(record.Timestamp) >= len(loteExpiryLayout) {
+		date := record.Timestamp[:len(loteExpiryLayout)]
+		if _, err := time.Parse(loteExpiryLayout, date); err == nil {
+			return date
+		}
+	}
+
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return ""
+	}
+	return time.Unix(txTime.Seconds, int64(txTime.Nanos)).UTC().Format(loteExpiryLayout)
+}
+
+/*
+	Função que altera o status de um lote de cassetes.
+	Recebe o lote, o novo status (released, quarantined, recalled ou expired),
+	o motivo da alteração, o hash da evidência (obrigatório para quarentena
+	e recolhimento) e, opcionalmente, a data de validade do lote (AAAA-MM-DD;
+	vazia mantém a atual). Um lote recolhido não pode voltar a outro status.
+	Cada alteração gera uma nova versão, consultável em GetLoteStatusHistory.
+	Apenas administradores podem alterar o status de um lote
+*/
+func (c *SmartContract) SetLoteStatus(ctx contractapi.TransactionContextInterface, casseteLot string, status string, reason string, evidenceHash string, expiryDate string) error {
+	// Apenas administradores podem liberar, bloquear ou recolher lotes
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	// Valida os parâmetros obrigatórios
+	if casseteLot == "" || status == "" || reason == "" {
+		return fmt.Errorf("casseteLot, status e reason são obrigatórios")
+	}
+
+	valid := false
+	for _, allowed := range loteStatuses {
+		if status == allowed {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("status %q invalido, esperado um de: %s", status, strings.Join(loteStatuses, ", "))
+	}
+
+	if evidenceHash == "" && (status == LoteQuarantined || status == LoteRecalled) {
+		return fmt.Errorf("evidenceHash é obrigatório para o status %s", status)
+	}
+
+	if expiryDate != "" {
+		if _, err := time.Parse(loteExpiryLayout, expiryDate); err != nil {
+			return fmt.Errorf("expiryDate deve estar no formato AAAA-MM-DD")
+		}
+	}
+
+	current, err := getLoteStatus(ctx, casseteLot)
+	if err != nil {
+		return err
+	}
+
+	record := LoteStatus{CasseteLot: casseteLot, Version: 0}
+	if current != nil {
+		if current.Status == LoteRecalled && status != LoteRecalled {
+			return fmt.Errorf("lote %s recolhido nao pode mudar de status", casseteLot)
+		}
+		record.Version = current.Version + 1
+		record.ExpiryDate = current.ExpiryDate
+	}
+
+	// Obtém o timestamp da transação atual
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	// Identifica quem alterou o status para a trilha de auditoria
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	record.Status = status
+	record.Reason = reason
+	record.EvidenceHash = evidenceHash
+	if expiryDate != "" {
+		record.ExpiryDate = expiryDate
+	}
+	record.LastUpdatedAt = time.Unix(
+		txTime.Seconds,
+		int64(txTime.Nanos),
+	).UTC().Format(time.RFC3339)
+	record.LastUpdatedByMSP = mspID
+	record.LastUpdatedBy = subject
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	key, err := loteStatusKey(ctx, casseteLot)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(key, recordBytes); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventLoteStatusChanged, &LoteStatusEventData{
+		CasseteLot: casseteLot,
+		Status:     status,
+		Version:    record.Version,
+	})
+}
+
+/*
+	Função que consulta o status atual de um lote.
+	Lotes sem status definido são considerados liberados (released)
+	e retornados com os metadados vazios
+*/
+func (c *SmartContract) GetLoteStatus(ctx contractapi.TransactionContextInterface, casseteLot string) (*LoteStatus, error) {
+	// Valida se o número do lote foi informado
+	if casseteLot == "" {
+		return nil, fmt.Errorf("casseteLot não pode ser vazio")
+	}
+
+	status, err := getLoteStatus(ctx, casseteLot)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return &LoteStatus{CasseteLot: casseteLot, Status: LoteReleased}, nil
+	}
+
+	return status, nil
+}
+
+/*
+	Função que retorna o histórico de alterações de status de um lote,
+	em ordem cronológica, com o txID e o timestamp de cada transação
+*/
+func (c *SmartContract) GetLoteStatusHistory(ctx contractapi.TransactionContextInterface, casseteLot string) ([]*LoteStatusChange, error) {
+	// Valida se o número do lote foi informado
+	if casseteLot == "" {
+		return nil, fmt.Errorf("casseteLot não pode ser vazio")
+	}
+
+	key, err := loteStatusKey(ctx, casseteLot)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar histórico: %v", err)
+	}
+	defer iterator.Close()
+
+	results := []*LoteStatusChange{}
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if modification.IsDelete {
+			continue
+		}
+
+		var record LoteStatus
+		if err := json.Unmarshal(modification.Value, &record); err != nil {
+			return nil, fmt.Errorf("erro ao deserializar versão %s: %v", modification.TxId, err)
+		}
+
+		results = append(results, &LoteStatusChange{
+			TxID: modification.TxId,
+			Timestamp: time.Unix(
+				modification.Timestamp.GetSeconds(),
+				int64(modification.Timestamp.GetNanos()),
+			).UTC().Format(time.RFC3339Nano),
+			Record: &record,
+		})
+	}
+
+	// Ordena pela versão do status, que cresce a cada alteração
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Record.Version < results[j].Record.Version
+	})
+
+	return results, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoreTestHonorsLoteStatus(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("lote")
+	defer stub.MockTransactionEnd("lote")
+
+	// Sem status definido o lote é liberado e o teste não recebe alertas
+	if err := contract.StoreTest(ctx, "TEST-1", fixture, ""); err != nil {
+		t.Fatal(err)
+	}
+	record, err := contract.GetTestByID(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.LoteFlags) != 0 {
+		t.Errorf("lote liberado nao deveria gerar alertas: %v", record.LoteFlags)
+	}
+
+	// Quarentena com validade anterior à data do teste (2025-07-15)
+	if err := contract.SetLoteStatus(ctx, "C22009", LoteQuarantined, "suspeita de contaminacao", "abc123", "2025-07-01"); err != nil {
+		t.Fatal(err)
+	}
+	if err := contract.StoreTest(ctx, "TEST-2", fixture, ""); err != nil {
+		t.Fatal(err)
+	}
+	record, err = contract.GetTestByID(ctx, "TEST-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(record.LoteFlags, ",") != "quarantined,expired" {
+		t.Errorf("alertas inesperados: %v", record.LoteFlags)
+	}
+
+	// Lote recolhido recusa novos testes e não pode voltar a ser liberado
+	if err := contract.SetLoteStatus(ctx, "C22009", LoteRecalled, "recall do fabricante", "def456", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := contract.StoreTest(ctx, "TEST-3", fixture, ""); err == nil || !strings.Contains(err.Error(), "recolhido") {
+		t.Errorf("teste de lote recolhido deveria ser recusado, erro: %v", err)
+	}
+	if err := contract.SetLoteStatus(ctx, "C22009", LoteReleased, "liberado", "", ""); err == nil {
+		t.Error("lote recolhido nao deveria mudar de status")
+	}
+
+	// Testes já gravados continuam corrigíveis e passam a sinalizar o recolhimento
+	if err := contract.UpdateTest(ctx, "TEST-2", fixtureWith(t, map[string]interface{}{"operator_id": "OP05"})); err != nil {
+		t.Fatalf("teste de lote recolhido deveria ser corrigivel: %v", err)
+	}
+	record, err = contract.GetTestByID(ctx, "TEST-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.OperatorID != "OP05" || strings.Join(record.LoteFlags, ",") != "recalled,expired" {
+		t.Errorf("correcao ou alertas inesperados: %s %v", record.OperatorID, record.LoteFlags)
+	}
+
+	status, err := contract.GetLoteStatus(ctx, "C22009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != LoteRecalled || status.Version != 1 || status.ExpiryDate != "2025-07-01" {
+		t.Errorf("status inesperado: %+v", status)
+	}
+}
+
+func TestSetLoteStatusValidatesInput(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	stub.MockTransactionStart("lote")
+	defer stub.MockTransactionEnd("lote")
+
+	cases := []struct {
+		status, reason, evidence, expiry string
+	}{
+		{"bloqueado", "motivo", "abc", ""},
+		{LoteReleased, "", "", ""},
+		{LoteRecalled, "recall", "", ""},
+		{LoteReleased, "motivo", "", "01/07/2025"},
+	}
+	for _, c := range cases {
+		if err := contract.SetLoteStatus(ctx, "C1", c.status, c.reason, c.evidence, c.expiry); err == nil {
+			t.Errorf("SetLoteStatus(%q, %q, %q, %q) deveria falhar", c.status, c.reason, c.evidence, c.expiry)
+		}
+	}
+}
+
+func TestSetLoteStatusRequiresAdmin(t *testing.T) {
+	contract, stub, _ := newTestContract(t)
+
+	stub.MockTransactionStart("operador")
+	defer stub.MockTransactionEnd("operador")
+
+	stub.Creator = newTestCreator(t, "org1MSP", "operador")
+	operator := newTestContext(t, stub)
+
+	err := contract.SetLoteStatus(operator, "C22009", LoteQuarantined, "suspeita de contaminacao", "abc123", "")
+	if err == nil || !strings.Contains(err.Error(), "administradores") {
+		t.Fatalf("SetLoteStatus deveria ser restrito a administradores, erro: %v", err)
+	}
+
+	// O lote continua sem status definido
+	status, err := contract.GetLoteStatus(operator, "C22009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != LoteReleased {
+		t.Errorf("lote nao deveria mudar de status, esta %s", status.Status)
+	}
+}
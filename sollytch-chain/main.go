@@ -1,11 +1,11 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -40,6 +40,9 @@ type ModelBytes struct {
 
 	//conteudo
 	ModelData  string `json:"modelData"`
+
+	//hash SHA-256 (hex) dos bytes decodificados do modelo
+	ContentHash string `json:"content_hash"`
 }
 
 // struct json do hash da planilha
@@ -52,8 +55,15 @@ type LoteRecord struct{
 	//chave de busca
 	CasseteLot    string `json:"cassete_lot"`
 
-	//conteudo
+	//conteudo (hash canônico em hex minúsculo)
 	HashPlanilha  string `json:"hash_planilha"`
+
+	//metadados do hash e do arquivo de origem
+	HashAlgorithm string `json:"hash_algorithm"`
+	HashEncoding  string `json:"hash_encoding"`
+	FileSize      int64  `json:"file_size"`
+	MimeType      string `json:"mime_type"`
+	FileName      string `json:"file_name"`
 }
 
 // struct json dos testes
@@ -62,6 +72,8 @@ type TestRecord struct {
 	Version 		          int         `json:"version"`
 	LastUpdatedAt             string      `json:"last_updated_at"`
 	CreatedAt                 string      `json:"created_at"`
+	LastUpdatedByMSP          string      `json:"last_updated_by_msp"`
+	LastUpdatedBy             string      `json:"last_updated_by"`
 
 	//chaves de busca
 	TestID                    string      `json:"test_id"`
@@ -106,6 +118,31 @@ type TestRecord struct {
 	AcaoRecomendada           string      `json:"acao_recomendada"`
 	ResultClass               string      `json:"result_class"`
 	QCStatus                  string      `json:"qc_status"`
+
+	//hashes (hex canônico) das imagens do teste ancoradas no sollytch-image
+	ImageHashes               []string    `json:"image_hashes,omitempty" metadata:",optional"`
+
+	//alertas do status do lote no momento do registro (ex.: quarantined, expired)
+	LoteFlags                 []string    `json:"lote_flags,omitempty" metadata:",optional"`
+
+	//proveniência de cada predição (chave: variável-alvo)
+	Predictions               map[string]PredictionMetadata `json:"predictions,omitempty" metadata:",optional"`
+}
+
+/*
+	struct json da origem de uma predição registrada no teste.
+	O cabeçalho e a linha de features formam exatamente o CSV usado na predição,
+	permitindo reproduzi-la offline com treino_ml/teste.go e o modelo
+	identificado pela versão e pelo hash SHA-256 do conteúdo
+*/
+type PredictionMetadata struct {
+	Prediction     string `json:"prediction"`
+	ModelKey       string `json:"model_key"`
+	ModelVersion   int    `json:"model_version"`
+	ModelUpdatedAt string `json:"model_updated_at"`
+	ModelHash      string `json:"model_hash"`
+	FeatureHeader  string `json:"feature_header"`
+	FeatureRow     string `json:"feature_row"`
 }
 
 type SmartContract struct {
@@ -114,17 +151,30 @@ type SmartContract struct {
 
 /*
 	Função responsável por armazenar ou atualizar o registro de uma planilha no ledger
-	Utiliza o hash da planilha como chave principal (state key) e o lote (casseteLot)
-	como parte de uma chave composta para indexação e busca
+	Recebe, além do lote e do hash, um JSON com os metadados do arquivo
+	(algorithm, encoding, file_size, mime_type e file_name). O hash é validado
+	contra o algoritmo e a codificação declarados e a chave principal (state key)
+	recebe o namespace "planilha:<algoritmo>:<hex>". O lote (casseteLot)
+	faz parte de uma chave composta para indexação e busca
 */
-func (c *SmartContract) StorePlanilha(ctx contractapi.TransactionContextInterface, casseteLot string, hashPlanilha string) error {
+func (c *SmartContract) StorePlanilha(ctx contractapi.TransactionContextInterface, casseteLot string, hashPlanilha string, metadataJSON string) error {
 	// Valida se os parâmetros obrigatórios foram informados
 	if casseteLot == "" || hashPlanilha == "" {
 		return fmt.Errorf("casseteLot e hashPlanilha são obrigatórios")
 	}
 
-	// Define o hash como chave principal do estado
-	planilhaKey := hashPlanilha
+	// Valida os metadados e o formato do hash
+	metadata, err := parseFileMetadata(metadataJSON)
+	if err != nil {
+		return err
+	}
+	hashPlanilha, err = canonicalHash(hashPlanilha, metadata.Algorithm, metadata.Encoding)
+	if err != nil {
+		return err
+	}
+
+	// Define a chave principal do estado a partir do hash canônico
+	planilhaKey := namespacedHashKey(planilhaNamespace, metadata.Algorithm, hashPlanilha)
 
 	// Obtém o timestamp da transação atual
 	txTime, err := ctx.GetStub().GetTxTimestamp()
@@ -138,25 +188,24 @@ func (c *SmartContract) StorePlanilha(ctx contractapi.TransactionContextInterfac
 		int64(txTime.Nanos),
 	).UTC().Format(time.RFC3339)
 	
-	// Verifica se já existe um registro para esse hash no ledger
-	exists, err := c.PlanilhaExists(ctx, planilhaKey)
+	// Verifica se já existe um registro para esse hash no ledger,
+	// inclusive sob a chave antiga (sem namespace)
+	assetBytes, foundKey, err := getPlanilhaState(ctx, hashPlanilha)
 	if err != nil {
 		return err
 	}
 
 	var asset LoteRecord
 
-	if exists {
-		// Caso já exista, carrega o registro atual para atualização
-		assetBytes, err := ctx.GetStub().GetState(planilhaKey)
-		if err != nil {
-			return err
-		}
-		if assetBytes == nil {
-			return fmt.Errorf("falha ao carregar planilha existente %s", hashPlanilha)
+	if assetBytes != nil {
+		// Registros antigos são convertidos para o formato com namespace
+		if foundKey != planilhaKey {
+			if assetBytes, err = migrateLegacyPlanilha(ctx, foundKey, planilhaKey, assetBytes); err != nil {
+				return err
+			}
 		}
 
-		// Desserializa os dados armazenados
+		// Caso já exista, desserializa o registro atual para atualização
 		if err := json.Unmarshal(assetBytes, &asset); err != nil {
 			return err
 		}
@@ -170,6 +219,11 @@ func (c *SmartContract) StorePlanilha(ctx contractapi.TransactionContextInterfac
 		asset = LoteRecord{
 			CasseteLot:    casseteLot,
 			HashPlanilha:  hashPlanilha,
+			HashAlgorithm: metadata.Algorithm,
+			HashEncoding:  metadata.Encoding,
+			FileSize:      metadata.FileSize,
+			MimeType:      metadata.MimeType,
+			FileName:      metadata.FileName,
 			Timestamp:     formattedTime,
 			Version:       0,
 			LastUpdatedAt: formattedTime,
@@ -191,13 +245,22 @@ func (c *SmartContract) StorePlanilha(ctx contractapi.TransactionContextInterfac
 	}
 
 	// Serializa o objeto para armazenamento
-	assetBytes, err := json.Marshal(asset)
+	assetBytes, err = json.Marshal(asset)
 	if err != nil {
 		return err
 	}
 
-	// Persiste o registro usando o hash como chave principal
-	return ctx.GetStub().PutState(planilhaKey, assetBytes)
+	// Persiste o registro usando a chave com namespace como chave principal
+	if err := putStateMigrating(ctx, planilhaKey, foundKey, assetBytes); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventPlanilhaAnchored, &PlanilhaEventData{
+		CasseteLot:    asset.CasseteLot,
+		HashPlanilha:  asset.HashPlanilha,
+		HashAlgorithm: asset.HashAlgorithm,
+		Version:       asset.Version,
+	})
 }
 
 /*
@@ -258,8 +321,9 @@ func (c *SmartContract) GetPlanilhasByLote(ctx contractapi.TransactionContextInt
 
 /*
 	Função que recupera uma planilha específica a partir do seu hash
-	Busca diretamente no ledger pela chave principal (hashPlanilha)
-	e retorna um único objeto LoteRecord
+	Resolve a chave principal ("planilha:<algoritmo>:<hex>") a partir do
+	hash (hex ou base64), busca diretamente no ledger e retorna
+	um único objeto LoteRecord
 */
 func (c *SmartContract) GetPlanilhaByHash(ctx contractapi.TransactionContextInterface, hashPlanilha string) (*LoteRecord, error) {
 	// Valida se o hash foi informado
@@ -267,8 +331,8 @@ func (c *SmartContract) GetPlanilhaByHash(ctx contractapi.TransactionContextInte
 		return nil, fmt.Errorf("hashPlanilha não pode ser vazio")
 	}
 
-	// Consulta o estado no ledger usando o hash como chave
-	data, err := ctx.GetStub().GetState(hashPlanilha)
+	// Consulta o estado no ledger usando a chave resolvida
+	data, _, err := getPlanilhaState(ctx, hashPlanilha)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao acessar o ledger: %v", err)
 	}
@@ -288,11 +352,11 @@ func (c *SmartContract) GetPlanilhaByHash(ctx contractapi.TransactionContextInte
 
 /*
 	Função que verifica se já existe um registro de planilha no ledger
-	Recebe a chave principal (hash da planilha) e retorna true caso exista
+	Recebe o hash da planilha (hex ou base64) e retorna true caso exista
 */
-func (c *SmartContract) PlanilhaExists(ctx contractapi.TransactionContextInterface, planilhaKey string) (bool, error) {
+func (c *SmartContract) PlanilhaExists(ctx contractapi.TransactionContextInterface, hashPlanilha string) (bool, error) {
 	// Consulta o estado no ledger
-	data, err := ctx.GetStub().GetState(planilhaKey)
+	data, _, err := getPlanilhaState(ctx, hashPlanilha)
 	if err != nil {
 		return false, err
 	}
@@ -303,79 +367,28 @@ func (c *SmartContract) PlanilhaExists(ctx contractapi.TransactionContextInterfa
 
 /*
 	Função responsável por armazenar ou atualizar um modelo de Machine Learning no ledger
-	Armazena os bytes do modelo (em Base64), controla versionamento e registra
-	a data de atualização para uso posterior em predições
+	Registra os bytes do modelo (em Base64) como uma nova versão no registro
+	de modelos (ver RegisterModel) e a torna imediatamente o modelo ativo
+	usado nas predições
 */
 func (s *SmartContract) StoreModel(ctx contractapi.TransactionContextInterface, modelKey string, modelBase64 string) error {
-	// Valida se os parâmetros obrigatórios foram informados
-	if modelKey == "" || modelBase64 == "" {
-		return fmt.Errorf("modelKey e modelData nao podem ser vazios")
-	}
-
-	// Permite apenas chaves de modelo previamente definidas
-	switch modelKey {
-	case "acao_recomendada", "result_class", "qc_status":
-		// Chaves válidas
-	default:
-		return fmt.Errorf("modelKey invalido")
-	}
-
-	stub := ctx.GetStub()
-
-	// Verifica se já existe um modelo armazenado com essa chave
-	existingBytes, err := stub.GetState(modelKey)
-	if err != nil {
-		return fmt.Errorf("erro ao buscar modelo existente: %v", err)
-	}
-
-	// Define versão inicial como 1
-	version := 1
-
-	// Caso já exista, incrementa a versão com base na anterior
-	if existingBytes != nil {
-		var existingModel ModelBytes
-		err = json.Unmarshal(existingBytes, &existingModel)
-		if err != nil {
-			return fmt.Errorf("erro ao decodificar modelo existente: %v", err)
-		}
-		version = existingModel.Version + 1
-	}
-
-	// Obtém o timestamp da transação atual
-	txTime, err := ctx.GetStub().GetTxTimestamp()
-	if err != nil {
-		return err
-	}
-    
-	// Cria a estrutura do modelo com versionamento e data de atualização
-	model := ModelBytes{
-		ModelKey:  modelKey,
-		ModelData: modelBase64,
-		Version:   version,
-		UpdatedAt: time.Unix(
-			txTime.Seconds,
-			int64(txTime.Nanos),
-		).UTC().Format(time.RFC3339),
-	}
-
-	// Serializa o modelo para armazenamento
-	bytes, err := json.Marshal(model)
-	if err != nil {
+	// Apenas administradores podem alterar os modelos
+	if err := requireAdmin(ctx); err != nil {
 		return err
 	}
 
-	// Persiste o modelo no ledger usando modelKey como chave principal
-	return stub.PutState(modelKey, bytes)
+	_, err := s.registerModel(ctx, modelKey, modelBase64, ModelMetadata{}, true)
+	return err
 }
 
 /*
-	Função que recupera os bytes de um modelo armazenado no ledger
-	Busca pelo modelKey, desserializa a estrutura ModelBytes e
-	decodifica o conteúdo Base64 para retornar os bytes originais do modelo
+	Função que recupera um modelo armazenado no ledger
+	Busca pelo modelKey e desserializa a estrutura ModelBytes,
+	mantendo o conteúdo ainda em Base64 junto com os metadados de versão
 */
-func (s *SmartContract) getModelBytes(ctx contractapi.TransactionContextInterface, modelKey string) ([]byte, error) {
+func (s *SmartContract) getStoredModel(ctx contractapi.TransactionContextInterface, modelKey string) (*ModelBytes, error) {
 	// Consulta o modelo no ledger pela chave
-	data, err := ctx.GetStub().GetState(modelKey)
+	data, _, err := getModelState(ctx, modelKey)
 	if err != nil {
 		return nil, err
 	}
@@ -389,38 +402,77 @@ func (s *SmartContract) getModelBytes(ctx contractapi.TransactionContextInterfac
 		return nil, err
 	}
 
+	return &stored, nil
+}
+
+/*
+	Função que recupera os bytes de um modelo armazenado no ledger
+	Busca pelo modelKey, desserializa a estrutura ModelBytes e
+	decodifica o conteúdo Base64 para retornar os bytes originais do modelo
+*/
+func (s *SmartContract) getModelBytes(ctx contractapi.TransactionContextInterface, modelKey string) ([]byte, error) {
+	stored, err := s.getStoredModel(ctx, modelKey)
+	if err != nil {
+		return nil, err
+	}
+
 	// Decodifica o conteúdo Base64 para bytes binários originais
 	return base64.StdEncoding.DecodeString(stored.ModelData)
 }
 
 /*
 	Função que carrega um modelo ID3 armazenado no ledger
-	Recupera os bytes do modelo, grava temporariamente no sistema
-	de arquivos e utiliza o método Load para reconstruir o modelo
-	em memória para uso em predições
+	Recupera o modelo ativo e reutiliza a versão já decodificada no cache
+	do processo (modelCache) quando a versão e o hash do conteúdo não
+	mudaram; caso contrário decodifica os bytes em memória (decodeID3Model)
+	e atualiza o cache. Retorna também os metadados do modelo (versão,
+	data de atualização e hash) usados na predição
 */
-func loadID3ModelFromLedger(ctx contractapi.TransactionContextInterface, s *SmartContract, modelKey string) (*trees.ID3DecisionTree, error) {
-	// Obtém os bytes do modelo armazenado
-	bytes, err := s.getModelBytes(ctx, modelKey)
+func loadID3ModelFromLedger(ctx contractapi.TransactionContextInterface, s *SmartContract, modelKey string) (*trees.ID3DecisionTree, *ModelBytes, error) {
+	// Obtém o modelo armazenado
+	stored, err := s.getStoredModel(ctx, modelKey)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Cria um arquivo temporário para reconstrução do modelo
-	path := filepath.Join(os.TempDir(), modelKey)
-	if err := os.WriteFile(path, bytes, 0600); err != nil {
-		return nil, err
+	var bytes []byte
+
+	// Modelos gravados antes do registro do hash têm o hash calculado na carga
+	if stored.ContentHash == "" {
+		bytes, err = base64.StdEncoding.DecodeString(stored.ModelData)
+		if err != nil {
+			return nil, nil, err
+		}
+		contentHash := sha256.Sum256(bytes)
+		stored.ContentHash = hex.EncodeToString(contentHash[:])
 	}
 
-	// Instancia a estrutura do modelo ID3
-	model := trees.NewID3DecisionTree(0.1)
+	// Reutiliza o modelo decodificado se a versão ativa não mudou
+	cacheKey := modelCacheKey(ctx.GetStub().GetChannelID(), modelKey)
+	if model := modelCache.get(cacheKey, stored.Version, stored.ContentHash); model != nil {
+		return model, stored, nil
+	}
 
-	// Carrega o modelo a partir do arquivo temporário
-	if err := model.Load(path); err != nil {
-		return nil, err
+	// Decodifica o conteúdo Base64 para bytes binários originais
+	if bytes == nil {
+		bytes, err = base64.StdEncoding.DecodeString(stored.ModelData)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	model, err := decodeID3Model(bytes)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return model, nil
+	modelCache.put(cacheKey, &cachedID3Model{
+		version:     stored.Version,
+		contentHash: stored.ContentHash,
+		tree:        model,
+	})
+
+	return model, stored, nil
 }
 
 /*
@@ -452,13 +504,13 @@ var baseHeader =
 
 /*
 	Função responsável por realizar a predição.
-	Monta um CSV temporário contendo o cabeçalho completo + variável alvo,
+	Monta um CSV temporário contendo o cabeçalho de features + variável alvo,
 	adiciona a linha de entrada com classe desconhecida ("?"),
 	executa o Predict do modelo e retorna o resultado previsto
 */
-func predictFromCSV(model *trees.ID3DecisionTree, target string, csvRow string) (string, error) {
+func predictFromCSV(model *trees.ID3DecisionTree, featureHeader string, target string, csvRow string) (string, error) {
 	// Monta o cabeçalho incluindo a variável alvo
-	header := baseHeader + "," + target
+	header := featureHeader + "," + target
 
 	// Cria um mini CSV com uma única linha para predição
 	csv := header + "\n" + csvRow + ",?"
@@ -479,82 +531,204 @@ func predictFromCSV(model *trees.ID3DecisionTree, target string, csvRow string)
 	return res.RowString(0), nil
 }
 
+// modelo de predição carregado do ledger junto com seus metadados
+type predictionModel struct {
+	spec   PredictionTarget
+	tree   *trees.ID3DecisionTree
+	stored *ModelBytes
+}
+
+/*
+	Função que carrega do ledger os modelos de todas as variáveis-alvo
+	declaradas na configuração de predição. Permite carregar os modelos
+	uma única vez e reutilizá-los na predição de vários testes
+*/
+func (s *SmartContract) loadPredictionModels(ctx contractapi.TransactionContextInterface) ([]*predictionModel, error) {
+	config, err := s.getPredictionConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]*predictionModel, 0, len(config.Targets))
+
+	for _, target := range config.Targets {
+		tree, stored, err := loadID3ModelFromLedger(ctx, s, target.Target)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao carregar modelo %s: %v", target.Target, err)
+		}
+
+		models = append(models, &predictionModel{spec: target, tree: tree, stored: stored})
+	}
+
+	return models, nil
+}
+
+/*
+	Função que executa as predições de todos os modelos sobre o teste,
+	montando a linha CSV de cada variável-alvo a partir do seu cabeçalho
+	configurado, preenchendo o campo de destino do teste e registrando
+	a proveniência de cada predição (modelo, versão, hash do conteúdo
+	e o vetor de features utilizado)
+*/
+func applyPredictions(record *TestRecord, models []*predictionModel) error {
+	predictions := map[string]PredictionMetadata{}
+
+	for _, model := range models {
+		csvRow, err := buildFeatureRow(record, model.spec.FeatureHeader)
+		if err != nil {
+			return err
+		}
+
+		value, err := predictFromCSV(model.tree, model.spec.FeatureHeader, model.spec.Target, csvRow)
+		if err != nil {
+			return err
+		}
+
+		// Preenche o campo do teste configurado para a variável-alvo
+		setRecordField(record, model.spec.RecordField, value)
+
+		predictions[model.spec.Target] = PredictionMetadata{
+			Prediction:     value,
+			ModelKey:       model.stored.ModelKey,
+			ModelVersion:   model.stored.Version,
+			ModelUpdatedAt: model.stored.UpdatedAt,
+			ModelHash:      model.stored.ContentHash,
+			FeatureHeader:  model.spec.FeatureHeader + "," + model.spec.Target,
+			FeatureRow:     csvRow,
+		}
+	}
+
+	record.Predictions = predictions
+
+	return nil
+}
+
 /*
 	Função responsável por registrar um novo teste no ledger
 	Recebe:
 	- testID: identificador único do teste
 	- jsonStr: JSON com os dados estruturados do teste
-	- predictStr: string CSV com os atributos necessários para predição
+	- predictStr: opcional (pode ser vazio). String CSV com os atributos de
+	  predição; quando informada é conferida contra o JSON e rejeitada se divergir
 
 	A função:
 	1) Valida se o teste já existe
-	2) Converte o JSON em struct
-	3) Carrega os 3 modelos de ML do ledger
-	4) Executa as predições das três variáveis-alvo
-	   (acao_recomendada, result_class e qc_status)
+	2) Valida o JSON (validateTestJSON), converte em struct e confere
+	   o status do lote (lotes recolhidos são recusados; em quarentena
+	   ou vencidos são sinalizados em lote_flags)
+	3) Carrega do ledger os modelos declarados na configuração de predição
+	4) Monta a linha de features de cada variável-alvo (buildFeatureRow)
+	   e executa as predições, gravando-as nos campos configurados
+	   (por padrão acao_recomendada, result_class e qc_status)
 	5) Armazena o registro completo com versionamento e timestamp
-	6) Cria uma chave composta para indexação por lote
+	6) Cria as chaves compostas de indexação (lote, operador, reagente,
+	   produto, matriz, classe de resultado e datas)
 */
 func (s *SmartContract) StoreTest(ctx contractapi.TransactionContextInterface, testID string, jsonStr string, predictStr string) error {
 	start := time.Now()
-	// Verifica se já existe um teste com o mesmo ID
-	existing, err := ctx.GetStub().GetState(testID)
+
+	// Valida o teste antes de carregar os modelos
+	record, err := s.prepareTest(ctx, testID, jsonStr, predictStr)
 	if err != nil {
 		return err
 	}
-	if existing != nil {
-		return fmt.Errorf("teste %s ja existe", testID)
-	}
-
-	// Converte o JSON recebido para struct
-	var record TestRecord
-	if err := json.Unmarshal([]byte(jsonStr), &record); err != nil {
-		return fmt.Errorf("erro ao decodificar JSON: %v", err)
-	}
-
-	// Define explicitamente o ID do teste
-	record.TestID = testID
 
 	// Carrega os modelos de Machine Learning armazenados no ledger
-	modeloAcao, err := loadID3ModelFromLedger(ctx, s, "acao_recomendada")
+	models, err := s.loadPredictionModels(ctx)
 	if err != nil {
 		return err
 	}
 
-	modeloResult, err := loadID3ModelFromLedger(ctx, s, "result_class")
+	write, err := s.buildTest(ctx, record, models)
 	if err != nil {
 		return err
 	}
-
-	modeloQc, err := loadID3ModelFromLedger(ctx, s, "qc_status")
-	if err != nil {
+	if err := write.put(ctx); err != nil {
 		return err
 	}
 
-	// Executa as predições para as três últimas colunas da "planilha",
-	// preenchendo automaticamente os campos derivados por ML
-	record.AcaoRecomendada, err =
-		predictFromCSV(modeloAcao, "acao_recomendada", predictStr)
-	if err != nil {
-		return err
+	elapsed := time.Since(start).Seconds()
+	fmt.Printf("BENCHMARK_METRIC: { \"function\": \"StoreTest\", \"testId\": \"%s\", \"executionTime\": %.6f, \"timestamp\": \"%s\" }\n",
+		testID, elapsed, time.Now().Format(time.RFC3339Nano))
+
+	return nil
+}
+
+/*
+	Função que prepara um novo teste para gravação: confere se o testID
+	ainda não existe no ledger, valida o JSON (validateTestJSON) e,
+	quando informado, confere o predictStr contra a linha derivada do JSON
+*/
+func (s *SmartContract) prepareTest(ctx contractapi.TransactionContextInterface, testID string, jsonStr string, predictStr string) (*TestRecord, error) {
+	if testID == "" {
+		return nil, fmt.Errorf("testID não pode ser vazio")
 	}
 
-	record.ResultClass, err =
-		predictFromCSV(modeloResult, "result_class", predictStr)
+	// Verifica se já existe um teste com o mesmo ID
+	existing, _, err := getTestState(ctx, testID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("teste %s ja existe", testID)
 	}
 
-	record.QCStatus, err =
-		predictFromCSV(modeloQc, "qc_status", predictStr)
+	// Valida o JSON recebido e converte para struct
+	record, err := decodeTestRecord(jsonStr)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Define explicitamente o ID do teste
+	record.TestID = testID
+
+	// Recusa lotes recolhidos e sinaliza lotes em quarentena ou vencidos
+	if err := checkLoteForTest(ctx, record); err != nil {
+		return nil, err
+	}
+
+	// Imagens informadas no JSON precisam estar ancoradas no sollytch-image
+	if err := verifyTestImages(ctx, record); err != nil {
+		return nil, err
+	}
+
+	// predictStr é opcional, mas quando informado não pode contradizer o JSON
+	if predictStr != "" {
+		featureRow, err := buildFeatureRow(record, baseHeader)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFeatureRow(predictStr, featureRow); err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
+
+// escritas de um teste já predito, montadas antes de tocar o ledger
+type testWrite struct {
+	record    *TestRecord
+	bytes     []byte
+	indexKeys []string
+}
+
+/*
+	Função que executa as predições de um teste já preparado e monta o
+	registro final com versionamento, timestamp, identidade de quem
+	submeteu e as chaves compostas de indexação, sem gravar nada no ledger
+*/
+func (s *SmartContract) buildTest(ctx contractapi.TransactionContextInterface, record *TestRecord, models []*predictionModel) (*testWrite, error) {
+	// Executa as predições de cada variável-alvo configurada,
+	// preenchendo automaticamente os campos derivados por ML
+	if err := applyPredictions(record, models); err != nil {
+		return nil, err
 	}
 
 	// Pega o timestamp da transação
 	txTime, err := ctx.GetStub().GetTxTimestamp()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	timestamp := time.Unix(
@@ -562,42 +736,56 @@ func (s *SmartContract) StoreTest(ctx contractapi.TransactionContextInterface, t
 		int64(txTime.Nanos),
 	).UTC().Format(time.RFC3339)
 
+	// Identifica quem submeteu a transação para a trilha de auditoria
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Define controle de versão e datas
 	record.Version = 0
 	record.CreatedAt = timestamp
 	record.LastUpdatedAt = timestamp
+	record.LastUpdatedByMSP = mspID
+	record.LastUpdatedBy = subject
 
 	// Serializa o registro completo
 	bytes, err := json.Marshal(record)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Armazena o teste usando testID como chave principal
-	if err := ctx.GetStub().PutState(testID, bytes); err != nil {
-		return err
+	// Monta as chaves compostas para consulta por lote, operador, reagente,
+	// produto, matriz, classe de resultado e datas
+	indexKeys, err := testIndexKeys(ctx, record)
+	if err != nil {
+		return nil, err
 	}
 
-	// Cria chave composta para permitir consulta por lote
-	indexKey, err := ctx.GetStub().CreateCompositeKey(
-		"lote~teste",
-		[]string{record.CassetteLot, testID},
-	)
-	if err != nil {
+	return &testWrite{record: record, bytes: bytes, indexKeys: indexKeys}, nil
+}
+
+// Função que grava o teste montado por buildTest, seus índices e eventos
+func (write *testWrite) put(ctx contractapi.TransactionContextInterface) error {
+	// Armazena o teste sob a chave "teste:<testID>"
+	if err := ctx.GetStub().PutState(testStateKey(write.record.TestID), write.bytes); err != nil {
 		return err
 	}
 
-	// Armazena o indice no ledger
-	elapsed := time.Since(start).Seconds()
-	fmt.Printf("BENCHMARK_METRIC: { \"function\": \"StoreTest\", \"testId\": \"%s\", \"executionTime\": %.6f, \"timestamp\": \"%s\" }\n",
-		testID, elapsed, time.Now().Format(time.RFC3339Nano))
+	for _, indexKey := range write.indexKeys {
+		if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
 
-	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+	// Notifica o registro e, se for o caso, as predições sinalizadas
+	return emitTestEvent(ctx, EventTestStored, write.record)
 }
 
 /*
 	Função que consulta um teste específico pelo seu ID
-	Realiza busca no ledger utilizando a chave principal (testID)
+	Realiza busca no ledger utilizando a chave principal ("teste:<testID>",
+	ou o testID puro para testes ainda não migrados)
 	retorna um unico objeto TestRecord
 */
 func (s *SmartContract) GetTestByID(ctx contractapi.TransactionContextInterface, testID string,) (*TestRecord, error) {
@@ -607,7 +795,7 @@ func (s *SmartContract) GetTestByID(ctx contractapi.TransactionContextInterface,
 	}
 
 	// Busca o teste no ledger
-	data, err := ctx.GetStub().GetState(testID)
+	data, _, err := getTestState(ctx, testID)
 	if err != nil {
 		return nil, err
 	}
@@ -677,12 +865,13 @@ func (s *SmartContract) GetTestsByLote(ctx contractapi.TransactionContextInterfa
 /*
 	Função responsável por atualizar um teste já existente no ledger
 	esta função NÃO executa novamente as predições
-	com os modelos de Machine Learning, apenas atualiza o teste com a string json recebida
+	com os modelos de Machine Learning, apenas atualiza o teste com a string json recebida.
+	Para recalcular as predições utilize RepredictTest
 */
 func (s *SmartContract) UpdateTest(ctx contractapi.TransactionContextInterface, testID string, fullJSON string) error {
 	start := time.Now()
 	// Busca o teste existente no ledger
-	existingBytes, err := ctx.GetStub().GetState(testID)
+	existingBytes, foundKey, err := getTestState(ctx, testID)
 	if err != nil {
 		return err
 	}
@@ -696,10 +885,25 @@ func (s *SmartContract) UpdateTest(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 
-	// Desserializa o novo JSON completo recebido para atualização
-	var updated TestRecord
-	if err := json.Unmarshal([]byte(fullJSON), &updated); err != nil {
-		return fmt.Errorf("json invalido: %v", err)
+	// Valida e desserializa o novo JSON completo recebido para atualização
+	decoded, err := decodeTestRecord(fullJSON)
+	if err != nil {
+		return err
+	}
+	updated := *decoded
+
+	// O lote pode ter mudado: recalcula os alertas. Testes de lotes
+	// recolhidos continuam corrigíveis e são sinalizados
+	if _, err := setLoteFlags(ctx, &updated); err != nil {
+		return err
+	}
+
+	// Vínculos com imagens são mantidos quando o JSON não os informa;
+	// imagens informadas precisam estar ancoradas no sollytch-image
+	if len(updated.ImageHashes) == 0 {
+		updated.ImageHashes = existing.ImageHashes
+	} else if err := verifyTestImages(ctx, &updated); err != nil {
+		return err
 	}
 
 	// Obtém timestamp da transação atual
@@ -713,39 +917,27 @@ func (s *SmartContract) UpdateTest(ctx contractapi.TransactionContextInterface,
 		int64(txTime.Nanos),
 	).UTC().Format(time.RFC3339)
 
+	// Identifica quem submeteu a alteração
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Mantém integridade dos metadados controlados pelo ledger
 	updated.TestID = testID
 	updated.Version = existing.Version + 1           // Incrementa versão
 	updated.CreatedAt = existing.CreatedAt           // Preserva data original
 	updated.LastUpdatedAt = now                      // Atualiza data de modificação
+	updated.LastUpdatedByMSP = mspID                 // Registra o autor da alteração
+	updated.LastUpdatedBy = subject
 
-	// Caso o lote tenha sido alterado, atualiza o índice composto
-	if existing.CassetteLot != updated.CassetteLot {
-		// Remove índice antigo
-		oldIndexKey, err := ctx.GetStub().CreateCompositeKey(
-			"lote~teste",
-			[]string{existing.CassetteLot, testID},
-		)
-		if err != nil {
-			return err
-		}
+	// A proveniência das predições só é gravada pelo pipeline de ML;
+	// correções dos campos preditos ficam no histórico do teste
+	updated.Predictions = existing.Predictions
 
-		if err := ctx.GetStub().DelState(oldIndexKey); err != nil {
-			return err
-		}
-
-		// Cria novo índice com o lote atualizado
-		newIndexKey, err := ctx.GetStub().CreateCompositeKey(
-			"lote~teste",
-			[]string{updated.CassetteLot, testID},
-		)
-		if err != nil {
-			return err
-		}
-
-		if err := ctx.GetStub().PutState(newIndexKey, []byte{0x00}); err != nil {
-			return err
-		}
+	// Atualiza os índices compostos cujos valores foram alterados
+	if err := updateTestIndexes(ctx, &existing, &updated); err != nil {
+		return err
 	}
 
 	// Serializa o registro atualizado
@@ -759,14 +951,22 @@ func (s *SmartContract) UpdateTest(ctx contractapi.TransactionContextInterface,
 	fmt.Printf("BENCHMARK_METRIC: { \"function\": \"UpdateTest\", \"testId\": \"%s\", \"executionTime\": %.6f, \"timestamp\": \"%s\" }\n", 
         testID, elapsed, time.Now().Format(time.RFC3339Nano))
 
-	// Persiste o novo estado do teste no ledger
-	return ctx.GetStub().PutState(testID, bytes)
+	// Persiste o novo estado do teste no ledger, migrando a chave antiga
+	if err := putStateMigrating(ctx, testStateKey(testID), foundKey, bytes); err != nil {
+		return err
+	}
+
+	return emitTestEvent(ctx, EventTestUpdated, &updated)
 }
 
 // main inicia a execução do chaincode no blockchain
 func main() {
 	// Cria uma nova instância do chaincode
-	chaincode, err := contractapi.NewChaincode(new(SmartContract))
+	// O contexto acumula os eventos emitidos em cada transação
+	contract := new(SmartContract)
+	contract.TransactionContextHandler = new(eventContext)
+
+	chaincode, err := contractapi.NewChaincode(contract)
 	if err != nil {
 		panic(fmt.Sprintf("erro criando chaincode: %v", err))
 	}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateTestKeepsPredictionProvenance(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("store")
+	if err := contract.StoreTest(ctx, "TEST-1", readTestFixture(t), ""); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("store")
+
+	stored, err := contract.GetTestByID(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Predições não podem ser enviadas pelo cliente
+	forged := map[string]interface{}{
+		"result_class": map[string]interface{}{"prediction": "negativo", "model_key": "result_class", "model_version": 99},
+	}
+	stub.MockTransactionStart("update")
+	if err := contract.UpdateTest(ctx, "TEST-1", fixtureWith(t, map[string]interface{}{"predictions": forged})); err == nil {
+		t.Error("predicoes enviadas pelo cliente deveriam ser rejeitadas")
+	}
+
+	// Os campos preditos podem ser corrigidos; a proveniência gravada pelo
+	// pipeline de ML é mantida
+	corrected := "positive"
+	if stored.ResultClass == corrected {
+		corrected = "negative"
+	}
+	if err := contract.UpdateTest(ctx, "TEST-1", fixtureWith(t, map[string]interface{}{"operator_id": "OP05", "result_class": corrected})); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("update")
+
+	updated, err := contract.GetTestByID(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.OperatorID != "OP05" || updated.Version != stored.Version+1 {
+		t.Errorf("atualizacao nao aplicada: %+v", updated)
+	}
+	if updated.ResultClass != corrected {
+		t.Errorf("result_class %q, esperado %q", updated.ResultClass, corrected)
+	}
+	if len(updated.Predictions) == 0 || !reflect.DeepEqual(updated.Predictions, stored.Predictions) {
+		t.Errorf("proveniencia alterada: %+v, esperada %+v", updated.Predictions, stored.Predictions)
+	}
+
+	// A correção também atualiza o índice de classe de resultado
+	results, err := contract.QueryTests(ctx, `{"result_class":"`+corrected+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].TestID != "TEST-1" {
+		t.Errorf("teste corrigido nao encontrado pela classe %s: %+v", corrected, results)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/sjwhitworth/golearn/trees"
+)
+
+// modelo ID3 já decodificado, junto com a versão e o hash de onde veio
+type cachedID3Model struct {
+	version     int
+	contentHash string
+	tree        *trees.ID3DecisionTree
+}
+
+/*
+	Cache de processo dos modelos ID3 decodificados.
+	Cada entrada é identificada pelo canal e pelo modelKey e só é
+	reutilizada enquanto a versão e o hash do conteúdo do modelo ativo
+	no ledger forem os mesmos; uma nova versão substitui a entrada
+*/
+type id3ModelCache struct {
+	mu      sync.RWMutex
+	entries map[string]*cachedID3Model
+}
+
+// Cache compartilhado por todas as transações do container
+var modelCache = &id3ModelCache{entries: map[string]*cachedID3Model{}}
+
+// Chave do cache: canal e modelKey separados por um byte nulo
+func modelCacheKey(channelID string, modelKey string) string {
+	return channelID + "\x00" + modelKey
+}
+
+// Retorna o modelo em cache se ainda corresponder à versão e ao hash informados
+func (c *id3ModelCache) get(key string, version int, contentHash string) *trees.ID3DecisionTree {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.version != version || entry.contentHash != contentHash {
+		return nil
+	}
+	return entry.tree
+}
+
+// Armazena (ou substitui) o modelo decodificado de uma chave
+func (c *id3ModelCache) put(key string, entry *cachedID3Model) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = entry
+}
+
+// Descarta todos os modelos em cache
+func (c *id3ModelCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*cachedID3Model{}
+}
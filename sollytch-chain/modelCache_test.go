@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestModelCacheReusesDecodedModel(t *testing.T) {
+	modelCache.reset()
+	_, stub, ctx := newTestContract(t)
+	contract := new(SmartContract)
+
+	stub.MockTransactionStart("load1")
+	first, stored, err := loadID3ModelFromLedger(ctx, contract, "result_class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := loadID3ModelFromLedger(ctx, contract, "result_class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("load1")
+
+	if first != second {
+		t.Fatal("modelo deveria ser reutilizado do cache")
+	}
+	if stored.ContentHash == "" {
+		t.Fatal("hash do conteudo deveria estar preenchido")
+	}
+}
+
+func TestModelCacheInvalidatedOnNewVersion(t *testing.T) {
+	modelCache.reset()
+	contract, stub, ctx := newTestContract(t)
+
+	stub.MockTransactionStart("load1")
+	first, stored, err := loadID3ModelFromLedger(ctx, contract, "result_class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("load1")
+
+	// Reenvia o mesmo conteúdo: o hash não muda, mas a versão ativa sim
+	modelBytes, err := os.ReadFile("modelos/result_class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionStart("store")
+	if err := contract.StoreModel(ctx, "result_class", base64.StdEncoding.EncodeToString(modelBytes)); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("store")
+
+	stub.MockTransactionStart("load2")
+	second, updated, err := loadID3ModelFromLedger(ctx, contract, "result_class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("load2")
+
+	if updated.Version == stored.Version {
+		t.Fatalf("versao ativa deveria mudar, continua %d", updated.Version)
+	}
+	if first == second {
+		t.Fatal("cache deveria ser invalidado pela nova versao do modelo")
+	}
+}
+
+// Executa StoreTest b.N vezes, opcionalmente esvaziando o cache a cada teste
+// para reproduzir o comportamento anterior (decodificação a cada chamada).
+//
+// Resultados de referência (go test -bench StoreTest -benchmem -count 3,
+// linux/amd64, Intel Xeon, 1 vCPU):
+//
+//	BenchmarkStoreTestSemCache  ~9.1 ms/op  1.90 MB/op  21787 allocs/op
+//	BenchmarkStoreTestComCache  ~2.5 ms/op  0.83 MB/op   6481 allocs/op
+func benchmarkStoreTest(b *testing.B, cold bool) {
+	contract, stub, ctx := newTestContract(b)
+	fixture := readTestFixture(b)
+	silenceStdout(b)
+	modelCache.reset()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if cold {
+			modelCache.reset()
+		}
+
+		txID := fmt.Sprintf("tx-%d", i)
+		stub.MockTransactionStart(txID)
+		if err := contract.StoreTest(ctx, fmt.Sprintf("TEST-%08d", i), fixture, ""); err != nil {
+			b.Fatal(err)
+		}
+		stub.MockTransactionEnd(txID)
+
+		// Esvazia o canal de eventos do MockStub, que bloqueia ao
+		// atingir sua capacidade de 100 eventos
+		for len(stub.ChaincodeEventsChannel) > 0 {
+			<-stub.ChaincodeEventsChannel
+		}
+	}
+}
+
+func BenchmarkStoreTestSemCache(b *testing.B) {
+	benchmarkStoreTest(b, true)
+}
+
+func BenchmarkStoreTestComCache(b *testing.B) {
+	benchmarkStoreTest(b, false)
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// metadados de treino informados no registro de uma versão de modelo
+type ModelMetadata struct {
+	DatasetHash string            `json:"dataset_hash"`
+	Accuracy    float64           `json:"accuracy"`
+	Params      map[string]string `json:"params,omitempty" metadata:",optional"`
+}
+
+// struct json de uma versão registrada de um modelo de machine learning
+type ModelVersion struct {
+	//trackers
+	CreatedAt  string `json:"created_at"`
+	Version    int    `json:"version"`
+	Active     bool   `json:"active"`
+
+	//chave de busca
+	ModelKey   string `json:"modelKey"`
+
+	//metadados de treino e identidade de quem registrou a versão
+	ContentHash string            `json:"content_hash"`
+	DatasetHash string            `json:"dataset_hash"`
+	Accuracy    float64           `json:"accuracy"`
+	Params      map[string]string `json:"params,omitempty" metadata:",optional"`
+	TrainerMSP  string            `json:"trainer_msp"`
+	Trainer     string            `json:"trainer"`
+
+	//conteudo (omitido nas listagens)
+	ModelData  string `json:"modelData,omitempty" metadata:",optional"`
+}
+
+// Cria a chave composta de uma versão de modelo, com a versão preenchida
+// com zeros para que a listagem por prefixo fique em ordem numérica
+func modelVersionKey(ctx contractapi.TransactionContextInterface, modelKey string, version int) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(
+		"modelo~versao",
+		[]string{modelKey, fmt.Sprintf("%09d", version)},
+	)
+}
+
+// Função que recupera uma versão registrada de um modelo (nil se não existir)
+func getModelVersion(ctx contractapi.TransactionContextInterface, modelKey string, version int) (*ModelVersion, error) {
+	versionKey, err := modelVersionKey(ctx, modelKey, version)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ctx.GetStub().GetState(versionKey)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var stored ModelVersion
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// Função que grava uma versão de modelo no registro
+func putModelVersion(ctx contractapi.TransactionContextInterface, model *ModelVersion) error {
+	versionKey, err := modelVersionKey(ctx, model.ModelKey, model.Version)
+	if err != nil {
+		return err
+	}
+
+	// O indicador de versão ativa é calculado na leitura
+	stored := *model
+	stored.Active = false
+
+	bytes, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(versionKey, bytes)
+}
+
+/*
+	Função que registra uma nova versão de um modelo.
+	A versão recebe o próximo número disponível e é gravada sob a sua
+	própria chave composta "modelo~versao", junto com o hash do conteúdo,
+	os metadados de treino e a identidade de quem a registrou.
+	Modelos gravados antes do registro são arquivados como versão própria
+	antes da nova, para que o rollback também os alcance
+*/
+func (s *SmartContract) registerModel(ctx contractapi.TransactionContextInterface, modelKey string, modelBase64 string, metadata ModelMetadata, activate bool) (*ModelVersion, error) {
+	// Valida se os parâmetros obrigatórios foram informados
+	if modelKey == "" || modelBase64 == "" {
+		return nil, fmt.Errorf("modelKey e modelData nao podem ser vazios")
+	}
+	if err := s.validateModelKey(ctx, modelKey); err != nil {
+		return nil, err
+	}
+
+	// Decodifica o conteúdo para validar o Base64 e calcular o hash do modelo
+	modelBytes, err := base64.StdEncoding.DecodeString(modelBase64)
+	if err != nil {
+		return nil, fmt.Errorf("modelData nao esta em Base64 valido: %v", err)
+	}
+	contentHash := sha256.Sum256(modelBytes)
+
+	// Descobre a maior versão já registrada
+	latest, err := s.latestModelVersion(ctx, modelKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Arquiva o modelo ativo legado caso ele ainda não esteja no registro
+	active, err := s.getActiveModel(ctx, modelKey)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		archived, err := getModelVersion(ctx, modelKey, active.Version)
+		if err != nil {
+			return nil, err
+		}
+		if archived == nil {
+			// Modelos legados podem não ter o hash do conteúdo registrado
+			if active.ContentHash == "" {
+				legacyBytes, err := base64.StdEncoding.DecodeString(active.ModelData)
+				if err != nil {
+					return nil, err
+				}
+				legacyHash := sha256.Sum256(legacyBytes)
+				active.ContentHash = hex.EncodeToString(legacyHash[:])
+			}
+
+			legacy := &ModelVersion{
+				ModelKey:    modelKey,
+				Version:     active.Version,
+				CreatedAt:   active.UpdatedAt,
+				ContentHash: active.ContentHash,
+				ModelData:   active.ModelData,
+			}
+			if err := putModelVersion(ctx, legacy); err != nil {
+				return nil, err
+			}
+		}
+		if active.Version > latest {
+			latest = active.Version
+		}
+	}
+
+	// Obtém o timestamp da transação atual
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+
+	// Identifica quem registrou o modelo
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	model := &ModelVersion{
+		ModelKey:    modelKey,
+		Version:     latest + 1,
+		CreatedAt:   time.Unix(txTime.Seconds, int64(txTime.Nanos)).UTC().Format(time.RFC3339),
+		ContentHash: hex.EncodeToString(contentHash[:]),
+		DatasetHash: metadata.DatasetHash,
+		Accuracy:    metadata.Accuracy,
+		Params:      metadata.Params,
+		TrainerMSP:  mspID,
+		Trainer:     subject,
+		ModelData:   modelBase64,
+	}
+
+	if err := putModelVersion(ctx, model); err != nil {
+		return nil, err
+	}
+
+	err = emitEvent(ctx, EventModelRegistered, &ModelEventData{
+		ModelKey:    model.ModelKey,
+		Version:     model.Version,
+		ContentHash: model.ContentHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if activate {
+		if err := s.activateModel(ctx, model); err != nil {
+			return nil, err
+		}
+		model.Active = true
+	}
+
+	return model, nil
+}
+
+// Função que retorna a maior versão registrada de um modelo (0 se nenhuma)
+func (s *SmartContract) latestModelVersion(ctx contractapi.TransactionContextInterface, modelKey string) (int, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("modelo~versao", []string{modelKey})
+	if err != nil {
+		return 0, err
+	}
+	defer iterator.Close()
+
+	latest := 0
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		_, parts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return 0, err
+		}
+
+		version, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, err
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+
+	return latest, nil
+}
+
+// Função que retorna o modelo ativo (usado pelo StoreTest) ou nil se não houver
+func (s *SmartContract) getActiveModel(ctx contractapi.TransactionContextInterface, modelKey string) (*ModelBytes, error) {
+	data, _, err := getModelState(ctx, modelKey)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar modelo existente: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var active ModelBytes
+	if err := json.Unmarshal(data, &active); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar modelo existente: %v", err)
+	}
+
+	return &active, nil
+}
+
+/*
+	Função que torna uma versão registrada o modelo ativo.
+	O modelo ativo é gravado na chave "modelo:<modelKey>", de forma que
+	StoreTest e as repredições sempre utilizam a versão promovida
+*/
+func (s *SmartContract) activateModel(ctx contractapi.TransactionContextInterface, model *ModelVersion) error {
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	active := ModelBytes{
+		ModelKey:    model.ModelKey,
+		ModelData:   model.ModelData,
+		ContentHash: model.ContentHash,
+		Version:     model.Version,
+		UpdatedAt: time.Unix(
+			txTime.Seconds,
+			int64(txTime.Nanos),
+		).UTC().Format(time.RFC3339),
+	}
+
+	bytes, err := json.Marshal(active)
+	if err != nil {
+		return err
+	}
+
+	// Um modelo ativo ainda na chave antiga é migrado nesta escrita
+	_, foundKey, err := getModelState(ctx, model.ModelKey)
+	if err != nil {
+		return err
+	}
+
+	if err := putStateMigrating(ctx, modelStateKey(model.ModelKey), foundKey, bytes); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventModelPromoted, &ModelEventData{
+		ModelKey:    model.ModelKey,
+		Version:     model.Version,
+		ContentHash: model.ContentHash,
+	})
+}
+
+/*
+	Função que registra uma nova versão de modelo com metadados de treino.
+	Recebe o modelo em Base64, um JSON com dataset_hash, accuracy e params
+	(parâmetros do algoritmo) e se a versão deve ser ativada imediatamente
+*/
+func (s *SmartContract) RegisterModel(ctx contractapi.TransactionContextInterface, modelKey string, modelBase64 string, metadataJSON string, activate bool) (*ModelVersion, error) {
+	// Apenas administradores podem alterar os modelos
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	var metadata ModelMetadata
+	if metadataJSON != "" {
+		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
+			return nil, fmt.Errorf("metadados invalidos: %v", err)
+		}
+	}
+
+	model, err := s.registerModel(ctx, modelKey, modelBase64, metadata, activate)
+	if err != nil {
+		return nil, err
+	}
+
+	// O conteúdo não é devolvido na resposta
+	model.ModelData = ""
+	return model, nil
+}
+
+// Função que lista todas as versões registradas de um modelo, sem o conteúdo
+func (s *SmartContract) ListModelVersions(ctx contractapi.TransactionContextInterface, modelKey string) ([]*ModelVersion, error) {
+	if err := s.validateModelKey(ctx, modelKey); err != nil {
+		return nil, err
+	}
+
+	active, err := s.getActiveModel(ctx, modelKey)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("modelo~versao", []string{modelKey})
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	var results []*ModelVersion
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var model ModelVersion
+		if err := json.Unmarshal(response.Value, &model); err != nil {
+			return nil, err
+		}
+
+		model.ModelData = ""
+		model.Active = active != nil && active.Version == model.Version
+		results = append(results, &model)
+	}
+
+	return results, nil
+}
+
+// Função que recupera uma versão específica de um modelo, incluindo o conteúdo em Base64
+func (s *SmartContract) GetModelVersion(ctx contractapi.TransactionContextInterface, modelKey string, version int) (*ModelVersion, error) {
+	if err := s.validateModelKey(ctx, modelKey); err != nil {
+		return nil, err
+	}
+
+	model, err := getModelVersion(ctx, modelKey, version)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, fmt.Errorf("versao %d do modelo %s nao encontrada", version, modelKey)
+	}
+
+	active, err := s.getActiveModel(ctx, modelKey)
+	if err != nil {
+		return nil, err
+	}
+	model.Active = active != nil && active.Version == model.Version
+
+	return model, nil
+}
+
+/*
+	Função que promove uma versão registrada a modelo ativo.
+	Serve tanto para colocar em produção uma versão registrada sem ativação
+	quanto para reverter para qualquer versão anterior sem reenviar os bytes
+*/
+func (s *SmartContract) PromoteModelVersion(ctx contractapi.TransactionContextInterface, modelKey string, version int) error {
+	// Apenas administradores podem alterar os modelos
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	if err := s.validateModelKey(ctx, modelKey); err != nil {
+		return err
+	}
+
+	model, err := getModelVersion(ctx, modelKey, version)
+	if err != nil {
+		return err
+	}
+	if model == nil {
+		return fmt.Errorf("versao %d do modelo %s nao encontrada", version, modelKey)
+	}
+
+	return s.activateModel(ctx, model)
+}
+
+/*
+	Função que reverte o modelo ativo para a versão registrada imediatamente
+	anterior a ele. Para voltar a uma versão específica utilize PromoteModelVersion
+*/
+func (s *SmartContract) RollbackModel(ctx contractapi.TransactionContextInterface, modelKey string) error {
+	// Apenas administradores podem alterar os modelos
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	versions, err := s.ListModelVersions(ctx, modelKey)
+	if err != nil {
+		return err
+	}
+
+	active, err := s.getActiveModel(ctx, modelKey)
+	if err != nil {
+		return err
+	}
+	if active == nil {
+		return fmt.Errorf("modelo %s nao encontrado", modelKey)
+	}
+
+	// As versões são listadas em ordem crescente
+	previous := 0
+	for _, version := range versions {
+		if version.Version < active.Version {
+			previous = version.Version
+		}
+	}
+	if previous == 0 {
+		return fmt.Errorf("modelo %s nao possui versao anterior para rollback", modelKey)
+	}
+
+	return s.PromoteModelVersion(ctx, modelKey, previous)
+}
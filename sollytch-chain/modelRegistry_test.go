@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestModelRegistryPromoteAndRollback(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	modelBytes, err := os.ReadFile("modelos/qc_status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelBase64 := base64.StdEncoding.EncodeToString(modelBytes)
+
+	stub.MockTransactionStart("registry")
+	defer stub.MockTransactionEnd("registry")
+
+	// Versão registrada sem ativação não substitui a ativa
+	registered, err := contract.RegisterModel(ctx, "qc_status", modelBase64, `{"dataset_hash":"abc","accuracy":0.93,"params":{"max_depth":"5"}}`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.Version != 2 || registered.Accuracy != 0.93 || registered.DatasetHash != "abc" || registered.ModelData != "" {
+		t.Errorf("versao registrada inesperada: %+v", registered)
+	}
+
+	activeVersion := func() int {
+		t.Helper()
+		versions, err := contract.ListModelVersions(ctx, "qc_status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		active := 0
+		for _, version := range versions {
+			if version.ModelData != "" {
+				t.Errorf("listagem nao deveria trazer o conteudo da versao %d", version.Version)
+			}
+			if version.Active {
+				active = version.Version
+			}
+		}
+		if len(versions) != 2 {
+			t.Errorf("esperadas 2 versoes, obtidas %d", len(versions))
+		}
+		return active
+	}
+
+	if active := activeVersion(); active != 1 {
+		t.Errorf("versao ativa %d, esperada 1", active)
+	}
+
+	if err := contract.PromoteModelVersion(ctx, "qc_status", 2); err != nil {
+		t.Fatal(err)
+	}
+	if active := activeVersion(); active != 2 {
+		t.Errorf("versao ativa %d apos promocao, esperada 2", active)
+	}
+
+	if err := contract.RollbackModel(ctx, "qc_status"); err != nil {
+		t.Fatal(err)
+	}
+	if active := activeVersion(); active != 1 {
+		t.Errorf("versao ativa %d apos rollback, esperada 1", active)
+	}
+	if err := contract.RollbackModel(ctx, "qc_status"); err == nil {
+		t.Error("rollback sem versao anterior deveria falhar")
+	}
+
+	version, err := contract.GetModelVersion(ctx, "qc_status", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Active || version.ModelData != modelBase64 || version.Params["max_depth"] != "5" {
+		t.Errorf("versao 2 inesperada: %+v", version)
+	}
+	if _, err := contract.GetModelVersion(ctx, "qc_status", 3); err == nil {
+		t.Error("versao inexistente deveria falhar")
+	}
+	if err := contract.PromoteModelVersion(ctx, "qc_status", 3); err == nil {
+		t.Error("promocao de versao inexistente deveria falhar")
+	}
+}
+
+func TestModelRegistryRequiresAdmin(t *testing.T) {
+	contract, stub, _ := newTestContract(t)
+	modelBase64 := base64.StdEncoding.EncodeToString([]byte("modelo"))
+
+	stub.MockTransactionStart("operador")
+	defer stub.MockTransactionEnd("operador")
+
+	// Administradores de outras organizações do canal também são recusados
+	stub.Creator = newTestCreator(t, "org2MSP", "admin", "admin")
+	otherAdmin := newTestContext(t, stub)
+	if _, err := contract.RegisterModel(otherAdmin, "qc_status", modelBase64, "", true); err == nil || !strings.Contains(err.Error(), "administradores de") {
+		t.Errorf("RegisterModel deveria recusar administradores de org2MSP, erro: %v", err)
+	}
+
+	stub.Creator = newTestCreator(t, "org1MSP", "operador")
+	operator := newTestContext(t, stub)
+
+	checks := map[string]error{
+		"StoreModel":          contract.StoreModel(operator, "qc_status", modelBase64),
+		"PromoteModelVersion": contract.PromoteModelVersion(operator, "qc_status", 1),
+		"RollbackModel":       contract.RollbackModel(operator, "qc_status"),
+	}
+	_, checks["RegisterModel"] = contract.RegisterModel(operator, "qc_status", modelBase64, "", true)
+
+	for name, err := range checks {
+		if err == nil || !strings.Contains(err.Error(), "administradores") {
+			t.Errorf("%s deveria ser restrito a administradores, erro: %v", name, err)
+		}
+	}
+
+	// As consultas continuam abertas a qualquer identidade
+	if _, err := contract.ListModelVersions(operator, "qc_status"); err != nil {
+		t.Error(err)
+	}
+}
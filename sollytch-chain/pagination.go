@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// envelope de uma página de testes
+type TestPage struct {
+	Records      []*TestRecord `json:"records"`
+	Bookmark     string        `json:"bookmark"`
+	FetchedCount int32         `json:"fetched_count"`
+}
+
+// envelope de uma página de planilhas
+type PlanilhaPage struct {
+	Records      []*LoteRecord `json:"records"`
+	Bookmark     string        `json:"bookmark"`
+	FetchedCount int32         `json:"fetched_count"`
+}
+
+/*
+	Função que retorna uma página dos testes associados a um lote.
+	Recebe o tamanho da página e o bookmark opaco devolvido pela página
+	anterior (vazio para a primeira página). Consultas paginadas só são
+	suportadas pelo Fabric em transações de leitura (evaluate)
+*/
+func (s *SmartContract) GetTestsByLotePaged(ctx contractapi.TransactionContextInterface, cassetteLot string, pageSize int32, bookmark string) (*TestPage, error) {
+	// Valida os parâmetros obrigatórios
+	if cassetteLot == "" {
+		return nil, fmt.Errorf("cassetteLot não pode ser vazio")
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("pageSize deve ser maior que zero")
+	}
+
+	// Busca uma página das chaves compostas associadas ao lote
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+		"lote~teste",
+		[]string{cassetteLot},
+		pageSize,
+		bookmark,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	page := &TestPage{Records: []*TestRecord{}}
+
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Separa os atributos da chave composta
+		_, parts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		// Recupera o teste individual pelo ID
+		test, err := s.GetTestByID(ctx, parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		page.Records = append(page.Records, test)
+	}
+
+	// Repassa o bookmark e a contagem informados pelo peer
+	page.Bookmark = metadata.GetBookmark()
+	page.FetchedCount = metadata.GetFetchedRecordsCount()
+
+	return page, nil
+}
+
+/*
+	Função que retorna uma página das planilhas associadas a um lote,
+	seguindo o mesmo contrato de paginação de GetTestsByLotePaged
+*/
+func (c *SmartContract) GetPlanilhasByLotePaged(ctx contractapi.TransactionContextInterface, casseteLot string, pageSize int32, bookmark string) (*PlanilhaPage, error) {
+	// Valida os parâmetros obrigatórios
+	if casseteLot == "" {
+		return nil, fmt.Errorf("casseteLot não pode ser vazio")
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("pageSize deve ser maior que zero")
+	}
+
+	// Busca uma página das chaves compostas associadas ao lote
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+		"lote~planilha",
+		[]string{casseteLot},
+		pageSize,
+		bookmark,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	page := &PlanilhaPage{Records: []*LoteRecord{}}
+
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Separa os atributos da chave composta
+		_, parts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		// Busca a planilha completa a partir do hash
+		planilha, err := c.GetPlanilhaByHash(ctx, parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		page.Records = append(page.Records, planilha)
+	}
+
+	// Repassa o bookmark e a contagem informados pelo peer
+	page.Bookmark = metadata.GetBookmark()
+	page.FetchedCount = metadata.GetFetchedRecordsCount()
+
+	return page, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGetTestsByLotePagedBookmarks(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("tests")
+	var expected []string
+	for i := 1; i <= 5; i++ {
+		testID := fmt.Sprintf("TEST-%d", i)
+		if err := contract.StoreTest(ctx, testID, fixture, ""); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, testID)
+	}
+	stub.MockTransactionEnd("tests")
+
+	ctx.SetStub(&pagingStub{stub})
+
+	// Percorre o lote em páginas de 2 repassando o bookmark
+	var ids []string
+	var counts []int32
+	bookmark := ""
+	for {
+		page, err := contract.GetTestsByLotePaged(ctx, "C22009", 2, bookmark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range page.Records {
+			ids = append(ids, record.TestID)
+		}
+		counts = append(counts, page.FetchedCount)
+
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("testes paginados %v, esperados %v", ids, expected)
+	}
+	if !reflect.DeepEqual(counts, []int32{2, 2, 1}) {
+		t.Errorf("fetched_count por pagina %v, esperado [2 2 1]", counts)
+	}
+
+	// Lote sem testes devolve uma página vazia, não nula
+	page, err := contract.GetTestsByLotePaged(ctx, "C00000", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Records == nil || len(page.Records) != 0 || page.FetchedCount != 0 {
+		t.Errorf("pagina inesperada para lote vazio: %+v", page)
+	}
+
+	for _, pageSize := range []int32{0, -1} {
+		if _, err := contract.GetTestsByLotePaged(ctx, "C22009", pageSize, ""); err == nil {
+			t.Errorf("pageSize %d deveria ser rejeitado", pageSize)
+		}
+	}
+	if _, err := contract.GetTestsByLotePaged(ctx, "", 2, ""); err == nil {
+		t.Error("lote vazio deveria ser rejeitado")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// struct json de uma versão da planilha no histórico
+type PlanilhaHistoryEntry struct {
+	TxID      string      `json:"tx_id"`
+	Timestamp string      `json:"timestamp"`
+	IsDelete  bool        `json:"is_delete"`
+	Record    *LoteRecord `json:"record,omitempty" metadata:",optional"`
+}
+
+/*
+	Função que retorna o histórico de gravações de uma planilha, em ordem
+	cronológica, com o txID e o timestamp de cada transação. A primeira
+	entrada identifica a transação em que o hash foi ancorado no ledger
+*/
+func (c *SmartContract) GetPlanilhaHistory(ctx contractapi.TransactionContextInterface, hashPlanilha string) ([]*PlanilhaHistoryEntry, error) {
+	// Valida se recebeu o hashPlanilha
+	if hashPlanilha == "" {
+		return nil, fmt.Errorf("hashPlanilha não pode ser vazio")
+	}
+
+	planilhaKey, err := resolveHashKey(planilhaNamespace, hashPlanilha)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inclui as versões gravadas na chave antiga (o hash puro), de forma
+	// que a primeira entrada continue sendo a do ancoramento original
+	modifications, err := getHistoryWithLegacy(ctx, planilhaKey, hashPlanilha, planilhaNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*PlanilhaHistoryEntry{}
+	times := map[*PlanilhaHistoryEntry]time.Time{}
+
+	for _, modification := range modifications {
+		entry := &PlanilhaHistoryEntry{
+			TxID:      modification.TxID,
+			Timestamp: modification.Time.Format(time.RFC3339Nano),
+			IsDelete:  modification.IsDelete,
+		}
+
+		// Versões removidas não possuem valor associado
+		if !modification.IsDelete {
+			var asset LoteRecord
+			if err := json.Unmarshal(modification.Value, &asset); err != nil {
+				return nil, fmt.Errorf("erro ao deserializar versão %s: %v", modification.TxID, err)
+			}
+			entry.Record = &asset
+		}
+
+		results = append(results, entry)
+		times[entry] = modification.Time
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("planilha %s não encontrada", hashPlanilha)
+	}
+
+	// Ordena cronologicamente, desempatando pela versão do registro
+	sort.SliceStable(results, func(i, j int) bool {
+		ti, tj := times[results[i]], times[results[j]]
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		if results[i].Record != nil && results[j].Record != nil {
+			return results[i].Record.Version < results[j].Record.Version
+		}
+		return false
+	})
+
+	return results, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// variável-alvo predita por um modelo de machine learning
+type PredictionTarget struct {
+	// nome da variável-alvo, usado também como modelKey do modelo
+	Target        string `json:"target"`
+	// colunas de features (campos json do teste) na ordem usada no treino
+	FeatureHeader string `json:"feature_header"`
+	// campo json do teste que recebe a predição (vazio: apenas em predictions)
+	RecordField   string `json:"record_field"`
+}
+
+// struct json da configuração de predição armazenada no ledger
+type PredictionConfig struct {
+	//trackers
+	Version      int    `json:"version"`
+	UpdatedAt    string `json:"updated_at"`
+	UpdatedByMSP string `json:"updated_by_msp"`
+	UpdatedBy    string `json:"updated_by"`
+
+	//conteudo (variáveis-alvo na ordem de execução)
+	Targets      []PredictionTarget `json:"targets"`
+}
+
+/*
+	Campos do teste que podem receber predições. Os demais campos são
+	entradas do teste, índices de busca ou metadados controlados pelo ledger
+*/
+var predictionRecordFields = map[string]bool{
+	"acao_recomendada": true,
+	"result_class":     true,
+	"qc_status":        true,
+}
+
+// Configuração usada enquanto nenhuma outra for gravada no ledger
+func defaultPredictionConfig() *PredictionConfig {
+	return &PredictionConfig{
+		Targets: []PredictionTarget{
+			{Target: "acao_recomendada", FeatureHeader: baseHeader, RecordField: "acao_recomendada"},
+			{Target: "result_class", FeatureHeader: baseHeader, RecordField: "result_class"},
+			{Target: "qc_status", FeatureHeader: baseHeader, RecordField: "qc_status"},
+		},
+	}
+}
+
+// Cria a chave composta sob a qual a configuração de predição é armazenada
+func predictionConfigKey(ctx contractapi.TransactionContextInterface) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("config", []string{"predicao"})
+}
+
+// Retorna a variável-alvo configurada com o nome informado
+func (config *PredictionConfig) target(name string) (*PredictionTarget, bool) {
+	for i := range config.Targets {
+		if config.Targets[i].Target == name {
+			return &config.Targets[i], true
+		}
+	}
+	return nil, false
+}
+
+/*
+	Função que valida uma configuração de predição: nomes de variáveis-alvo
+	únicos e sem vírgulas, cabeçalhos compostos apenas por campos numéricos,
+	booleanos ou categóricos codificados do teste e campos de destino
+	restritos aos campos de predição (predictionRecordFields)
+*/
+func validatePredictionConfig(config *PredictionConfig) error {
+	if len(config.Targets) == 0 {
+		return fmt.Errorf("a configuracao deve declarar ao menos uma variavel-alvo")
+	}
+
+	seenTargets := map[string]bool{}
+	seenFields := map[string]bool{}
+
+	for _, target := range config.Targets {
+		if target.Target == "" || strings.ContainsAny(target.Target, ",~ ") {
+			return fmt.Errorf("nome de variavel-alvo invalido: %q", target.Target)
+		}
+		if seenTargets[target.Target] {
+			return fmt.Errorf("variavel-alvo %s declarada mais de uma vez", target.Target)
+		}
+		seenTargets[target.Target] = true
+
+		// Cabeçalho: colunas únicas, existentes e codificáveis
+		if target.FeatureHeader == "" {
+			return fmt.Errorf("feature_header da variavel-alvo %s nao pode ser vazio", target.Target)
+		}
+		seenColumns := map[string]bool{}
+		for _, column := range strings.Split(target.FeatureHeader, ",") {
+			if seenColumns[column] {
+				return fmt.Errorf("coluna %s repetida no feature_header de %s", column, target.Target)
+			}
+			seenColumns[column] = true
+
+			if column == target.Target || column == target.RecordField {
+				return fmt.Errorf("feature_header de %s nao pode conter a propria variavel-alvo", target.Target)
+			}
+		}
+		if _, err := buildFeatureRow(&TestRecord{}, target.FeatureHeader); err != nil {
+			return fmt.Errorf("feature_header de %s invalido: %v", target.Target, err)
+		}
+
+		// Campo de destino é opcional
+		if target.RecordField == "" {
+			continue
+		}
+		if !predictionRecordFields[target.RecordField] {
+			return fmt.Errorf("record_field %s de %s invalido, esperado um de: %s", target.RecordField, target.Target, strings.Join(sortedKeys(predictionRecordFields), ", "))
+		}
+		if seenFields[target.RecordField] {
+			return fmt.Errorf("record_field %s usado por mais de uma variavel-alvo", target.RecordField)
+		}
+		seenFields[target.RecordField] = true
+	}
+
+	return nil
+}
+
+/*
+	Função que recupera a configuração de predição do ledger.
+	Enquanto nenhuma configuração for gravada, retorna a configuração
+	padrão com acao_recomendada, result_class e qc_status sobre baseHeader
+*/
+func (s *SmartContract) getPredictionConfig(ctx contractapi.TransactionContextInterface) (*PredictionConfig, error) {
+	key, err := predictionConfigKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if configBytes == nil {
+		return defaultPredictionConfig(), nil
+	}
+
+	var config PredictionConfig
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Grava a predição no campo do teste configurado para a variável-alvo
+func setRecordField(record *TestRecord, fieldName string, value string) {
+	if fieldName == "" {
+		return
+	}
+	index, ok := testRecordFieldIndexes()[fieldName]
+	if !ok {
+		return
+	}
+	reflect.ValueOf(record).Elem().Field(index).SetString(value)
+}
+
+// Permite apenas chaves de modelo declaradas na configuração de predição
+func (s *SmartContract) validateModelKey(ctx contractapi.TransactionContextInterface, modelKey string) error {
+	config, err := s.getPredictionConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := config.target(modelKey); !ok {
+		return fmt.Errorf("modelKey invalido: %s nao esta na configuracao de predicao", modelKey)
+	}
+	return nil
+}
+
+/*
+	Função que consulta a configuração de predição vigente:
+	variáveis-alvo, cabeçalho de features de cada uma e o campo
+	do teste que recebe cada predição
+*/
+func (s *SmartContract) GetPredictionConfig(ctx contractapi.TransactionContextInterface) (*PredictionConfig, error) {
+	return s.getPredictionConfig(ctx)
+}
+
+/*
+	Função que substitui a configuração de predição no ledger.
+	Recebe um JSON com a lista "targets" (target, feature_header e
+	record_field). Restrita a administradores; a versão, a data e a
+	identidade de quem alterou são controladas pelo ledger.
+	Os modelos das novas variáveis-alvo devem ser enviados com
+	StoreModel antes do próximo StoreTest
+*/
+func (s *SmartContract) SetPredictionConfig(ctx contractapi.TransactionContextInterface, configJSON string) error {
+	// Apenas administradores podem alterar a configuração
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	var config PredictionConfig
+	decoder := json.NewDecoder(strings.NewReader(configJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("configuracao invalida: %v", err)
+	}
+	if err := validatePredictionConfig(&config); err != nil {
+		return err
+	}
+
+	current, err := s.getPredictionConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Obtém timestamp da transação atual
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	config.Version = current.Version + 1
+	config.UpdatedAt = time.Unix(
+		txTime.Seconds,
+		int64(txTime.Nanos),
+	).UTC().Format(time.RFC3339)
+	config.UpdatedByMSP = mspID
+	config.UpdatedBy = subject
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	key, err := predictionConfigKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(key, configBytes); err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, EventPredictionConfigChanged, &ConfigEventData{Version: config.Version})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePredictionConfig(t *testing.T) {
+	accepted := []PredictionConfig{
+		*defaultPredictionConfig(),
+		{Targets: []PredictionTarget{
+			{Target: "result_class", FeatureHeader: "lat,lon,sample_pH,control_line_ok,controle_interno_result", RecordField: "result_class"},
+			// Sem campo de destino a predição fica apenas em predictions
+			{Target: "risco", FeatureHeader: baseHeader},
+		}},
+	}
+	for _, config := range accepted {
+		if err := validatePredictionConfig(&config); err != nil {
+			t.Errorf("configuracao %+v deveria ser aceita: %v", config.Targets, err)
+		}
+	}
+
+	rejected := []struct {
+		target  PredictionTarget
+		message string
+	}{
+		{PredictionTarget{Target: "risco,alto", FeatureHeader: baseHeader}, "nome de variavel-alvo invalido"},
+		{PredictionTarget{Target: "risco"}, "feature_header"},
+		{PredictionTarget{Target: "risco", FeatureHeader: "lat,lat"}, "repetida"},
+		{PredictionTarget{Target: "risco", FeatureHeader: "lat,operator_id"}, "invalido"},
+		{PredictionTarget{Target: "qc_status", FeatureHeader: "lat,qc_status", RecordField: "qc_status"}, "propria variavel-alvo"},
+	}
+	// Campos de entrada, de busca e de controle não recebem predições
+	for _, field := range []string{"operator_id", "reagent_lot", "produto_id", "matrix_type", "timestamp", "geo_hash", "cassette_lot", "test_id", "version", "campo_inexistente"} {
+		rejected = append(rejected, struct {
+			target  PredictionTarget
+			message string
+		}{PredictionTarget{Target: "risco", FeatureHeader: "lat,lon", RecordField: field}, "record_field " + field})
+	}
+	for _, c := range rejected {
+		err := validatePredictionConfig(&PredictionConfig{Targets: []PredictionTarget{c.target}})
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("alvo %+v: erro %v, esperado contendo %q", c.target, err, c.message)
+		}
+	}
+
+	duplicated := []PredictionConfig{
+		{},
+		{Targets: []PredictionTarget{{Target: "risco", FeatureHeader: "lat"}, {Target: "risco", FeatureHeader: "lon"}}},
+		{Targets: []PredictionTarget{{Target: "a", FeatureHeader: "lat", RecordField: "qc_status"}, {Target: "b", FeatureHeader: "lon", RecordField: "qc_status"}}},
+	}
+	for _, config := range duplicated {
+		if err := validatePredictionConfig(&config); err == nil {
+			t.Errorf("configuracao %+v deveria ser rejeitada", config.Targets)
+		}
+	}
+}
+
+func TestSetPredictionConfig(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	stub.MockTransactionStart("config")
+	defer stub.MockTransactionEnd("config")
+
+	config := `{"targets":[{"target":"result_class","feature_header":"lat,lon,sample_pH","record_field":"result_class"}]}`
+	if err := contract.SetPredictionConfig(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := contract.GetPredictionConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != 1 || len(stored.Targets) != 1 || stored.Targets[0].FeatureHeader != "lat,lon,sample_pH" {
+		t.Errorf("configuracao gravada inesperada: %+v", stored)
+	}
+
+	if err := contract.SetPredictionConfig(ctx, `{"targets":[{"target":"result_class","feature_header":"lat","record_field":"operator_id"}]}`); err == nil {
+		t.Error("record_field fora da lista de predicoes deveria ser rejeitado")
+	}
+
+	stub.Creator = newTestCreator(t, "org1MSP", "operador")
+	operator := newTestContext(t, stub)
+	if err := contract.SetPredictionConfig(operator, config); err == nil || !strings.Contains(err.Error(), "administradores") {
+		t.Errorf("configuracao por nao administrador deveria falhar: %v", err)
+	}
+}
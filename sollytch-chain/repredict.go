@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+	Função que reexecuta as predições de um teste já carregado e persiste
+	a nova versão. As features são reconstruídas a partir dos campos
+	armazenados no próprio teste e os modelos já devem estar carregados
+*/
+func (s *SmartContract) repredict(ctx contractapi.TransactionContextInterface, existing *TestRecord, models []*predictionModel) error {
+	// Trabalha sobre uma cópia para preservar a versão anterior nos índices
+	updated := *existing
+
+	if err := applyPredictions(&updated, models); err != nil {
+		return fmt.Errorf("erro ao repredizer teste %s: %v", existing.TestID, err)
+	}
+
+	// Obtém timestamp da transação atual
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	// Identifica quem solicitou a nova predição
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Atualiza os metadados controlados pelo ledger
+	updated.Version = existing.Version + 1
+	updated.LastUpdatedAt = time.Unix(
+		txTime.Seconds,
+		int64(txTime.Nanos),
+	).UTC().Format(time.RFC3339)
+	updated.LastUpdatedByMSP = mspID
+	updated.LastUpdatedBy = subject
+
+	// A classe de resultado pode mudar, então os índices são atualizados
+	if err := updateTestIndexes(ctx, existing, &updated); err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+
+	// Um teste ainda na chave antiga é migrado nesta escrita
+	_, foundKey, err := getTestState(ctx, updated.TestID)
+	if err != nil {
+		return err
+	}
+
+	if err := putStateMigrating(ctx, testStateKey(updated.TestID), foundKey, bytes); err != nil {
+		return err
+	}
+
+	return emitTestEvent(ctx, EventTestRepredicted, &updated)
+}
+
+/*
+	Função que reexecuta as predições de um teste com os modelos atuais.
+	Recarrega do ledger os modelos das variáveis-alvo configuradas,
+	recalcula as predições a partir dos campos armazenados e registra
+	a versão de cada modelo utilizada. Útil após o retreino dos modelos.
+	Restrita a administradores
+*/
+func (s *SmartContract) RepredictTest(ctx contractapi.TransactionContextInterface, testID string) error {
+	// Apenas administradores podem reescrever as predições
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	// Busca o teste existente no ledger
+	existing, err := s.GetTestByID(ctx, testID)
+	if err != nil {
+		return err
+	}
+
+	// Carrega os modelos atuais
+	models, err := s.loadPredictionModels(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.repredict(ctx, existing, models)
+}
+
+// Maior número de testes repredito por chamada de RepredictLote
+const maxRepredictPageSize = 100
+
+// resultado de uma página de RepredictLote
+type RepredictPage struct {
+	TestIDs      []string `json:"test_ids"`
+	Bookmark     string   `json:"bookmark"`
+	FetchedCount int32    `json:"fetched_count"`
+}
+
+/*
+	Função que reexecuta as predições dos testes de um lote, uma página
+	por transação. Os modelos são carregados uma única vez e aplicados a
+	até pageSize testes (no máximo maxRepredictPageSize) do índice
+	"lote~teste", a partir do bookmark devolvido pela página anterior
+	(vazio para a primeira). O bookmark retornado fica vazio quando todo
+	o lote foi processado. Restrita a administradores.
+
+	Consultas paginadas do Fabric só valem em transações de leitura, então
+	o índice é percorrido por completo e o bookmark é o ID do próximo teste
+*/
+func (s *SmartContract) RepredictLote(ctx contractapi.TransactionContextInterface, cassetteLot string, pageSize int32, bookmark string) (*RepredictPage, error) {
+	// Apenas administradores podem reescrever as predições
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	// Valida os parâmetros obrigatórios
+	if cassetteLot == "" {
+		return nil, fmt.Errorf("cassetteLot não pode ser vazio")
+	}
+	if pageSize <= 0 || pageSize > maxRepredictPageSize {
+		return nil, fmt.Errorf("pageSize deve estar entre 1 e %d", maxRepredictPageSize)
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("lote~teste", []string{cassetteLot})
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	// Separa os testes da página e o primeiro teste da página seguinte
+	page := &RepredictPage{TestIDs: []string{}}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, parts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		testID := parts[1]
+		if testID < bookmark {
+			continue
+		}
+		if int32(len(page.TestIDs)) == pageSize {
+			page.Bookmark = testID
+			break
+		}
+		page.TestIDs = append(page.TestIDs, testID)
+	}
+
+	if len(page.TestIDs) == 0 {
+		if bookmark == "" {
+			return nil, fmt.Errorf("nenhum teste encontrado para o lote %s", cassetteLot)
+		}
+		return page, nil
+	}
+
+	// Carrega os modelos atuais uma única vez
+	models, err := s.loadPredictionModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, testID := range page.TestIDs {
+		test, err := s.GetTestByID(ctx, testID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.repredict(ctx, test, models); err != nil {
+			return nil, err
+		}
+	}
+
+	page.FetchedCount = int32(len(page.TestIDs))
+
+	return page, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepredictTestRecordsProvenance(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("store")
+	if err := contract.StoreTest(ctx, "TEST-1", fixture, ""); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("store")
+
+	// Retreino: uma nova versão do modelo result_class passa a ser a ativa
+	modelBytes, err := os.ReadFile("modelos/result_class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionStart("model")
+	if err := contract.StoreModel(ctx, "result_class", base64.StdEncoding.EncodeToString(modelBytes)); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("model")
+
+	stub.MockTransactionStart("repredict")
+	if err := contract.RepredictTest(ctx, "TEST-1"); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("repredict")
+
+	record, err := contract.GetTestByID(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Version != 1 || record.LastUpdatedByMSP != "org1MSP" {
+		t.Errorf("metadados inesperados: versao %d, msp %s", record.Version, record.LastUpdatedByMSP)
+	}
+
+	digest := sha256.Sum256(modelBytes)
+	expectedVersions := map[string]int{"acao_recomendada": 1, "result_class": 2, "qc_status": 1}
+	for target, version := range expectedVersions {
+		prediction, ok := record.Predictions[target]
+		if !ok {
+			t.Errorf("predicao %s sem proveniencia", target)
+			continue
+		}
+		if prediction.ModelKey != target || prediction.ModelVersion != version || prediction.FeatureRow != fixtureFeatureRow {
+			t.Errorf("proveniencia inesperada de %s: %+v", target, prediction)
+		}
+		if target == "result_class" && prediction.ModelHash != hex.EncodeToString(digest[:]) {
+			t.Errorf("hash do modelo %s, esperado %x", prediction.ModelHash, digest)
+		}
+	}
+	if record.ResultClass != record.Predictions["result_class"].Prediction {
+		t.Errorf("result_class %q diverge da predicao %q", record.ResultClass, record.Predictions["result_class"].Prediction)
+	}
+
+	if events := decodeEvents(t, lastEvent(t, stub)); events[0]["type"] != EventTestRepredicted {
+		t.Errorf("eventos inesperados %v", events)
+	}
+}
+
+func TestRepredictLotePages(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("store")
+	var expected []string
+	for i := 1; i <= 5; i++ {
+		testID := fmt.Sprintf("TEST-%d", i)
+		if err := contract.StoreTest(ctx, testID, fixture, ""); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, testID)
+	}
+	stub.MockTransactionEnd("store")
+
+	// Cada página é uma transação, continuada pelo bookmark da anterior
+	var processed []string
+	var counts []int32
+	bookmark := ""
+	for i := 0; ; i++ {
+		txID := fmt.Sprintf("repredict-%d", i)
+		stub.MockTransactionStart(txID)
+		page, err := contract.RepredictLote(ctx, "C22009", 2, bookmark)
+		stub.MockTransactionEnd(txID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		processed = append(processed, page.TestIDs...)
+		counts = append(counts, page.FetchedCount)
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+
+	if !reflect.DeepEqual(processed, expected) || !reflect.DeepEqual(counts, []int32{2, 2, 1}) {
+		t.Errorf("paginas inesperadas: testes %v, contagens %v", processed, counts)
+	}
+	for _, testID := range expected {
+		record, err := contract.GetTestByID(ctx, testID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Version != 1 {
+			t.Errorf("%s deveria ter sido repredito uma vez, versao %d", testID, record.Version)
+		}
+	}
+
+	stub.MockTransactionStart("invalid")
+	defer stub.MockTransactionEnd("invalid")
+	for _, pageSize := range []int32{0, maxRepredictPageSize + 1} {
+		if _, err := contract.RepredictLote(ctx, "C22009", pageSize, ""); err == nil {
+			t.Errorf("pageSize %d deveria ser rejeitado", pageSize)
+		}
+	}
+	if _, err := contract.RepredictLote(ctx, "C00000", 2, ""); err == nil {
+		t.Error("lote sem testes deveria falhar")
+	}
+}
+
+func TestRepredictRequiresAdmin(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("store")
+	if err := contract.StoreTest(ctx, "TEST-1", readTestFixture(t), ""); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("store")
+
+	stub.MockTransactionStart("operador")
+	defer stub.MockTransactionEnd("operador")
+
+	stub.Creator = newTestCreator(t, "org1MSP", "operador")
+	operator := newTestContext(t, stub)
+
+	checks := map[string]error{"RepredictTest": contract.RepredictTest(operator, "TEST-1")}
+	_, checks["RepredictLote"] = contract.RepredictLote(operator, "C22009", 10, "")
+
+	for name, err := range checks {
+		if err == nil || !strings.Contains(err.Error(), "administradores") {
+			t.Errorf("%s deveria ser restrito a administradores, erro: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+/*
+	Namespaces das chaves principais. Testes, planilhas e modelos
+	compartilham o mesmo espaço de chaves simples, então cada tipo de
+	registro recebe um prefixo próprio ("teste:<id>", "modelo:<chave>",
+	"planilha:<algoritmo>:<hex>"). Registros gravados antes dos prefixos
+	continuam legíveis pela chave antiga até a execução de MigrateStateKeys
+*/
+const (
+	testeNamespace  = "teste"
+	modeloNamespace = "modelo"
+)
+
+// Maior chave simples possível, usada como fim da varredura da migração
+var maxStateKey = string(utf8.MaxRune)
+
+// Chave principal de um teste, ex.: "teste:TEST-1"
+func testStateKey(testID string) string {
+	return testeNamespace + ":" + testID
+}
+
+// Chave principal do modelo ativo, ex.: "modelo:acao_recomendada"
+func modelStateKey(modelKey string) string {
+	return modeloNamespace + ":" + modelKey
+}
+
+// Indica se a chave já pertence a um dos namespaces
+func isNamespacedKey(key string) bool {
+	for _, namespace := range []string{testeNamespace, modeloNamespace, planilhaNamespace} {
+		if strings.HasPrefix(key, namespace+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// campos usados para identificar o tipo de um registro gravado sem namespace
+type legacyRecordProbe struct {
+	TestID       *string `json:"test_id"`
+	HashPlanilha *string `json:"hash_planilha"`
+	ModelKey     *string `json:"modelKey"`
+}
+
+// Identifica o tipo de um registro antigo ("teste", "planilha", "modelo" ou
+// vazio). O registro só pertence ao tipo se o seu campo de chave for a
+// própria chave, evitando confundir um teste com um modelo de mesmo nome
+func legacyRecordType(key string, value []byte) string {
+	var probe legacyRecordProbe
+	if err := json.Unmarshal(value, &probe); err != nil {
+		return ""
+	}
+
+	switch {
+	case probe.TestID != nil && *probe.TestID == key:
+		return testeNamespace
+	case probe.ModelKey != nil && *probe.ModelKey == key:
+		return modeloNamespace
+	case probe.HashPlanilha != nil && strings.EqualFold(*probe.HashPlanilha, key):
+		return planilhaNamespace
+	}
+	return ""
+}
+
+/*
+	Função que lê um registro pela chave com namespace e, durante a transição,
+	pela chave antiga (sem prefixo). O valor da chave antiga só é aceito se
+	for do tipo esperado. Retorna o valor e a chave em que foi encontrado
+*/
+func getStateWithLegacy(ctx contractapi.TransactionContextInterface, key string, legacyKey string, recordType string) ([]byte, string, error) {
+	data, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if data != nil || legacyKey == "" || legacyKey == key {
+		return data, key, nil
+	}
+
+	legacy, err := ctx.GetStub().GetState(legacyKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if legacy == nil || legacyRecordType(legacyKey, legacy) != recordType {
+		return nil, key, nil
+	}
+
+	return legacy, legacyKey, nil
+}
+
+/*
+	Função que grava um registro na chave com namespace e remove a cópia
+	antiga, quando o registro foi lido da chave sem prefixo. Assim cada
+	escrita durante a transição também migra o registro
+*/
+func putStateMigrating(ctx contractapi.TransactionContextInterface, key string, foundKey string, value []byte) error {
+	if err := ctx.GetStub().PutState(key, value); err != nil {
+		return err
+	}
+	if foundKey != "" && foundKey != key {
+		return ctx.GetStub().DelState(foundKey)
+	}
+	return nil
+}
+
+// Lê um teste pela chave "teste:<id>" ou pela chave antiga (o próprio testID)
+func getTestState(ctx contractapi.TransactionContextInterface, testID string) ([]byte, string, error) {
+	return getStateWithLegacy(ctx, testStateKey(testID), testID, testeNamespace)
+}
+
+// Lê o modelo ativo pela chave "modelo:<chave>" ou pela chave antiga
+func getModelState(ctx contractapi.TransactionContextInterface, modelKey string) ([]byte, string, error) {
+	return getStateWithLegacy(ctx, modelStateKey(modelKey), modelKey, modeloNamespace)
+}
+
+/*
+	Lê uma planilha pela chave "planilha:<algoritmo>:<hex>" ou pela chave
+	antiga, que era o hash exatamente como enviado pelo cliente
+*/
+func getPlanilhaState(ctx contractapi.TransactionContextInterface, hashPlanilha string) ([]byte, string, error) {
+	planilhaKey, err := resolveHashKey(planilhaNamespace, hashPlanilha)
+	if err != nil {
+		return nil, "", err
+	}
+	return getStateWithLegacy(ctx, planilhaKey, hashPlanilha, planilhaNamespace)
+}
+
+// chave que não pôde ser migrada e o motivo
+type SkippedKey struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// resultado de uma execução de MigrateStateKeys
+type KeyMigrationResult struct {
+	Tests        int           `json:"tests"`
+	Planilhas    int           `json:"planilhas"`
+	Models       int           `json:"models"`
+	Skipped      []*SkippedKey `json:"skipped"`
+	NextStartKey string        `json:"next_start_key"`
+	Done         bool          `json:"done"`
+}
+
+// registro da conclusão da migração de chaves
+type KeyMigrationMarker struct {
+	CompletedAt    string `json:"completed_at"`
+	CompletedByMSP string `json:"completed_by_msp"`
+	CompletedBy    string `json:"completed_by"`
+}
+
+// Cria a chave composta do registro de conclusão da migração
+func keyMigrationMarkerKey(ctx contractapi.TransactionContextInterface) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("config", []string{"migracao_chaves"})
+}
+
+/*
+	Função que migra, uma única vez, os registros gravados sem namespace
+	(testes pelo testID, planilhas pelo hash e modelos ativos pela chave
+	do modelo) para as chaves com prefixo. Restrita a administradores.
+	A varredura começa em startKey (vazio na primeira chamada) e processa
+	no máximo limit chaves; enquanto done for false, a chamada seguinte deve
+	usar o next_start_key devolvido. Ao final da varredura a migração é
+	marcada como concluída e não pode ser executada novamente.
+	Registros cujo tipo não é reconhecido são mantidos e listados em skipped
+*/
+func (s *SmartContract) MigrateStateKeys(ctx contractapi.TransactionContextInterface, startKey string, limit int) (*KeyMigrationResult, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit deve ser maior que zero")
+	}
+
+	markerKey, err := keyMigrationMarkerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	marker, err := ctx.GetStub().GetState(markerKey)
+	if err != nil {
+		return nil, err
+	}
+	if marker != nil {
+		return nil, fmt.Errorf("migracao de chaves ja concluida")
+	}
+
+	iterator, err := ctx.GetStub().GetStateByRange(startKey, maxStateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &KeyMigrationResult{Skipped: []*SkippedKey{}}
+
+	// As chaves são lidas antes de migrar, para não alterar o estado
+	// durante a iteração
+	var legacy []*queryresult.KV
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Chaves compostas e chaves já migradas ficam como estão
+		if strings.HasPrefix(response.Key, "\x00") || isNamespacedKey(response.Key) {
+			continue
+		}
+
+		if len(legacy) == limit {
+			result.NextStartKey = response.Key
+			break
+		}
+		legacy = append(legacy, response)
+	}
+	iterator.Close()
+
+	for _, response := range legacy {
+		if err := s.migrateLegacyKey(ctx, response.Key, response.Value, result); err != nil {
+			return nil, err
+		}
+	}
+	if result.NextStartKey != "" {
+		if err := emitMigrationEvent(ctx, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	// Varredura completa: registra a conclusão da migração
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	markerBytes, err := json.Marshal(KeyMigrationMarker{
+		CompletedAt: time.Unix(
+			txTime.Seconds,
+			int64(txTime.Nanos),
+		).UTC().Format(time.RFC3339),
+		CompletedByMSP: mspID,
+		CompletedBy:    subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().PutState(markerKey, markerBytes); err != nil {
+		return nil, err
+	}
+
+	result.Done = true
+	if err := emitMigrationEvent(ctx, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Emite o evento com as contagens de uma página da migração de chaves
+func emitMigrationEvent(ctx contractapi.TransactionContextInterface, result *KeyMigrationResult) error {
+	return emitEvent(ctx, EventStateKeysMigrated, &StateKeysMigratedEventData{
+		Tests:     result.Tests,
+		Planilhas: result.Planilhas,
+		Models:    result.Models,
+		Done:      result.Done,
+	})
+}
+
+// Função que move um registro antigo para a chave com namespace do seu tipo
+func (s *SmartContract) migrateLegacyKey(ctx contractapi.TransactionContextInterface, key string, value []byte, result *KeyMigrationResult) error {
+	recordType := legacyRecordType(key, value)
+
+	var newKey string
+	switch recordType {
+	case testeNamespace:
+		newKey = testStateKey(key)
+	case modeloNamespace:
+		newKey = modelStateKey(key)
+	case planilhaNamespace:
+		var err error
+		if newKey, err = resolveHashKey(planilhaNamespace, key); err != nil {
+			result.Skipped = append(result.Skipped, &SkippedKey{Key: key, Reason: err.Error()})
+			return nil
+		}
+	default:
+		result.Skipped = append(result.Skipped, &SkippedKey{Key: key, Reason: "tipo de registro desconhecido"})
+		return nil
+	}
+
+	// Um registro já gravado na chave nova nunca é sobrescrito
+	existing, err := ctx.GetStub().GetState(newKey)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		result.Skipped = append(result.Skipped, &SkippedKey{Key: key, Reason: fmt.Sprintf("chave %s ja existe", newKey)})
+		return nil
+	}
+
+	switch recordType {
+	case testeNamespace:
+		result.Tests++
+	case modeloNamespace:
+		result.Models++
+	case planilhaNamespace:
+		if value, err = migrateLegacyPlanilha(ctx, key, newKey, value); err != nil {
+			return err
+		}
+		result.Planilhas++
+	}
+
+	return putStateMigrating(ctx, newKey, key, value)
+}
+
+/*
+	Função que converte uma planilha antiga: o hash passa para a forma
+	canônica (hex minúsculo), o algoritmo é o da chave nova (inferido pelo
+	tamanho do digest) e o índice "lote~planilha" é regravado quando o
+	hash mudou de forma
+*/
+func migrateLegacyPlanilha(ctx contractapi.TransactionContextInterface, key string, newKey string, value []byte) ([]byte, error) {
+	var record LoteRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(newKey, ":", 3)
+	record.HashAlgorithm = parts[1]
+	record.HashPlanilha = parts[2]
+	if record.HashEncoding == "" {
+		record.HashEncoding = defaultHashEncoding
+	}
+
+	if record.HashPlanilha != key {
+		oldIndexKey, err := ctx.GetStub().CreateCompositeKey("lote~planilha", []string{record.CasseteLot, key})
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.GetStub().DelState(oldIndexKey); err != nil {
+			return nil, err
+		}
+		newIndexKey, err := ctx.GetStub().CreateCompositeKey("lote~planilha", []string{record.CasseteLot, record.HashPlanilha})
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.GetStub().PutState(newIndexKey, []byte{0x00}); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(record)
+}
+
+// versão de um registro retornada pelo histórico do ledger
+type stateModification struct {
+	TxID     string
+	Time     time.Time
+	IsDelete bool
+	Value    []byte
+}
+
+/*
+	Função que reúne o histórico da chave com namespace e, durante a
+	transição, o da chave antiga. Da chave antiga só entram as versões do
+	tipo esperado; a remoção feita pela migração não aparece no histórico
+*/
+func getHistoryWithLegacy(ctx contractapi.TransactionContextInterface, key string, legacyKey string, recordType string) ([]*stateModification, error) {
+	keys := []string{key}
+	if legacyKey != "" && legacyKey != key {
+		keys = append(keys, legacyKey)
+	}
+
+	var modifications []*stateModification
+	for _, historyKey := range keys {
+		iterator, err := ctx.GetStub().GetHistoryForKey(historyKey)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao consultar histórico: %v", err)
+		}
+
+		for iterator.HasNext() {
+			modification, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+
+			if historyKey == legacyKey && (modification.IsDelete || legacyRecordType(legacyKey, modification.Value) != recordType) {
+				continue
+			}
+
+			modifications = append(modifications, &stateModification{
+				TxID: modification.TxId,
+				Time: time.Unix(
+					modification.Timestamp.GetSeconds(),
+					int64(modification.Timestamp.GetNanos()),
+				).UTC(),
+				IsDelete: modification.IsDelete,
+				Value:    modification.Value,
+			})
+		}
+		iterator.Close()
+	}
+
+	return modifications, nil
+}
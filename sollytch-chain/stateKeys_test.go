@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+// Grava um valor diretamente no stub, como faziam as versões sem namespace
+func putLegacyState(t *testing.T, stub *shimtest.MockStub, key string, value interface{}) {
+	t.Helper()
+
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stub.PutState(key, bytes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyKeysReadAndMigrate(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	silenceStdout(t)
+
+	var legacyTest TestRecord
+	if err := json.Unmarshal([]byte(readTestFixture(t)), &legacyTest); err != nil {
+		t.Fatal(err)
+	}
+	legacyTest.TestID = "TEST-OLD"
+
+	digest := sha512.Sum512([]byte("planilha antiga"))
+	legacyHash := strings.ToUpper(hex.EncodeToString(digest[:]))
+	canonical := hex.EncodeToString(digest[:])
+
+	stub.MockTransactionStart("legado")
+	putLegacyState(t, stub, "TEST-OLD", legacyTest)
+	putLegacyState(t, stub, legacyHash, LoteRecord{CasseteLot: "C22009", HashPlanilha: legacyHash})
+	// Modelo antigo cujo nome coincide com um testID
+	putLegacyState(t, stub, "TEST-X", ModelBytes{ModelKey: "TEST-X", ModelData: "AA=="})
+	putLegacyState(t, stub, "lixo", map[string]string{"foo": "bar"})
+	for _, index := range [][]string{{"lote~teste", "C22009", "TEST-OLD"}, {"lote~planilha", "C22009", legacyHash}} {
+		indexKey, err := stub.CreateCompositeKey(index[0], index[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.PutState(indexKey, []byte{0x00})
+	}
+	stub.MockTransactionEnd("legado")
+
+	// Durante a transição as leituras aceitam as chaves antigas
+	if _, err := contract.GetTestByID(ctx, "TEST-OLD"); err != nil {
+		t.Fatal(err)
+	}
+	if planilha, err := contract.GetPlanilhaByHash(ctx, legacyHash); err != nil || planilha.CasseteLot != "C22009" {
+		t.Fatalf("planilha antiga nao encontrada: %v", err)
+	}
+	// ... mas nunca confundem um modelo com um teste de mesmo nome
+	if _, err := contract.GetTestByID(ctx, "TEST-X"); err == nil {
+		t.Error("modelo TEST-X nao deveria ser lido como teste")
+	}
+
+	// Migração em páginas de uma chave
+	total := &KeyMigrationResult{}
+	startKey := ""
+	for calls := 0; ; calls++ {
+		if calls > 10 {
+			t.Fatal("migracao nao terminou")
+		}
+
+		stub.MockTransactionStart("migracao")
+		result, err := contract.MigrateStateKeys(ctx, startKey, 1)
+		stub.MockTransactionEnd("migracao")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total.Tests += result.Tests
+		total.Planilhas += result.Planilhas
+		total.Models += result.Models
+		total.Skipped = append(total.Skipped, result.Skipped...)
+		if result.Done {
+			break
+		}
+		startKey = result.NextStartKey
+	}
+
+	if total.Tests != 1 || total.Planilhas != 1 || total.Models != 1 || len(total.Skipped) != 1 || total.Skipped[0].Key != "lixo" {
+		t.Errorf("resultado inesperado: tests=%d planilhas=%d models=%d skipped=%+v", total.Tests, total.Planilhas, total.Models, total.Skipped)
+	}
+
+	for _, key := range []string{"TEST-OLD", legacyHash, "TEST-X"} {
+		if data, _ := stub.GetState(key); data != nil {
+			t.Errorf("chave antiga %s nao foi removida", key)
+		}
+	}
+	for _, key := range []string{testStateKey("TEST-OLD"), "planilha:sha512:" + canonical, modelStateKey("TEST-X")} {
+		if data, _ := stub.GetState(key); data == nil {
+			t.Errorf("chave nova %s nao foi gravada", key)
+		}
+	}
+
+	// O hash da planilha passa para a forma canônica, inclusive no índice
+	planilhas, err := contract.GetPlanilhasByLote(ctx, "C22009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planilhas) != 1 || planilhas[0].HashPlanilha != canonical || planilhas[0].HashAlgorithm != "sha512" {
+		t.Errorf("planilhas do lote inesperadas: %+v", planilhas)
+	}
+	tests, err := contract.GetTestsByLote(ctx, "C22009")
+	if err != nil || len(tests) != 1 || tests[0].TestID != "TEST-OLD" {
+		t.Errorf("testes do lote inesperados: %+v, %v", tests, err)
+	}
+
+	// A migração é executada uma única vez
+	stub.MockTransactionStart("repetida")
+	defer stub.MockTransactionEnd("repetida")
+	if _, err := contract.MigrateStateKeys(ctx, "", 10); err == nil || !strings.Contains(err.Error(), "ja concluida") {
+		t.Errorf("segunda migracao deveria ser recusada, erro: %v", err)
+	}
+}
+
+func TestUpdateTestMigratesLegacyKey(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	var legacyTest TestRecord
+	if err := json.Unmarshal([]byte(fixture), &legacyTest); err != nil {
+		t.Fatal(err)
+	}
+	legacyTest.TestID = "TEST-OLD"
+
+	stub.MockTransactionStart("legado")
+	putLegacyState(t, stub, "TEST-OLD", legacyTest)
+	stub.MockTransactionEnd("legado")
+
+	stub.MockTransactionStart("update")
+	defer stub.MockTransactionEnd("update")
+
+	// Um teste antigo não pode ser recriado sob a chave nova
+	if err := contract.StoreTest(ctx, "TEST-OLD", fixture, ""); err == nil || !strings.Contains(err.Error(), "ja existe") {
+		t.Errorf("teste antigo deveria ser considerado existente, erro: %v", err)
+	}
+
+	if err := contract.UpdateTest(ctx, "TEST-OLD", fixture); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := stub.GetState("TEST-OLD"); data != nil {
+		t.Error("chave antiga deveria ser removida na atualizacao")
+	}
+	record, err := contract.GetTestByID(ctx, "TEST-OLD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Version != 1 {
+		t.Errorf("versao inesperada: %d", record.Version)
+	}
+}
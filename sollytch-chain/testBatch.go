@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// item do lote enviado ao StoreTests
+type BatchTestInput struct {
+	TestID     string          `json:"test_id"`
+	Test       json.RawMessage `json:"test"`
+	PredictStr string          `json:"predict_str"`
+}
+
+// resultado da gravação de um item do lote
+type BatchTestResult struct {
+	Index   int    `json:"index"`
+	TestID  string `json:"test_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty" metadata:",optional"`
+}
+
+/*
+	Função responsável por registrar vários testes em uma única transação,
+	para a sincronização em massa das leituras de campo.
+	Recebe um JSON com a lista de itens {test_id, test, predict_str}, onde
+	"test" é o objeto JSON do teste (mesmo formato do StoreTest) e
+	predict_str é opcional. Os modelos são carregados uma única vez;
+	todos os itens são validados e preditos de forma independente e só
+	então os válidos são gravados. Uma falha na gravação cancela o lote
+	inteiro.
+	IDs repetidos no próprio lote ou já existentes no ledger são rejeitados.
+	Retorna o resultado de cada item, na ordem recebida; apenas os
+	itens com sucesso são gravados
+*/
+func (s *SmartContract) StoreTests(ctx contractapi.TransactionContextInterface, batchJSON string) ([]*BatchTestResult, error) {
+	start := time.Now()
+
+	var batch []BatchTestInput
+	if err := json.Unmarshal([]byte(batchJSON), &batch); err != nil {
+		return nil, fmt.Errorf("lote invalido: %v", err)
+	}
+	if len(batch) == 0 {
+		return nil, fmt.Errorf("lote vazio")
+	}
+
+	// Carrega os modelos de Machine Learning uma única vez para todo o lote
+	models, err := s.loadPredictionModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// As leituras do ledger não enxergam as escritas da própria transação,
+	// então os IDs do lote são conferidos entre si
+	seen := map[string]int{}
+	results := make([]*BatchTestResult, 0, len(batch))
+	writes := make([]*testWrite, 0, len(batch))
+	written := make([]*BatchTestResult, 0, len(batch))
+
+	// Primeira etapa: valida e prediz todos os itens, sem gravar nada
+	for i, item := range batch {
+		result := &BatchTestResult{Index: i, TestID: item.TestID}
+		results = append(results, result)
+
+		if first, ok := seen[item.TestID]; ok {
+			result.Error = fmt.Sprintf("teste %s repetido no lote (item %d)", item.TestID, first)
+			continue
+		}
+		seen[item.TestID] = i
+
+		record, err := s.prepareTest(ctx, item.TestID, string(item.Test), item.PredictStr)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		write, err := s.buildTest(ctx, record, models)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		writes = append(writes, write)
+		written = append(written, result)
+	}
+
+	// Segunda etapa: grava os itens válidos. Uma falha deixaria o lote
+	// gravado pela metade na transação, então cancela o lote inteiro
+	for i, write := range writes {
+		if err := write.put(ctx); err != nil {
+			return nil, fmt.Errorf("erro ao gravar teste %s, lote cancelado: %v", write.record.TestID, err)
+		}
+		written[i].Success = true
+	}
+	stored := len(writes)
+
+	elapsed := time.Since(start).Seconds()
+	fmt.Printf("BENCHMARK_METRIC: { \"function\": \"StoreTests\", \"count\": %d, \"stored\": %d, \"executionTime\": %.6f, \"timestamp\": \"%s\" }\n",
+		len(batch), stored, elapsed, time.Now().Format(time.RFC3339Nano))
+
+	return results, nil
+}
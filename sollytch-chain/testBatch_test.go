@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+// stub que falha a gravação de qualquer chave contendo failKey
+type failingPutStub struct {
+	*shimtest.MockStub
+	failKey string
+}
+
+func (stub *failingPutStub) PutState(key string, value []byte) error {
+	if strings.Contains(key, stub.failKey) {
+		return errors.New("falha simulada de escrita")
+	}
+	return stub.MockStub.PutState(key, value)
+}
+
+// stub que registra a ordem das leituras e gravações de chaves de teste
+type recordingStub struct {
+	*shimtest.MockStub
+	calls []string
+}
+
+func (stub *recordingStub) GetState(key string) ([]byte, error) {
+	if strings.HasPrefix(key, testeNamespace+":") {
+		stub.calls = append(stub.calls, "get "+key)
+	}
+	return stub.MockStub.GetState(key)
+}
+
+func (stub *recordingStub) PutState(key string, value []byte) error {
+	if strings.HasPrefix(key, testeNamespace+":") {
+		stub.calls = append(stub.calls, "put "+key)
+	}
+	return stub.MockStub.PutState(key, value)
+}
+
+func TestStoreTestsReportsEachItem(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("existing")
+	if err := contract.StoreTest(ctx, "TEST-EXISTENTE", fixture, ""); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("existing")
+
+	batch, err := json.Marshal([]map[string]interface{}{
+		{"test_id": "TEST-A", "test": json.RawMessage(fixture)},
+		{"test_id": "TEST-B", "test": json.RawMessage(fixture), "predict_str": fixtureFeatureRow},
+		{"test_id": "TEST-A", "test": json.RawMessage(fixture)},
+		{"test_id": "TEST-EXISTENTE", "test": json.RawMessage(fixture)},
+		{"test_id": "TEST-C", "test": map[string]interface{}{"lat": 200}},
+		{"test_id": "TEST-D", "test": json.RawMessage(fixture), "predict_str": "1,2,3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub.MockTransactionStart("batch")
+	results, err := contract.StoreTests(ctx, string(batch))
+	stub.MockTransactionEnd("batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		success bool
+		err     string
+	}{
+		{true, ""},
+		{true, ""},
+		{false, "repetido no lote"},
+		{false, "ja existe"},
+		{false, "teste invalido"},
+		{false, "predictStr deve conter"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("esperados %d resultados, obtidos %d", len(expected), len(results))
+	}
+	for i, want := range expected {
+		got := results[i]
+		if got.Index != i || got.Success != want.success || !strings.Contains(got.Error, want.err) {
+			t.Errorf("item %d: success=%v error=%q, esperado success=%v error contendo %q", i, got.Success, got.Error, want.success, want.err)
+		}
+	}
+
+	// Apenas os itens com sucesso foram gravados
+	for testID, stored := range map[string]bool{"TEST-A": true, "TEST-B": true, "TEST-C": false, "TEST-D": false} {
+		state, err := stub.GetState(testStateKey(testID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (state != nil) != stored {
+			t.Errorf("%s gravado=%v, esperado %v", testID, state != nil, stored)
+		}
+	}
+
+	tests, err := contract.GetTestsByLote(ctx, "C22009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 3 {
+		t.Errorf("lote C22009 deveria ter 3 testes, tem %d", len(tests))
+	}
+}
+
+func TestStoreTestsRejectsEmptyBatch(t *testing.T) {
+	contract, _, ctx := newTestContract(t)
+
+	for _, batch := range []string{"", "[]", "{}"} {
+		if _, err := contract.StoreTests(ctx, batch); err == nil {
+			t.Errorf("lote %q deveria ser rejeitado", batch)
+		}
+	}
+}
+
+func TestStoreTestsCancelsBatchOnWriteFailure(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	batch, err := json.Marshal([]map[string]interface{}{
+		{"test_id": "TEST-A", "test": json.RawMessage(fixture)},
+		{"test_id": "TEST-B", "test": json.RawMessage(fixture)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A gravação de um índice falha depois do PutState do teste
+	ctx.SetStub(&failingPutStub{MockStub: stub, failKey: "operador~teste"})
+	stub.MockTransactionStart("batch")
+	_, err = contract.StoreTests(ctx, string(batch))
+	stub.MockTransactionEnd("batch")
+	if err == nil || !strings.Contains(err.Error(), "lote cancelado") {
+		t.Fatalf("esperado erro cancelando o lote, obtido %v", err)
+	}
+}
+
+func TestStoreTestsBuildsEveryItemBeforeWriting(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	fixture := readTestFixture(t)
+	silenceStdout(t)
+
+	batch, err := json.Marshal([]map[string]interface{}{
+		{"test_id": "TEST-A", "test": json.RawMessage(fixture)},
+		{"test_id": "TEST-B", "test": json.RawMessage(fixture)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recording := &recordingStub{MockStub: stub}
+	ctx.SetStub(recording)
+	stub.MockTransactionStart("batch")
+	if _, err := contract.StoreTests(ctx, string(batch)); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("batch")
+
+	// Os testes só são gravados depois que todos os itens foram preparados
+	expected := []string{"get teste:TEST-A", "get teste:TEST-B", "put teste:TEST-A", "put teste:TEST-B"}
+	if !reflect.DeepEqual(recording.calls, expected) {
+		t.Errorf("acessos %v, esperados %v", recording.calls, expected)
+	}
+}
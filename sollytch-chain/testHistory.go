@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// alteração de um campo do TestRecord entre duas versões consecutivas
+type FieldChange struct {
+	Field    string `json:"field"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// struct json de uma versão do teste no histórico
+type TestHistoryEntry struct {
+	TxID      string        `json:"tx_id"`
+	Timestamp string        `json:"timestamp"`
+	IsDelete  bool          `json:"is_delete"`
+	MSPID     string        `json:"msp_id"`
+	Subject   string        `json:"subject"`
+	Record    *TestRecord   `json:"record,omitempty" metadata:",optional"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// Campos de controle que mudam a cada versão e não entram no diff
+var historyIgnoredFields = map[string]bool{
+	"version":             true,
+	"last_updated_at":     true,
+	"last_updated_by_msp": true,
+	"last_updated_by":     true,
+}
+
+/*
+	Função que calcula o diff campo a campo entre duas versões de um teste.
+	Os valores são apresentados em JSON (strings entre aspas, null para ausentes)
+	e os campos são ordenados alfabeticamente
+*/
+func diffTestRecords(previous *TestRecord, current *TestRecord) ([]FieldChange, error) {
+	toMap := func(record *TestRecord) (map[string]json.RawMessage, error) {
+		fields := map[string]json.RawMessage{}
+		if record == nil {
+			return fields, nil
+		}
+		bytes, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes, &fields); err != nil {
+			return nil, err
+		}
+		return fields, nil
+	}
+
+	oldFields, err := toMap(previous)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := toMap(current)
+	if err != nil {
+		return nil, err
+	}
+
+	// Une os nomes de campos das duas versões
+	names := map[string]bool{}
+	for name := range oldFields {
+		names[name] = true
+	}
+	for name := range newFields {
+		names[name] = true
+	}
+
+	changes := []FieldChange{}
+	for name := range names {
+		if historyIgnoredFields[name] {
+			continue
+		}
+
+		oldValue, newValue := "null", "null"
+		if raw, ok := oldFields[name]; ok {
+			oldValue = string(raw)
+		}
+		if raw, ok := newFields[name]; ok {
+			newValue = string(raw)
+		}
+
+		if oldValue != newValue {
+			changes = append(changes, FieldChange{Field: name, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes, nil
+}
+
+/*
+	Função que retorna o histórico completo de versões de um teste.
+	Utiliza GetHistoryForKey e, para cada versão (em ordem cronológica),
+	informa o txID, o timestamp da transação, a identidade que submeteu
+	a alteração (MSP e subject do certificado) e o diff em relação
+	à versão anterior. A primeira versão e as remoções não possuem diff.
+
+	O histórico do Fabric não expõe o criador de cada transação, então a
+	identidade vem dos campos last_updated_by_msp/last_updated_by gravados
+	no próprio registro. Versões gravadas antes desses campos existirem e
+	as remoções são apresentadas com msp_id e subject vazios
+*/
+func (s *SmartContract) GetTestHistory(ctx contractapi.TransactionContextInterface, testID string) ([]*TestHistoryEntry, error) {
+	// Valida o testID obrigatório
+	if testID == "" {
+		return nil, fmt.Errorf("testID não pode ser vazio")
+	}
+
+	// Inclui as versões gravadas na chave antiga, antes da migração
+	modifications, err := getHistoryWithLegacy(ctx, testStateKey(testID), testID, testeNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	type historyItem struct {
+		entry *TestHistoryEntry
+		time  time.Time
+	}
+	var items []historyItem
+
+	for _, modification := range modifications {
+		entry := &TestHistoryEntry{
+			TxID:      modification.TxID,
+			Timestamp: modification.Time.Format(time.RFC3339Nano),
+			IsDelete:  modification.IsDelete,
+			Changes:   []FieldChange{},
+		}
+
+		// Versões removidas não possuem valor associado
+		if !modification.IsDelete {
+			var record TestRecord
+			if err := json.Unmarshal(modification.Value, &record); err != nil {
+				return nil, fmt.Errorf("erro ao deserializar versão %s: %v", modification.TxID, err)
+			}
+			entry.Record = &record
+			entry.MSPID = record.LastUpdatedByMSP
+			entry.Subject = record.LastUpdatedBy
+		}
+
+		items = append(items, historyItem{entry: entry, time: modification.Time})
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("teste %s não encontrado", testID)
+	}
+
+	// Ordena cronologicamente, desempatando pela versão do registro
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].time.Equal(items[j].time) {
+			return items[i].time.Before(items[j].time)
+		}
+		if items[i].entry.Record != nil && items[j].entry.Record != nil {
+			return items[i].entry.Record.Version < items[j].entry.Record.Version
+		}
+		return false
+	})
+
+	// Calcula o diff de cada versão em relação à última versão gravada.
+	// Remoções não têm registro, então não geram diff nem substituem a anterior
+	results := make([]*TestHistoryEntry, 0, len(items))
+	var previous *TestRecord
+	for _, item := range items {
+		if item.entry.Record != nil {
+			if previous != nil {
+				changes, err := diffTestRecords(previous, item.entry.Record)
+				if err != nil {
+					return nil, err
+				}
+				item.entry.Changes = changes
+			}
+			previous = item.entry.Record
+		}
+
+		results = append(results, item.entry)
+	}
+
+	return results, nil
+}
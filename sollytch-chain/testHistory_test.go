@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Iterador em memória sobre um histórico já montado
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+// MockStub com o histórico de cada chave, que o shimtest não implementa
+type historyStub struct {
+	*shimtest.MockStub
+	history map[string][]*queryresult.KeyModification
+}
+
+func (stub *historyStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{modifications: stub.history[key]}, nil
+}
+
+// Monta uma versão do histórico gravada no minuto informado
+func historyVersion(t *testing.T, txID string, minute int, record *TestRecord) *queryresult.KeyModification {
+	t.Helper()
+
+	modification := &queryresult.KeyModification{
+		TxId:      txID,
+		Timestamp: timestamppb.New(time.Date(2025, 7, 15, 12, minute, 0, 0, time.UTC)),
+		IsDelete:  record == nil,
+	}
+	if record != nil {
+		value, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modification.Value = value
+	}
+
+	return modification
+}
+
+func TestGetTestHistoryDiff(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	// Versão antiga, sem os campos de identidade
+	v1 := &TestRecord{TestID: "TEST-1", CassetteLot: "C1", OperatorID: "OP01", Version: 1}
+	v2 := *v1
+	v2.OperatorID = "OP02"
+	v2.Version = 2
+	v2.LastUpdatedByMSP = "org1MSP"
+	v2.LastUpdatedBy = "operador"
+	v3 := v2
+	v3.CassetteLot = "C2"
+	v3.Version = 3
+
+	ctx.SetStub(&historyStub{
+		MockStub: stub,
+		history: map[string][]*queryresult.KeyModification{
+			testStateKey("TEST-1"): {
+				historyVersion(t, "tx1", 1, v1),
+				historyVersion(t, "tx2", 2, &v2),
+				historyVersion(t, "tx3", 3, nil),
+				historyVersion(t, "tx4", 4, &v3),
+			},
+		},
+	})
+
+	history, err := contract.GetTestHistory(ctx, "TEST-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("esperadas 4 versoes, obtidas %d", len(history))
+	}
+
+	expected := []struct {
+		txID     string
+		mspID    string
+		isDelete bool
+		changes  []FieldChange
+	}{
+		{"tx1", "", false, nil},
+		{"tx2", "org1MSP", false, []FieldChange{{Field: "operator_id", OldValue: `"OP01"`, NewValue: `"OP02"`}}},
+		{"tx3", "", true, nil},
+		// A remoção não interrompe o diff, que compara com a última versão gravada
+		{"tx4", "org1MSP", false, []FieldChange{{Field: "cassette_lot", OldValue: `"C1"`, NewValue: `"C2"`}}},
+	}
+	for i, want := range expected {
+		got := history[i]
+		if got.TxID != want.txID || got.MSPID != want.mspID || got.IsDelete != want.isDelete {
+			t.Errorf("versao %d inesperada: %+v", i, got)
+		}
+		if len(got.Changes) != len(want.changes) {
+			t.Errorf("versao %d: alteracoes %+v, esperadas %+v", i, got.Changes, want.changes)
+			continue
+		}
+		for j := range want.changes {
+			if got.Changes[j] != want.changes[j] {
+				t.Errorf("versao %d: alteracao %+v, esperada %+v", i, got.Changes[j], want.changes[j])
+			}
+		}
+	}
+
+	if _, err := contract.GetTestHistory(ctx, "TEST-2"); err == nil {
+		t.Error("teste sem historico deveria falhar")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// índice secundário de testes: nome da chave composta e o campo do TestRecord indexado
+type testIndex struct {
+	objectType string
+	value      func(record *TestRecord) string
+}
+
+/*
+	Índices secundários mantidos por StoreTest e UpdateTest.
+	Cada índice é uma chave composta "<campo>~teste" com o valor do campo
+	e o testID, permitindo buscas por prefixo sem varrer o ledger inteiro
+*/
+var testIndexes = []testIndex{
+	{"lote~teste", func(r *TestRecord) string { return r.CassetteLot }},
+	{"operador~teste", func(r *TestRecord) string { return r.OperatorID }},
+	{"reagente~teste", func(r *TestRecord) string { return r.ReagentLot }},
+	{"produto~teste", func(r *TestRecord) string { return r.ProdutoID }},
+	{"matriz~teste", func(r *TestRecord) string { return r.MatrixType }},
+	{"resultado~teste", func(r *TestRecord) string { return r.ResultClass }},
+	{"criado~teste", func(r *TestRecord) string { return r.CreatedAt }},
+	{"timestamp~teste", func(r *TestRecord) string { return r.Timestamp }},
+}
+
+// Função que monta todas as chaves compostas de índice de um teste
+func testIndexKeys(ctx contractapi.TransactionContextInterface, record *TestRecord) ([]string, error) {
+	indexKeys := make([]string, 0, len(testIndexes))
+	for _, index := range testIndexes {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(
+			index.objectType,
+			[]string{index.value(record), record.TestID},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		indexKeys = append(indexKeys, indexKey)
+	}
+
+	return indexKeys, nil
+}
+
+/*
+	Função que atualiza os índices de um teste alterado.
+	Apenas os índices cujo valor mudou entre a versão antiga e a nova
+	são removidos e recriados
+*/
+func updateTestIndexes(ctx contractapi.TransactionContextInterface, existing *TestRecord, updated *TestRecord) error {
+	for _, index := range testIndexes {
+		oldValue := index.value(existing)
+		newValue := index.value(updated)
+		if oldValue == newValue {
+			continue
+		}
+
+		// Remove índice antigo
+		oldIndexKey, err := ctx.GetStub().CreateCompositeKey(
+			index.objectType,
+			[]string{oldValue, existing.TestID},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.GetStub().DelState(oldIndexKey); err != nil {
+			return err
+		}
+
+		// Cria novo índice com o valor atualizado
+		newIndexKey, err := ctx.GetStub().CreateCompositeKey(
+			index.objectType,
+			[]string{newValue, updated.TestID},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.GetStub().PutState(newIndexKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resultado de uma execução de RebuildTestIndexes
+type IndexRebuildResult struct {
+	Tests        int    `json:"tests"`
+	NextStartKey string `json:"next_start_key"`
+	Done         bool   `json:"done"`
+}
+
+/*
+	Função que recria os índices secundários dos testes gravados antes da
+	sua criação, que de outra forma ficariam fora do QueryTests. Restrita
+	a administradores. Percorre os testes (chaves "teste:<id>" e as chaves
+	antigas ainda não migradas) a partir de startKey (vazio na primeira
+	chamada), processando no máximo limit testes; enquanto done for false,
+	a chamada seguinte deve usar o next_start_key devolvido.
+	Regravar um índice existente não tem efeito, então a função pode ser
+	executada novamente sem prejuízo
+*/
+func (s *SmartContract) RebuildTestIndexes(ctx contractapi.TransactionContextInterface, startKey string, limit int) (*IndexRebuildResult, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit deve ser maior que zero")
+	}
+
+	iterator, err := ctx.GetStub().GetStateByRange(startKey, maxStateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &IndexRebuildResult{}
+
+	// Os testes são lidos antes de gravar os índices, para não alterar o
+	// estado durante a iteração
+	var tests []*queryresult.KV
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			iterator.Close()
+			return nil, err
+		}
+
+		// Chaves compostas, planilhas e modelos ficam de fora
+		isTest := strings.HasPrefix(response.Key, testeNamespace+":") ||
+			(!strings.HasPrefix(response.Key, "\x00") && !isNamespacedKey(response.Key) &&
+				legacyRecordType(response.Key, response.Value) == testeNamespace)
+		if !isTest {
+			continue
+		}
+
+		if len(tests) == limit {
+			result.NextStartKey = response.Key
+			break
+		}
+		tests = append(tests, response)
+	}
+	iterator.Close()
+
+	for _, response := range tests {
+		var record TestRecord
+		if err := json.Unmarshal(response.Value, &record); err != nil {
+			return nil, fmt.Errorf("teste %s invalido: %v", response.Key, err)
+		}
+
+		indexKeys, err := testIndexKeys(ctx, &record)
+		if err != nil {
+			return nil, err
+		}
+		for _, indexKey := range indexKeys {
+			if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
+				return nil, err
+			}
+		}
+		result.Tests++
+	}
+
+	result.Done = result.NextStartKey == ""
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+	Filtros aceitos por QueryTests. Todos os filtros informados são combinados (AND).
+	Os intervalos de data são inclusivos e comparados no mesmo formato do campo
+	(created_at em RFC3339, timestamp no formato enviado pelo leitor), de modo que
+	um limite parcial como "2025-07-15" cobre todo o dia informado
+*/
+type TestQuery struct {
+	CassetteLot   string `json:"cassette_lot"`
+	OperatorID    string `json:"operator_id"`
+	ReagentLot    string `json:"reagent_lot"`
+	ProdutoID     string `json:"produto_id"`
+	MatrixType    string `json:"matrix_type"`
+	ResultClass   string `json:"result_class"`
+	CreatedFrom   string `json:"created_from"`
+	CreatedTo     string `json:"created_to"`
+	TimestampFrom string `json:"timestamp_from"`
+	TimestampTo   string `json:"timestamp_to"`
+}
+
+// Verifica se um valor está dentro do intervalo [from, to], tratando "to" como prefixo inclusivo
+func inRange(value string, from string, to string) bool {
+	if from != "" && value < from {
+		return false
+	}
+	if to != "" && value > to && !strings.HasPrefix(value, to) {
+		return false
+	}
+	return true
+}
+
+// Verifica se um teste atende a todos os filtros da consulta
+func (q *TestQuery) matches(record *TestRecord) bool {
+	equals := []struct{ filter, value string }{
+		{q.CassetteLot, record.CassetteLot},
+		{q.OperatorID, record.OperatorID},
+		{q.ReagentLot, record.ReagentLot},
+		{q.ProdutoID, record.ProdutoID},
+		{q.MatrixType, record.MatrixType},
+		{q.ResultClass, record.ResultClass},
+	}
+	for _, eq := range equals {
+		if eq.filter != "" && eq.filter != eq.value {
+			return false
+		}
+	}
+
+	return inRange(record.CreatedAt, q.CreatedFrom, q.CreatedTo) &&
+		inRange(record.Timestamp, q.TimestampFrom, q.TimestampTo)
+}
+
+/*
+	Função que escolhe o índice secundário usado para iniciar a busca.
+	Filtros de igualdade têm prioridade (busca por prefixo); na ausência deles,
+	o índice de data é percorrido em ordem e os limites do intervalo são retornados
+*/
+func (q *TestQuery) selectIndex() (objectType string, attributes []string, from string, to string, err error) {
+	equals := []struct{ objectType, value string }{
+		{"lote~teste", q.CassetteLot},
+		{"operador~teste", q.OperatorID},
+		{"reagente~teste", q.ReagentLot},
+		{"produto~teste", q.ProdutoID},
+		{"matriz~teste", q.MatrixType},
+		{"resultado~teste", q.ResultClass},
+	}
+	for _, eq := range equals {
+		if eq.value != "" {
+			return eq.objectType, []string{eq.value}, "", "", nil
+		}
+	}
+
+	if q.CreatedFrom != "" || q.CreatedTo != "" {
+		return "criado~teste", []string{}, q.CreatedFrom, q.CreatedTo, nil
+	}
+
+	if q.TimestampFrom != "" || q.TimestampTo != "" {
+		return "timestamp~teste", []string{}, q.TimestampFrom, q.TimestampTo, nil
+	}
+
+	return "", nil, "", "", fmt.Errorf("ao menos um filtro deve ser informado")
+}
+
+/*
+	Função que consulta testes combinando filtros por operador, lote de reagente,
+	produto, matriz, classe de resultado e intervalos de data.
+	Recebe um JSON com os campos de TestQuery, percorre o índice secundário
+	mais seletivo e aplica os filtros restantes sobre cada teste encontrado
+*/
+func (s *SmartContract) QueryTests(ctx contractapi.TransactionContextInterface, queryJSON string) ([]*TestRecord, error) {
+	// Desserializa os filtros rejeitando campos desconhecidos
+	var query TestQuery
+	decoder := json.NewDecoder(bytes.NewReader([]byte(queryJSON)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		return nil, fmt.Errorf("filtro invalido: %v", err)
+	}
+
+	return s.queryTests(ctx, &query)
+}
+
+// Função interna que executa a consulta a partir de um TestQuery já montado
+func (s *SmartContract) queryTests(ctx contractapi.TransactionContextInterface, query *TestQuery) ([]*TestRecord, error) {
+	objectType, attributes, from, to, err := query.selectIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	var results []*TestRecord
+
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Separa os atributos da chave composta (valor indexado, testID)
+		_, parts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		// Índices de data são ordenados, então a busca termina ao passar do limite
+		if len(attributes) == 0 {
+			if from != "" && parts[0] < from {
+				continue
+			}
+			if !inRange(parts[0], "", to) {
+				break
+			}
+		}
+
+		test, err := s.GetTestByID(ctx, parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if query.matches(test) {
+			results = append(results, test)
+		}
+	}
+
+	return results, nil
+}
+
+// Função que retorna todos os testes realizados por um operador
+func (s *SmartContract) GetTestsByOperator(ctx contractapi.TransactionContextInterface, operatorID string) ([]*TestRecord, error) {
+	if operatorID == "" {
+		return nil, fmt.Errorf("operatorID não pode ser vazio")
+	}
+
+	return s.queryTests(ctx, &TestQuery{OperatorID: operatorID})
+}
+
+// Função que retorna todos os testes realizados com um lote de reagente
+func (s *SmartContract) GetTestsByReagentLot(ctx contractapi.TransactionContextInterface, reagentLot string) ([]*TestRecord, error) {
+	if reagentLot == "" {
+		return nil, fmt.Errorf("reagentLot não pode ser vazio")
+	}
+
+	return s.queryTests(ctx, &TestQuery{ReagentLot: reagentLot})
+}
+
+// Função que retorna todos os testes de um produto
+func (s *SmartContract) GetTestsByProduto(ctx contractapi.TransactionContextInterface, produtoID string) ([]*TestRecord, error) {
+	if produtoID == "" {
+		return nil, fmt.Errorf("produtoID não pode ser vazio")
+	}
+
+	return s.queryTests(ctx, &TestQuery{ProdutoID: produtoID})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryTestsSelectsIndex(t *testing.T) {
+	cases := []struct {
+		query      TestQuery
+		objectType string
+		attributes []string
+	}{
+		{TestQuery{CassetteLot: "C1", OperatorID: "OP1"}, "lote~teste", []string{"C1"}},
+		{TestQuery{OperatorID: "OP1", ProdutoID: "P1"}, "operador~teste", []string{"OP1"}},
+		{TestQuery{ResultClass: "positivo", CreatedFrom: "2025"}, "resultado~teste", []string{"positivo"}},
+		{TestQuery{CreatedTo: "2025-07-15", TimestampFrom: "2025"}, "criado~teste", []string{}},
+		{TestQuery{TimestampFrom: "2025-07-01"}, "timestamp~teste", []string{}},
+	}
+	for _, c := range cases {
+		objectType, attributes, _, _, err := c.query.selectIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if objectType != c.objectType || !reflect.DeepEqual(attributes, c.attributes) {
+			t.Errorf("%+v: indice %s %v, esperado %s %v", c.query, objectType, attributes, c.objectType, c.attributes)
+		}
+	}
+
+	if _, _, _, _, err := (&TestQuery{}).selectIndex(); err == nil {
+		t.Error("consulta sem filtros deveria falhar")
+	}
+}
+
+func TestQueryTestsRanges(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	silenceStdout(t)
+
+	stub.MockTransactionStart("tests")
+	tests := []struct{ id, timestamp, operator string }{
+		{"TEST-1", "2025-07-14 23:59:59", "OP01"},
+		{"TEST-2", "2025-07-15 00:00:00", "OP01"},
+		{"TEST-3", "2025-07-15 22:13:00", "OP02"},
+		{"TEST-4", "2025-07-16 00:00:00", "OP01"},
+	}
+	for _, test := range tests {
+		fixture := fixtureWith(t, map[string]interface{}{"timestamp": test.timestamp, "operator_id": test.operator})
+		if err := contract.StoreTest(ctx, test.id, fixture, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stub.MockTransactionEnd("tests")
+
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		// Limites parciais cobrem todo o dia informado
+		{`{"timestamp_from":"2025-07-15","timestamp_to":"2025-07-15"}`, []string{"TEST-2", "TEST-3"}},
+		{`{"timestamp_from":"2025-07-15 00:00:00","timestamp_to":"2025-07-16 00:00:00"}`, []string{"TEST-2", "TEST-3", "TEST-4"}},
+		{`{"timestamp_to":"2025-07-14"}`, []string{"TEST-1"}},
+		{`{"operator_id":"OP01","timestamp_from":"2025-07-15"}`, []string{"TEST-2", "TEST-4"}},
+		{`{"operator_id":"OP03"}`, nil},
+	}
+	for _, c := range cases {
+		results, err := contract.QueryTests(ctx, c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, record := range results {
+			ids = append(ids, record.TestID)
+		}
+		if !reflect.DeepEqual(ids, c.expected) {
+			t.Errorf("%s: testes %v, esperados %v", c.query, ids, c.expected)
+		}
+	}
+
+	if _, err := contract.QueryTests(ctx, `{"operador":"OP01"}`); err == nil {
+		t.Error("filtro desconhecido deveria ser rejeitado")
+	}
+}
+
+func TestRebuildTestIndexes(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	silenceStdout(t)
+
+	var legacyTest TestRecord
+	if err := json.Unmarshal([]byte(fixtureWith(t, map[string]interface{}{"operator_id": "OP09"})), &legacyTest); err != nil {
+		t.Fatal(err)
+	}
+	legacyTest.TestID = "TEST-OLD"
+
+	stub.MockTransactionStart("tests")
+	for _, id := range []string{"TEST-1", "TEST-2"} {
+		if err := contract.StoreTest(ctx, id, fixtureWith(t, map[string]interface{}{"operator_id": "OP09"}), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	putLegacyState(t, stub, "TEST-OLD", legacyTest)
+	stub.MockTransactionEnd("tests")
+
+	// Remove os índices de TEST-2, como se tivesse sido gravado antes deles
+	stub.MockTransactionStart("sem-indices")
+	stored, err := contract.GetTestByID(ctx, "TEST-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexKeys, err := testIndexKeys(ctx, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, indexKey := range indexKeys {
+		stub.DelState(indexKey)
+	}
+	stub.MockTransactionEnd("sem-indices")
+
+	queryIDs := func() []string {
+		results, err := contract.QueryTests(ctx, `{"operator_id":"OP09"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, record := range results {
+			ids = append(ids, record.TestID)
+		}
+		return ids
+	}
+	if ids := queryIDs(); !reflect.DeepEqual(ids, []string{"TEST-1"}) {
+		t.Fatalf("testes %v antes da reconstrucao", ids)
+	}
+
+	// Apenas administradores reconstroem os índices
+	stub.MockTransactionStart("operador")
+	admin := stub.Creator
+	stub.Creator = newTestCreator(t, "org1MSP", "operador")
+	if _, err := contract.RebuildTestIndexes(newTestContext(t, stub), "", 10); err == nil || !strings.Contains(err.Error(), "administradores") {
+		t.Errorf("reconstrucao deveria ser restrita a administradores, erro: %v", err)
+	}
+	stub.Creator = admin
+	stub.MockTransactionEnd("operador")
+
+	// Reconstrução em páginas de um teste
+	total := 0
+	startKey := ""
+	for calls := 0; ; calls++ {
+		if calls > 10 {
+			t.Fatal("reconstrucao nao terminou")
+		}
+
+		stub.MockTransactionStart("reconstrucao")
+		result, err := contract.RebuildTestIndexes(ctx, startKey, 1)
+		stub.MockTransactionEnd("reconstrucao")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total += result.Tests
+		if result.Done {
+			break
+		}
+		startKey = result.NextStartKey
+	}
+
+	if total != 3 {
+		t.Errorf("%d testes reindexados, esperados 3", total)
+	}
+	if ids := queryIDs(); !reflect.DeepEqual(ids, []string{"TEST-1", "TEST-2", "TEST-OLD"}) {
+		t.Errorf("testes %v depois da reconstrucao", ids)
+	}
+}
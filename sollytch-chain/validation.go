@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// violação encontrada na validação de um TestRecord
+type ValidationViolation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Campos obrigatórios do JSON de um teste (presentes e não nulos)
+var requiredTestFields = []string{
+	"timestamp", "lat", "lon", "geo_hash", "operator_id", "matrix_type",
+	"cassette_lot", "reagent_lot", "expiry_days_left", "distance_mm",
+	"time_to_migrate_s", "control_line_ok", "sample_volume_uL", "sample_pH",
+	"sample_turbidity_NTU", "sample_temp_C", "ambient_T_C", "ambient_RH_pct",
+	"lighting_lux", "tilt_deg", "preincubation_time_s", "time_since_sampling_min",
+	"storage_condition", "produto_id", "controle_interno_result",
+	"tempo_transporte_horas", "condicao_transporte",
+	"estimated_concentration_ppb", "incerteza_estimativa_ppb",
+}
+
+/*
+	Campos do TestRecord preenchidos apenas pelo ledger: metadados de versão
+	e autoria, alertas do lote e a proveniência das predições.
+	Não podem ser enviados pelo cliente. Os campos preditos (acao_recomendada,
+	result_class e qc_status) continuam corrigíveis pelo UpdateTest
+*/
+var ledgerControlledTestFields = map[string]bool{
+	"version":             true,
+	"last_updated_at":     true,
+	"created_at":          true,
+	"last_updated_by_msp": true,
+	"last_updated_by":     true,
+	"lote_flags":          true,
+	"predictions":         true,
+}
+
+// limites físicos aceitos para um campo numérico
+type fieldRange struct {
+	min float64
+	max float64
+}
+
+// Limites físicos dos campos numéricos do teste
+var testFieldRanges = map[string]fieldRange{
+	"lat":                         {-90, 90},
+	"lon":                         {-180, 180},
+	"sample_pH":                   {0, 14},
+	"ambient_RH_pct":              {0, 100},
+	"sample_temp_C":               {-50, 100},
+	"ambient_T_C":                 {-50, 70},
+	"tilt_deg":                    {-90, 90},
+	"distance_mm":                 {0, 1000},
+	"time_to_migrate_s":           {0, 86400},
+	"sample_volume_uL":            {0, 100000},
+	"sample_turbidity_NTU":        {0, 100000},
+	"lighting_lux":                {0, 200000},
+	"preincubation_time_s":        {0, 86400},
+	"time_since_sampling_min":     {0, 525600},
+	"tempo_transporte_horas":      {0, 8760},
+	"estimated_concentration_ppb": {0, 1e9},
+	"incerteza_estimativa_ppb":    {0, 1e9},
+	"image_blur_score":            {0, 1e9},
+}
+
+// Valores aceitos para os campos categóricos do teste
+var testFieldEnums = map[string][]string{
+	"matrix_type":             {"agua", "efluente", "extrato_solo", "calda"},
+	"storage_condition":       {"ambiente", "refrigerado", "congelado"},
+	"condicao_transporte":     {"protegido", "refrigerado", "ambiente"},
+	"controle_interno_result": {"ok", "fail", "invalid", "falha_controle_negativo"},
+}
+
+// Mapeia o nome json de cada campo do TestRecord para o seu tipo Go
+func testRecordFieldTypes() map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	recordType := reflect.TypeOf(TestRecord{})
+
+	for i := 0; i < recordType.NumField(); i++ {
+		field := recordType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+// Retorna as chaves de um mapa em ordem alfabética, para mensagens determinísticas
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Alfabeto base32 utilizado pelo geohash
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Calcula o geohash de uma coordenada com a precisão (número de caracteres) informada
+func encodeGeohash(lat float64, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	bit, value, even := 0, 0, true
+
+	for hash.Len() < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if lon >= mid {
+				value = value<<1 | 1
+				lonRange[0] = mid
+			} else {
+				value = value << 1
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if lat >= mid {
+				value = value<<1 | 1
+				latRange[0] = mid
+			} else {
+				value = value << 1
+				latRange[1] = mid
+			}
+		}
+		even = !even
+
+		bit++
+		if bit == 5 {
+			hash.WriteByte(geohashAlphabet[value])
+			bit, value = 0, 0
+		}
+	}
+
+	return hash.String()
+}
+
+/*
+	Função que valida o JSON de um teste contra o esquema do TestRecord.
+	Diferente do json.Unmarshal, que para no primeiro erro e ignora campos
+	desconhecidos, retorna a lista completa de violações: campos desconhecidos
+	ou controlados pelo ledger, obrigatórios ausentes, tipos inválidos, valores fora dos limites físicos,
+	enumerações inválidas e geo_hash inconsistente com lat/lon
+*/
+func validateTestJSON(jsonStr string) (*TestRecord, []ValidationViolation) {
+	violations := []ValidationViolation{}
+	add := func(field, rule, format string, args ...interface{}) {
+		violations = append(violations, ValidationViolation{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonStr), &raw); err != nil {
+		add("", "json", "JSON invalido: %v", err)
+		return nil, violations
+	}
+
+	// Campos desconhecidos, controlados pelo ledger e tipos inválidos
+	fieldTypes := testRecordFieldTypes()
+	for _, name := range sortedKeys(raw) {
+		fieldType, ok := fieldTypes[name]
+		if !ok {
+			add(name, "unknown_field", "campo desconhecido")
+			continue
+		}
+		if ledgerControlledTestFields[name] {
+			add(name, "forbidden_field", "campo controlado pelo ledger, nao pode ser enviado")
+			continue
+		}
+
+		if string(raw[name]) == "null" {
+			continue
+		}
+
+		if err := json.Unmarshal(raw[name], reflect.New(fieldType).Interface()); err != nil {
+			add(name, "type", "tipo invalido, esperado %s", fieldType.String())
+		}
+	}
+
+	// Campos obrigatórios
+	for _, name := range requiredTestFields {
+		value, ok := raw[name]
+		if !ok || string(value) == "null" || string(value) == `""` {
+			add(name, "required", "campo obrigatorio")
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, violations
+	}
+
+	// Com os tipos validados a desserialização completa não falha
+	var record TestRecord
+	if err := json.Unmarshal([]byte(jsonStr), &record); err != nil {
+		add("", "json", "JSON invalido: %v", err)
+		return nil, violations
+	}
+
+	// Limites físicos dos campos numéricos (campos nulos são ignorados)
+	for _, name := range sortedKeys(testFieldRanges) {
+		var value float64
+		rawValue, ok := raw[name]
+		if !ok || string(rawValue) == "null" || json.Unmarshal(rawValue, &value) != nil {
+			continue
+		}
+
+		limits := testFieldRanges[name]
+		if value < limits.min || value > limits.max {
+			add(name, "range", "valor %v fora do intervalo [%v, %v]", value, limits.min, limits.max)
+		}
+	}
+
+	// Enumerações (campos opcionais vazios são ignorados)
+	enumValues := map[string]string{
+		"matrix_type":             record.MatrixType,
+		"storage_condition":       record.StorageCondition,
+		"condicao_transporte":     record.CondicaoTransporte,
+		"controle_interno_result": record.ControleInternoResult,
+	}
+	for _, name := range sortedKeys(enumValues) {
+		value := enumValues[name]
+		if value == "" {
+			continue
+		}
+
+		valid := false
+		for _, allowed := range testFieldEnums[name] {
+			if value == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			add(name, "enum", "valor %q invalido, esperado um de: %s", value, strings.Join(testFieldEnums[name], ", "))
+		}
+	}
+
+	// geo_hash deve corresponder às coordenadas informadas
+	geoHash := strings.ToLower(record.GeoHash)
+	if strings.Trim(geoHash, geohashAlphabet) != "" {
+		add("geo_hash", "geo_hash", "geo_hash contem caracteres invalidos")
+	} else if expected := encodeGeohash(record.Lat, record.Lon, len(geoHash)); expected != geoHash {
+		add("geo_hash", "geo_hash", "geo_hash %s nao corresponde a lat/lon (esperado %s)", record.GeoHash, expected)
+	}
+
+	if len(violations) > 0 {
+		return nil, violations
+	}
+
+	return &record, violations
+}
+
+/*
+	Função que desserializa e valida o JSON de um teste.
+	Em caso de falha retorna um erro contendo a lista de violações em JSON
+*/
+func decodeTestRecord(jsonStr string) (*TestRecord, error) {
+	record, violations := validateTestJSON(jsonStr)
+	if len(violations) > 0 {
+		details, err := json.Marshal(violations)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("teste invalido: %s", details)
+	}
+
+	return record, nil
+}
+
+/*
+	Função que valida o JSON de um teste sem gravá-lo no ledger.
+	Retorna a lista completa de violações (vazia quando o teste é válido),
+	permitindo que os clientes confiram os dados antes do StoreTest
+*/
+func (s *SmartContract) ValidateTest(ctx contractapi.TransactionContextInterface, jsonStr string) ([]ValidationViolation, error) {
+	_, violations := validateTestJSON(jsonStr)
+	return violations, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+)
+
+// Agrupa as violações por campo e regra
+func violationSet(violations []ValidationViolation) map[[2]string]bool {
+	set := map[[2]string]bool{}
+	for _, violation := range violations {
+		set[[2]string{violation.Field, violation.Rule}] = true
+	}
+	return set
+}
+
+func TestValidateTestJSONReportsEachViolation(t *testing.T) {
+	if _, violations := validateTestJSON(readTestFixture(t)); len(violations) != 0 {
+		t.Fatalf("fixture deveria ser valida: %+v", violations)
+	}
+
+	cases := []struct {
+		name   string
+		fields map[string]interface{}
+		field  string
+		rule   string
+	}{
+		{"campo desconhecido", map[string]interface{}{"operador": "OP04"}, "operador", "unknown_field"},
+		{"tipo invalido", map[string]interface{}{"lat": "-22.8"}, "lat", "type"},
+		{"obrigatorio ausente", map[string]interface{}{"reagent_lot": nil}, "reagent_lot", "required"},
+		{"obrigatorio vazio", map[string]interface{}{"operator_id": ""}, "operator_id", "required"},
+		{"fora do intervalo", map[string]interface{}{"sample_pH": 15}, "sample_pH", "range"},
+		{"enumeracao invalida", map[string]interface{}{"matrix_type": "leite"}, "matrix_type", "enum"},
+		{"geo_hash inconsistente", map[string]interface{}{"geo_hash": "75cjzh"}, "geo_hash", "geo_hash"},
+		{"geo_hash invalido", map[string]interface{}{"geo_hash": "75cjza"}, "geo_hash", "geo_hash"},
+	}
+	for _, c := range cases {
+		record, violations := validateTestJSON(fixtureWith(t, c.fields))
+		if record != nil || len(violations) != 1 || !violationSet(violations)[[2]string{c.field, c.rule}] {
+			t.Errorf("%s: violacoes %+v, esperada %s/%s", c.name, violations, c.field, c.rule)
+		}
+	}
+
+	if _, violations := validateTestJSON("{"); len(violations) != 1 || violations[0].Rule != "json" {
+		t.Errorf("JSON malformado: %+v", violations)
+	}
+}
+
+func TestValidateTestJSONRejectsLedgerFields(t *testing.T) {
+	fields := map[string]interface{}{
+		"version":             7,
+		"created_at":          "2025-07-15T00:00:00Z",
+		"last_updated_at":     "2025-07-15T00:00:00Z",
+		"last_updated_by_msp": "org2MSP",
+		"last_updated_by":     "operador",
+		"lote_flags":          []string{},
+		"predictions":         map[string]interface{}{},
+	}
+
+	_, violations := validateTestJSON(fixtureWith(t, fields))
+	set := violationSet(violations)
+	if len(violations) != len(fields) {
+		t.Errorf("esperadas %d violacoes, obtidas %+v", len(fields), violations)
+	}
+	for field := range fields {
+		if !set[[2]string{field, "forbidden_field"}] {
+			t.Errorf("campo %s deveria ser rejeitado", field)
+		}
+	}
+
+	// Os campos preditos podem ser enviados, para correção pelo UpdateTest
+	corrections := map[string]interface{}{"acao_recomendada": "liberar", "result_class": "negative", "qc_status": "ok"}
+	if _, violations := validateTestJSON(fixtureWith(t, corrections)); len(violations) != 0 {
+		t.Errorf("campos preditos rejeitados: %+v", violations)
+	}
+
+	// Violações de naturezas diferentes são reportadas juntas
+	_, violations = validateTestJSON(fixtureWith(t, map[string]interface{}{"version": 2, "operador": "x", "lat": "norte"}))
+	set = violationSet(violations)
+	if len(violations) != 3 || !set[[2]string{"version", "forbidden_field"}] || !set[[2]string{"operador", "unknown_field"}] || !set[[2]string{"lat", "type"}] {
+		t.Errorf("violacoes inesperadas %+v", violations)
+	}
+}
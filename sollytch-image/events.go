@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Versão do formato dos eventos; muda apenas com alterações incompatíveis
+const eventSchemaVersion = 1
+
+// Tipos de evento emitidos pelo chaincode (um por transação)
+const (
+	EventImageAnchored      = "ImageAnchored"
+	EventImageUpdated       = "ImageUpdated"
+	EventImageKitReassigned = "ImageKitReassigned"
+	EventImageRevoked       = "ImageRevoked"
+)
+
+/*
+	struct json de um evento do chaincode, no mesmo envelope usado pelo
+	sollytch-chain. Os eventos levam apenas os identificadores da imagem;
+	motivos de alteração e metadados do arquivo ficam no ledger
+*/
+type ChaincodeEvent struct {
+	Type      string      `json:"type"`
+	Version   int         `json:"version"`
+	TxID      string      `json:"tx_id"`
+	Timestamp string      `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// dados dos eventos de imagem
+type ImageEventData struct {
+	HashData      string `json:"hashData"`
+	HashAlgorithm string `json:"hashAlgorithm"`
+	IDKit         string `json:"idKit"`
+	TestID        string `json:"testId,omitempty"`
+	Version       int    `json:"version"`
+	PreviousIDKit string `json:"previousIdKit,omitempty"`
+}
+
+// Emite o evento de uma imagem gravada ou alterada
+func emitImageEvent(ctx contractapi.TransactionContextInterface, eventType string, asset *ImageAsset, previousIdKit string) error {
+	stub := ctx.GetStub()
+
+	txTime, err := stub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(&ChaincodeEvent{
+		Type:    eventType,
+		Version: eventSchemaVersion,
+		TxID:    stub.GetTxID(),
+		Timestamp: time.Unix(
+			txTime.Seconds,
+			int64(txTime.Nanos),
+		).UTC().Format(time.RFC3339),
+		Data: &ImageEventData{
+			HashData:      asset.HashData,
+			HashAlgorithm: asset.HashAlgorithm,
+			IDKit:         asset.IDKit,
+			TestID:        asset.TestID,
+			Version:       asset.Version,
+			PreviousIDKit: previousIdKit,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao serializar evento %s: %v", eventType, err)
+	}
+
+	return stub.SetEvent(eventType, payload)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Papéis de um quadro capturado pelo leitor, na ordem em que são capturados
+var frameRoles = []string{"pre_run", "post_run", "control_line"}
+
+// Tamanho em caracteres hex do hash perceptual (64 bits)
+const perceptualHashLength = 16
+
+// Algoritmos de hash perceptual aceitos; dhash é o padrão dos clientes
+var perceptualHashAlgorithms = []string{"dhash", "phash"}
+
+// metadados de captura de um quadro informados na gravação
+type CaptureMetadata struct {
+	TestID         string  `json:"testId"`
+	FrameRole      string  `json:"frameRole"`
+	CaptureTime    string  `json:"captureTime"`
+	DeviceID       string  `json:"deviceId"`
+	Resolution     string  `json:"resolution"`
+	BlurScore      float64 `json:"blurScore"`
+	PerceptualHash string  `json:"perceptualHash"`
+
+	PerceptualHashAlgorithm string `json:"perceptualHashAlgorithm"`
+}
+
+/*
+	Função que desserializa os metadados informados no StoreImage: os do
+	arquivo (algorithm, encoding, fileSize, mimeType, fileName) e os da
+	captura (testId, frameRole, captureTime, deviceId, resolution,
+	blurScore, perceptualHash, perceptualHashAlgorithm), todos opcionais
+	e no mesmo objeto JSON
+*/
+func parseImageMetadata(metadataJSON string) (*FileMetadata, *CaptureMetadata, error) {
+	var metadata struct {
+		FileMetadata
+		CaptureMetadata
+	}
+	if metadataJSON != "" {
+		decoder := json.NewDecoder(strings.NewReader(metadataJSON))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&metadata); err != nil {
+			return nil, nil, fmt.Errorf("metadados da imagem invalidos: %v", err)
+		}
+	}
+
+	if err := metadata.FileMetadata.normalize(); err != nil {
+		return nil, nil, err
+	}
+	if err := metadata.CaptureMetadata.normalize(); err != nil {
+		return nil, nil, err
+	}
+
+	return &metadata.FileMetadata, &metadata.CaptureMetadata, nil
+}
+
+/*
+	Função que valida os metadados de captura: papel do quadro conhecido,
+	captureTime em RFC3339 (convertido para UTC), resolução no formato
+	<largura>x<altura>, blurScore não negativo e hash perceptual de
+	64 bits em hex (convertido para minúsculas), calculado por um dos
+	algoritmos aceitos (dhash quando não informado)
+*/
+func (capture *CaptureMetadata) normalize() error {
+	if capture.FrameRole != "" && frameRank(capture.FrameRole) == len(frameRoles) {
+		return fmt.Errorf("frameRole %q invalido, esperado um de: %s", capture.FrameRole, strings.Join(frameRoles, ", "))
+	}
+
+	if capture.CaptureTime != "" {
+		captureTime, err := time.Parse(time.RFC3339Nano, capture.CaptureTime)
+		if err != nil {
+			return fmt.Errorf("captureTime deve estar em RFC3339: %v", err)
+		}
+		capture.CaptureTime = captureTime.UTC().Format(time.RFC3339Nano)
+	}
+
+	if capture.Resolution != "" {
+		dimensions := strings.Split(strings.ToLower(capture.Resolution), "x")
+		if len(dimensions) != 2 {
+			return fmt.Errorf("resolution deve estar no formato <largura>x<altura>")
+		}
+		for _, dimension := range dimensions {
+			if value, err := strconv.Atoi(dimension); err != nil || value <= 0 {
+				return fmt.Errorf("resolution deve estar no formato <largura>x<altura>")
+			}
+		}
+		capture.Resolution = strings.Join(dimensions, "x")
+	}
+
+	if capture.BlurScore < 0 {
+		return fmt.Errorf("blurScore nao pode ser negativo")
+	}
+
+	if capture.PerceptualHash != "" {
+		perceptualHash, err := canonicalPerceptualHash(capture.PerceptualHash)
+		if err != nil {
+			return err
+		}
+		capture.PerceptualHash = perceptualHash
+
+		algorithm, err := perceptualHashAlgorithm(capture.PerceptualHashAlgorithm)
+		if err != nil {
+			return err
+		}
+		capture.PerceptualHashAlgorithm = algorithm
+	} else if capture.PerceptualHashAlgorithm != "" {
+		return fmt.Errorf("perceptualHashAlgorithm informado sem perceptualHash")
+	}
+
+	return nil
+}
+
+// Posição do papel do quadro na sequência de captura (papéis desconhecidos por último)
+func frameRank(frameRole string) int {
+	for i, role := range frameRoles {
+		if role == frameRole {
+			return i
+		}
+	}
+	return len(frameRoles)
+}
+
+// Momento da captura do quadro, ou o da gravação quando não informado
+func captureOrder(image *ImageAsset) time.Time {
+	for _, value := range []string{image.CaptureTime, image.Timestamp} {
+		if captured, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return captured
+		}
+	}
+	return time.Time{}
+}
+
+/*
+	Função que retorna os quadros capturados para um teste, em ordem de
+	captura (captureTime; empates seguem o papel do quadro: pre_run,
+	post_run, control_line). Imagens revogadas só são retornadas
+	quando includeRevoked for true
+*/
+func (c *SmartContract) GetImagesByTest(ctx contractapi.TransactionContextInterface, testID string, includeRevoked bool) ([]*ImageAsset, error) {
+	// Valida se recebeu o id do teste
+	if testID == "" {
+		return nil, fmt.Errorf("testID não pode ser vazio")
+	}
+
+	// Busca todas as chaves compostas associadas ao teste
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("teste~imagem", []string{testID})
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	results := []*ImageAsset{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Separa atributos da chave composta (testID, hash)
+		_, parts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		image, err := c.GetImageByID(ctx, parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if image.Revoked && !includeRevoked {
+			continue
+		}
+
+		results = append(results, image)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		ti, tj := captureOrder(results[i]), captureOrder(results[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return frameRank(results[i].FrameRole) < frameRank(results[j].FrameRole)
+	})
+
+	return results, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetImagesByTestOrdersFrames(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	// Gravadas fora de ordem; o controle empata com o post_run no captureTime
+	control := storeTestImage(t, contract, stub, ctx, "KIT-1", "control", map[string]interface{}{
+		"testId": "TEST-1", "frameRole": "control_line", "captureTime": "2025-07-15T10:05:00Z",
+	})
+	post := storeTestImage(t, contract, stub, ctx, "KIT-1", "post", map[string]interface{}{
+		"testId": "TEST-1", "frameRole": "post_run", "captureTime": "2025-07-15T07:05:00-03:00",
+	})
+	pre := storeTestImage(t, contract, stub, ctx, "KIT-1", "pre", map[string]interface{}{
+		"testId": "TEST-1", "frameRole": "pre_run", "captureTime": "2025-07-15T10:00:00Z",
+	})
+	revoked := storeTestImage(t, contract, stub, ctx, "KIT-1", "revoked", map[string]interface{}{
+		"testId": "TEST-1", "frameRole": "pre_run", "captureTime": "2025-07-15T09:00:00Z",
+	})
+	// Sem captureTime vale a data de gravação, posterior às capturas acima
+	untimed := storeTestImage(t, contract, stub, ctx, "KIT-1", "untimed", map[string]interface{}{
+		"testId": "TEST-1",
+	})
+	storeTestImage(t, contract, stub, ctx, "KIT-1", "other", map[string]interface{}{
+		"testId": "TEST-2", "frameRole": "pre_run", "captureTime": "2025-07-15T08:00:00Z",
+	})
+
+	stub.MockTransactionStart("revoke")
+	if err := contract.RevokeImage(ctx, revoked, "quadro desfocado"); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("revoke")
+
+	for includeRevoked, want := range map[bool][]string{
+		false: {pre, post, control, untimed},
+		true:  {revoked, pre, post, control, untimed},
+	} {
+		images, err := contract.GetImagesByTest(ctx, "TEST-1", includeRevoked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := imageHashes(images); !reflect.DeepEqual(got, want) {
+			t.Errorf("includeRevoked=%v: ordem %v, esperada %v", includeRevoked, got, want)
+		}
+	}
+
+	// O captureTime é normalizado para UTC
+	image, err := contract.GetImageByID(ctx, post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.CaptureTime != "2025-07-15T10:05:00Z" {
+		t.Errorf("captureTime deveria estar em UTC, obtido %s", image.CaptureTime)
+	}
+}
+
+func TestGetImagesByTestRequiresTestID(t *testing.T) {
+	contract, _, ctx := newTestContract(t)
+
+	if _, err := contract.GetImagesByTest(ctx, "", false); err == nil {
+		t.Error("testID vazio deveria ser rejeitado")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// Cria a identidade serializada (MSP + certificado X.509) de um cliente
+func newTestCreator(tb testing.TB, mspID string, commonName string, units ...string) []byte {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: units},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return creator
+}
+
+// Cria o contexto de transação sobre o stub, com a identidade do creator
+func newTestContext(tb testing.TB, stub *shimtest.MockStub) *contractapi.TransactionContext {
+	tb.Helper()
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+
+	identity, err := cid.New(stub)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ctx.SetClientIdentity(identity)
+
+	return ctx
+}
+
+// Troca o cliente do stub e retorna o contexto com a nova identidade
+func withCreator(tb testing.TB, stub *shimtest.MockStub, mspID string, commonName string, units ...string) *contractapi.TransactionContext {
+	tb.Helper()
+
+	stub.Creator = newTestCreator(tb, mspID, commonName, units...)
+	return newTestContext(tb, stub)
+}
+
+// Cria um stub em memória com um operador da org1MSP como cliente
+func newTestContract(tb testing.TB) (*SmartContract, *shimtest.MockStub, *contractapi.TransactionContext) {
+	tb.Helper()
+
+	stub := shimtest.NewMockStub("sollytch-image", nil)
+	ctx := withCreator(tb, stub, "org1MSP", "operador")
+
+	return new(SmartContract), stub, ctx
+}
+
+/*
+	Ancora no kit uma imagem cujo conteúdo é seed, com os metadados de
+	captura informados, em uma transação própria. Retorna o hash sha256
+	em hex da imagem
+*/
+func storeTestImage(tb testing.TB, contract *SmartContract, stub *shimtest.MockStub, ctx *contractapi.TransactionContext, idKit string, seed string, capture map[string]interface{}) string {
+	tb.Helper()
+
+	digest := sha256.Sum256([]byte(seed))
+	hashData := hex.EncodeToString(digest[:])
+
+	metadata := map[string]interface{}{"algorithm": "sha256"}
+	for field, value := range capture {
+		metadata[field] = value
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	stub.MockTransactionStart("store-" + seed)
+	defer stub.MockTransactionEnd("store-" + seed)
+
+	if err := contract.StoreImage(ctx, idKit, hashData, string(metadataJSON)); err != nil {
+		tb.Fatal(err)
+	}
+
+	return hashData
+}
+
+// Hashes das imagens, na ordem recebida
+func imageHashes(images []*ImageAsset) []string {
+	hashes := make([]string, len(images))
+	for i, image := range images {
+		hashes[i] = image.HashData
+	}
+	return hashes
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// struct json de uma versão da imagem no histórico
+type ImageHistoryEntry struct {
+	TxID      string      `json:"txId"`
+	Timestamp string      `json:"timestamp"`
+	IsDelete  bool        `json:"isDelete"`
+	Record    *ImageAsset `json:"record,omitempty" metadata:",optional"`
+}
+
+/*
+	Função que retorna o histórico de gravações de uma imagem, em ordem
+	cronológica, com o txID e o timestamp de cada transação. A primeira
+	entrada identifica a transação em que o hash foi ancorado no ledger
+*/
+func (c *SmartContract) GetImageHistory(ctx contractapi.TransactionContextInterface, hashImagem string) ([]*ImageHistoryEntry, error) {
+	// Valida se recebeu o hashImagem
+	if hashImagem == "" {
+		return nil, fmt.Errorf("hashImagem não pode ser vazio")
+	}
+
+	imageKey, err := resolveHashKey(imagemNamespace, hashImagem)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*ImageHistoryEntry{}
+	times := map[*ImageHistoryEntry]time.Time{}
+
+	// Durante a transição o histórico da chave antiga também é reunido;
+	// dela só entram as versões da imagem, sem a remoção feita pela migração
+	legacyKeys := legacyImageKeys(hashImagem, imageKey)
+	for i, historyKey := range append([]string{imageKey}, legacyKeys...) {
+		iterator, err := ctx.GetStub().GetHistoryForKey(historyKey)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao consultar histórico: %v", err)
+		}
+
+		for iterator.HasNext() {
+			modification, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+
+			legacy := i > 0
+			if legacy && (modification.IsDelete || !isLegacyImage(historyKey, modification.Value)) {
+				continue
+			}
+
+			txTime := time.Unix(
+				modification.Timestamp.GetSeconds(),
+				int64(modification.Timestamp.GetNanos()),
+			).UTC()
+
+			entry := &ImageHistoryEntry{
+				TxID:      modification.TxId,
+				Timestamp: txTime.Format(time.RFC3339Nano),
+				IsDelete:  modification.IsDelete,
+			}
+
+			// Versões removidas não possuem valor associado
+			if !modification.IsDelete {
+				var asset ImageAsset
+				if err := json.Unmarshal(modification.Value, &asset); err != nil {
+					iterator.Close()
+					return nil, fmt.Errorf("erro ao deserializar versão %s: %v", modification.TxId, err)
+				}
+				entry.Record = &asset
+			}
+
+			results = append(results, entry)
+			times[entry] = txTime
+		}
+		iterator.Close()
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("imagem %s não encontrada", hashImagem)
+	}
+
+	// Ordena cronologicamente, desempatando pela versão do registro
+	sort.SliceStable(results, func(i, j int) bool {
+		ti, tj := times[results[i]], times[results[j]]
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		if results[i].Record != nil && results[j].Record != nil {
+			return results[i].Record.Version < results[j].Record.Version
+		}
+		return false
+	})
+
+	return results, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+	Função que identifica quem submeteu a transação atual.
+	Retorna o MSP da organização e o subject do certificado X.509
+	do cliente, usados como trilha de auditoria nos registros
+*/
+func getSubmitter(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", "", fmt.Errorf("erro ao obter MSP do cliente: %v", err)
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return "", "", fmt.Errorf("erro ao obter certificado do cliente: %v", err)
+	}
+	if cert == nil {
+		return mspID, "", nil
+	}
+
+	return mspID, cert.Subject.String(), nil
+}
+
+// Organizações (MSPs) cujos administradores governam o chaincode, como no sollytch-chain
+var adminMSPs = []string{"org1MSP", "orgMSP"}
+
+/*
+	Função que indica se a transação foi submetida por um administrador de
+	uma das organizações em adminMSPs. Aceita identidades com o atributo
+	"role=admin" emitido pela Fabric CA ou certificados com OU=admin
+	(NodeOUs do MSP), como no sollytch-chain
+*/
+func isAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, fmt.Errorf("erro ao obter MSP do cliente: %v", err)
+	}
+
+	adminMSP := false
+	for _, allowed := range adminMSPs {
+		if mspID == allowed {
+			adminMSP = true
+			break
+		}
+	}
+	if !adminMSP {
+		return false, nil
+	}
+
+	role, found, err := ctx.GetClientIdentity().GetAttributeValue("role")
+	if err != nil {
+		return false, fmt.Errorf("erro ao obter atributos do cliente: %v", err)
+	}
+	if found && role == "admin" {
+		return true, nil
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return false, fmt.Errorf("erro ao obter certificado do cliente: %v", err)
+	}
+	if cert != nil {
+		for _, unit := range cert.Subject.OrganizationalUnit {
+			if unit == "admin" {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Função que exige que a transação tenha sido submetida por um administrador
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return fmt.Errorf("operacao restrita a administradores")
+	}
+	return nil
+}
+
+/*
+	Função que exige que a transação tenha sido submetida por um
+	administrador ou pela organização (MSP) que ancorou a imagem.
+	Imagens gravadas antes do registro de origem só podem ser
+	alteradas por administradores
+*/
+func requireImageOwner(ctx contractapi.TransactionContextInterface, asset *ImageAsset) error {
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if admin {
+		return nil
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("erro ao obter MSP do cliente: %v", err)
+	}
+	if asset.UploadedByMSP != "" && asset.UploadedByMSP == mspID {
+		return nil
+	}
+
+	return fmt.Errorf("operacao restrita a administradores ou ao MSP que ancorou a imagem %s", asset.HashData)
+}
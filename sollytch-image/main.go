@@ -18,6 +18,39 @@ type ImageAsset struct {
     // chave de busca
     IDKit         string `json:"idKit"`
     HashData      string `json:"hashData"`
+
+    // metadados do hash (hex minúsculo canônico) e do arquivo de origem
+    HashAlgorithm string `json:"hashAlgorithm"`
+    HashEncoding  string `json:"hashEncoding"`
+    FileSize      int64  `json:"fileSize"`
+    MimeType      string `json:"mimeType"`
+    FileName      string `json:"fileName"`
+
+    // metadados de captura do quadro (testId indexado em "teste~imagem")
+    TestID         string  `json:"testId"`
+    FrameRole      string  `json:"frameRole"`
+    CaptureTime    string  `json:"captureTime"`
+    DeviceID       string  `json:"deviceId"`
+    Resolution     string  `json:"resolution"`
+    BlurScore      float64 `json:"blurScore"`
+    PerceptualHash string  `json:"perceptualHash"`
+
+    // algoritmo do hash perceptual (indexado em "phash~hashImagem")
+    PerceptualHashAlgorithm string `json:"perceptualHashAlgorithm"`
+
+    // organização e identidade que ancoraram a imagem; além dos
+    // administradores, só o MSP de origem pode reatribuí-la ou revogá-la
+    UploadedByMSP string `json:"uploadedByMSP,omitempty" metadata:",optional"`
+    UploadedBy    string `json:"uploadedBy,omitempty" metadata:",optional"`
+
+    // autoria da última alteração feita por ReassignImageKit ou RevokeImage
+    LastUpdatedByMSP string `json:"lastUpdatedByMSP,omitempty" metadata:",optional"`
+    LastUpdatedBy    string `json:"lastUpdatedBy,omitempty" metadata:",optional"`
+    ChangeReason     string `json:"changeReason,omitempty" metadata:",optional"`
+
+    // tombstone: imagens revogadas são mantidas, mas marcadas como tal
+    Revoked       bool             `json:"revoked"`
+    Revocation    *ImageRevocation `json:"revocation,omitempty" metadata:",optional"`
 }
 
 type SmartContract struct {
@@ -26,16 +59,32 @@ type SmartContract struct {
 
 /*
 	Função responsável por armazenar ou atualizar o hash de uma imagem no ledger. Recebe hashData como
-    chave principal e idKit como indice secundário por meio de chave composta
+    chave principal e idKit como indice secundário por meio de chave composta. O JSON de metadados
+    (algorithm, encoding, fileSize, mimeType, fileName) define como o hash é validado; a chave
+    principal recebe o namespace "imagem:<algoritmo>:<hex>". O mesmo JSON pode trazer os metadados
+    de captura do quadro (testId, frameRole, captureTime, deviceId, resolution, blurScore,
+    perceptualHash, perceptualHashAlgorithm); com testId a imagem também é indexada por teste
+    (ver GetImagesByTest) e com perceptualHash pelo hash perceptual (ver FindSimilarImages)
 */
-func (c *SmartContract) StoreImage(ctx contractapi.TransactionContextInterface, idKit string, hashData string) error {
+func (c *SmartContract) StoreImage(ctx contractapi.TransactionContextInterface, idKit string, hashData string, metadataJSON string) error {
 	// Valida se recebeu o hash da imagem e o id do kit
 	if hashData == "" || idKit == "" {
 		return fmt.Errorf("hashData e idKit são obrigatórios")
 	}
 
-	// Define hash como chave principal
-	imageKey := hashData
+	// Valida os metadados e o formato do hash
+	metadata, capture, err := parseImageMetadata(metadataJSON)
+	if err != nil {
+		return err
+	}
+	rawHash := hashData
+	hashData, err = canonicalHash(hashData, metadata.Algorithm, metadata.Encoding)
+	if err != nil {
+		return err
+	}
+
+	// Define hash com namespace como chave principal
+	imageKey := namespacedHashKey(imagemNamespace, metadata.Algorithm, hashData)
 
 	// Obtém timestamp da transação
 	txTime, err := ctx.GetStub().GetTxTimestamp()
@@ -48,28 +97,36 @@ func (c *SmartContract) StoreImage(ctx contractapi.TransactionContextInterface,
 		int64(txTime.Nanos),
 	).UTC().Format(time.RFC3339)
 
-	// Verifica se a imagem já existe
-	exists, err := c.ImageExists(ctx, imageKey)
+	// Verifica se a imagem já existe, inclusive na chave antiga (o hash como enviado)
+	assetBytes, _, foundKey, err := getImageState(ctx, rawHash)
 	if err != nil {
 		return err
 	}
+	exists := assetBytes != nil
 
 	var asset ImageAsset
 
     // caso exista
 	if exists {
-		// Carrega imagem existente para atualização
-		assetBytes, err := ctx.GetStub().GetState(imageKey)
-		if err != nil {
+		// Desserializa dados existentes
+		if err := json.Unmarshal(assetBytes, &asset); err != nil {
 			return err
 		}
-		if assetBytes == nil {
-			return fmt.Errorf("falha ao carregar imagem existente com hash %s", hashData)
+
+		// Imagens ainda na chave antiga são convertidas e migradas nesta escrita
+		if foundKey != imageKey {
+			if err := migrateLegacyImage(ctx, imageKey, foundKey, &asset); err != nil {
+				return err
+			}
 		}
 
-		// Desserializa dados existentes
-		if err := json.Unmarshal(assetBytes, &asset); err != nil {
-			return err
+		// Imagens revogadas não voltam a ser gravadas e a troca de kit
+		// é feita explicitamente por ReassignImageKit
+		if asset.Revoked {
+			return fmt.Errorf("imagem %s revogada", hashData)
+		}
+		if asset.IDKit != idKit {
+			return fmt.Errorf("imagem %s ja registrada no kit %s, use ReassignImageKit", hashData, asset.IDKit)
 		}
 
 		// Incrementa versão e atualiza timestamp
@@ -79,13 +136,37 @@ func (c *SmartContract) StoreImage(ctx contractapi.TransactionContextInterface,
 
     // Se não existe
 	} else {
+		// Identifica quem ancorou a imagem
+		mspID, subject, err := getSubmitter(ctx)
+		if err != nil {
+			return err
+		}
+
 		// Cria novo registro de imagem
 		asset = ImageAsset{
 			IDKit:         idKit,
 			Timestamp:     formattedTime,
 			HashData:      hashData,
+			HashAlgorithm: metadata.Algorithm,
+			HashEncoding:  metadata.Encoding,
+			FileSize:      metadata.FileSize,
+			MimeType:      metadata.MimeType,
+			FileName:      metadata.FileName,
 			Version:       0,
 			LastUpdatedAt: formattedTime,
+
+			TestID:         capture.TestID,
+			FrameRole:      capture.FrameRole,
+			CaptureTime:    capture.CaptureTime,
+			DeviceID:       capture.DeviceID,
+			Resolution:     capture.Resolution,
+			BlurScore:      capture.BlurScore,
+			PerceptualHash: capture.PerceptualHash,
+
+			PerceptualHashAlgorithm: capture.PerceptualHashAlgorithm,
+
+			UploadedByMSP: mspID,
+			UploadedBy:    subject,
 		}
 
 		// Cria chave composta para indexação por kit
@@ -101,22 +182,59 @@ func (c *SmartContract) StoreImage(ctx contractapi.TransactionContextInterface,
 		if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
 			return err
 		}
+
+		// Quadros de um teste também são indexados pelo testId
+		if capture.TestID != "" {
+			testIndexKey, err := ctx.GetStub().CreateCompositeKey(
+				"teste~imagem",
+				[]string{capture.TestID, hashData},
+			)
+			if err != nil {
+				return err
+			}
+			if err := ctx.GetStub().PutState(testIndexKey, []byte{0x00}); err != nil {
+				return err
+			}
+		}
+
+		// O hash perceptual permite encontrar cópias recodificadas da imagem
+		if capture.PerceptualHash != "" {
+			phashIndexKey, err := ctx.GetStub().CreateCompositeKey(
+				"phash~hashImagem",
+				[]string{capture.PerceptualHashAlgorithm, capture.PerceptualHash, hashData},
+			)
+			if err != nil {
+				return err
+			}
+			if err := ctx.GetStub().PutState(phashIndexKey, []byte{0x00}); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Serializa objeto
-	assetBytes, err := json.Marshal(asset)
+	assetBytes, err = json.Marshal(asset)
 	if err != nil {
 		return err
 	}
 
-	// Salva o hash como chave principal
-	return ctx.GetStub().PutState(imageKey, assetBytes)
+	// Salva o registro sob a chave com namespace, removendo a chave antiga
+	if err := putStateMigrating(ctx, imageKey, foundKey, assetBytes); err != nil {
+		return err
+	}
+
+	eventType := EventImageAnchored
+	if exists {
+		eventType = EventImageUpdated
+	}
+	return emitImageEvent(ctx, eventType, &asset, "")
 }
 
 /*
-	Função que retorna todos os hashes de imagens atrelados a um unico kit. Retorna uma lista com todos os itens inclusos
+	Função que retorna todos os hashes de imagens atrelados a um unico kit. Retorna uma lista com todos os itens inclusos.
+    Imagens revogadas só são retornadas quando includeRevoked for true
 */
-func (c *SmartContract) GetImagesByKit(ctx contractapi.TransactionContextInterface, idKit string,) ([]*ImageAsset, error) {
+func (c *SmartContract) GetImagesByKit(ctx contractapi.TransactionContextInterface, idKit string, includeRevoked bool) ([]*ImageAsset, error) {
     // Valida se recebeu o id do kit
     if idKit==""{
         return nil, fmt.Errorf("idKit não pode ser vazio")
@@ -132,7 +250,7 @@ func (c *SmartContract) GetImagesByKit(ctx contractapi.TransactionContextInterfa
     }
     defer iterator.Close()
 
-    var results []*ImageAsset
+    results := []*ImageAsset{}
 
 	// Itera sobre todos os hashes encontrados
     for iterator.HasNext() {
@@ -155,6 +273,10 @@ func (c *SmartContract) GetImagesByKit(ctx contractapi.TransactionContextInterfa
             return nil, err
         }
 
+        if image.Revoked && !includeRevoked {
+            continue
+        }
+
         results = append(results, image)
     }
 
@@ -163,9 +285,10 @@ func (c *SmartContract) GetImagesByKit(ctx contractapi.TransactionContextInterfa
 
 
 /*
-	Função que recupera uma imagem específica a partir do seu hash.
-	Realiza busca direta no ledger usando o hash como chave principal
-	e retorna um único objeto ImageAsset
+	Função que recupera uma imagem específica a partir do seu hash (hex ou base64).
+	Resolve a chave principal "imagem:<algoritmo>:<hex>" (ou, para imagens
+	ainda não migradas, a chave antiga), realiza busca direta
+	no ledger e retorna um único objeto ImageAsset
 */
 func (c *SmartContract) GetImageByID(ctx contractapi.TransactionContextInterface, hashImagem string,) (*ImageAsset, error) {
 	// Valida se recebeu o hashImagem
@@ -173,12 +296,10 @@ func (c *SmartContract) GetImageByID(ctx contractapi.TransactionContextInterface
         return nil, fmt.Errorf("hashImagem não pode ser vazio")
     }
 
-    imageKey := hashImagem
-
 	// Consulta estado no ledger
-    data, err := ctx.GetStub().GetState(imageKey)
+    data, _, _, err := getImageState(ctx, hashImagem)
     if err != nil {
-        return nil, fmt.Errorf("erro ao acessar o ledger: %v", err)
+        return nil, err
     }
     if data == nil {
         return nil, fmt.Errorf("imagem %s não encontrada", hashImagem)
@@ -193,11 +314,11 @@ func (c *SmartContract) GetImageByID(ctx contractapi.TransactionContextInterface
     return &asset, nil
 }
 
-// Função para verificar se já existe registro de um hash recebido
-func (c *SmartContract) ImageExists(ctx contractapi.TransactionContextInterface, key string,) (bool, error) {
-    data, err := ctx.GetStub().GetState(key)
+// Função para verificar se já existe registro de um hash recebido (hex ou base64)
+func (c *SmartContract) ImageExists(ctx contractapi.TransactionContextInterface, hashImagem string,) (bool, error) {
+    data, _, _, err := getImageState(ctx, hashImagem)
     if err != nil {
-        return false, fmt.Errorf("erro ao verificar estado: %v", err)
+        return false, err
     }
     return data != nil, nil
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// tombstone de uma imagem revogada: motivo e identidade de quem revogou
+type ImageRevocation struct {
+	Reason       string `json:"reason"`
+	RevokedAt    string `json:"revokedAt"`
+	RevokedByMSP string `json:"revokedByMSP"`
+	RevokedBy    string `json:"revokedBy"`
+}
+
+/*
+	Carrega uma imagem existente para alterá-la. Retorna a chave com
+	namespace e a chave em que a imagem foi encontrada; imagens ainda na
+	chave antiga são convertidas e migradas na gravação (putImageChange)
+*/
+func loadImage(ctx contractapi.TransactionContextInterface, hashImagem string) (*ImageAsset, string, string, error) {
+	data, imageKey, foundKey, err := getImageState(ctx, hashImagem)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if data == nil {
+		return nil, "", "", fmt.Errorf("imagem %s não encontrada", hashImagem)
+	}
+
+	var asset ImageAsset
+	if err := json.Unmarshal(data, &asset); err != nil {
+		return nil, "", "", fmt.Errorf("erro ao deserializar imagem: %v", err)
+	}
+
+	if foundKey != imageKey {
+		if err := migrateLegacyImage(ctx, imageKey, foundKey, &asset); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	return &asset, imageKey, foundKey, nil
+}
+
+/*
+	Função que grava uma alteração feita em uma imagem: incrementa a
+	versão e registra a data, o motivo e a identidade de quem alterou.
+	Imagens lidas da chave antiga passam para a chave com namespace
+*/
+func putImageChange(ctx contractapi.TransactionContextInterface, imageKey string, foundKey string, asset *ImageAsset, reason string) error {
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return err
+	}
+
+	asset.Version++
+	asset.LastUpdatedAt = time.Unix(
+		txTime.Seconds,
+		int64(txTime.Nanos),
+	).UTC().Format(time.RFC3339)
+	asset.LastUpdatedByMSP = mspID
+	asset.LastUpdatedBy = subject
+	asset.ChangeReason = reason
+
+	// O tombstone registra a mesma data e identidade da alteração
+	if asset.Revoked && asset.Revocation == nil {
+		asset.Revocation = &ImageRevocation{
+			Reason:       reason,
+			RevokedAt:    asset.LastUpdatedAt,
+			RevokedByMSP: mspID,
+			RevokedBy:    subject,
+		}
+	}
+
+	assetBytes, err := json.Marshal(asset)
+	if err != nil {
+		return err
+	}
+
+	return putStateMigrating(ctx, imageKey, foundKey, assetBytes)
+}
+
+/*
+	Função que corrige o kit de uma imagem enviada para o kit errado.
+	Move o índice "kit~hashImagem" do kit antigo para o novo e registra
+	o motivo e a identidade de quem fez a troca. Apenas administradores
+	ou o MSP que ancorou a imagem podem reatribuí-la, e imagens
+	revogadas não podem ser reatribuídas
+*/
+func (c *SmartContract) ReassignImageKit(ctx contractapi.TransactionContextInterface, hashImagem string, newIdKit string, reason string) error {
+	if hashImagem == "" || newIdKit == "" || reason == "" {
+		return fmt.Errorf("hashImagem, newIdKit e reason são obrigatórios")
+	}
+
+	asset, imageKey, foundKey, err := loadImage(ctx, hashImagem)
+	if err != nil {
+		return err
+	}
+	if err := requireImageOwner(ctx, asset); err != nil {
+		return err
+	}
+	if asset.Revoked {
+		return fmt.Errorf("imagem %s revogada nao pode ser reatribuida", asset.HashData)
+	}
+	if asset.IDKit == newIdKit {
+		return fmt.Errorf("imagem %s ja pertence ao kit %s", asset.HashData, newIdKit)
+	}
+
+	// Move o índice do kit antigo para o novo
+	oldIndexKey, err := ctx.GetStub().CreateCompositeKey("kit~hashImagem", []string{asset.IDKit, asset.HashData})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(oldIndexKey); err != nil {
+		return err
+	}
+
+	newIndexKey, err := ctx.GetStub().CreateCompositeKey("kit~hashImagem", []string{newIdKit, asset.HashData})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(newIndexKey, []byte{0x00}); err != nil {
+		return err
+	}
+
+	previousIdKit := asset.IDKit
+	asset.IDKit = newIdKit
+
+	if err := putImageChange(ctx, imageKey, foundKey, asset, reason); err != nil {
+		return err
+	}
+
+	return emitImageEvent(ctx, EventImageKitReassigned, asset, previousIdKit)
+}
+
+/*
+	Função que revoga uma imagem. O registro não é apagado: permanece no
+	ledger como tombstone, com o motivo e a identidade de quem revogou,
+	e o índice do kit é mantido para que GetImagesByKit possa listá-lo
+	quando includeRevoked for true. Apenas administradores ou o MSP que
+	ancorou a imagem podem revogá-la, e a revogação é definitiva
+*/
+func (c *SmartContract) RevokeImage(ctx contractapi.TransactionContextInterface, hashImagem string, reason string) error {
+	if hashImagem == "" || reason == "" {
+		return fmt.Errorf("hashImagem e reason são obrigatórios")
+	}
+
+	asset, imageKey, foundKey, err := loadImage(ctx, hashImagem)
+	if err != nil {
+		return err
+	}
+	if err := requireImageOwner(ctx, asset); err != nil {
+		return err
+	}
+	if asset.Revoked {
+		return fmt.Errorf("imagem %s ja revogada", asset.HashData)
+	}
+
+	asset.Revoked = true
+
+	if err := putImageChange(ctx, imageKey, foundKey, asset, reason); err != nil {
+		return err
+	}
+
+	return emitImageEvent(ctx, EventImageRevoked, asset, "")
+}
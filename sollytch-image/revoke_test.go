@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRevokeImageKeepsTombstone(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	kept := storeTestImage(t, contract, stub, ctx, "KIT-1", "mantida", nil)
+	revoked := storeTestImage(t, contract, stub, ctx, "KIT-1", "revogada", nil)
+
+	stub.MockTransactionStart("revoke")
+	if err := contract.RevokeImage(ctx, revoked, "foto de outro kit"); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("revoke")
+
+	// O registro continua no ledger, marcado com o motivo e o autor
+	image, err := contract.GetImageByID(ctx, revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !image.Revoked || image.Revocation == nil {
+		t.Fatalf("imagem deveria estar revogada com tombstone: %+v", image)
+	}
+	if image.Version != 1 || image.Revocation.Reason != "foto de outro kit" || image.Revocation.RevokedByMSP != "org1MSP" || image.Revocation.RevokedAt != image.LastUpdatedAt {
+		t.Errorf("tombstone inesperado: version=%d %+v", image.Version, image.Revocation)
+	}
+	if !strings.Contains(image.Revocation.RevokedBy, "CN=operador") {
+		t.Errorf("revokedBy deveria identificar o operador, obtido %q", image.Revocation.RevokedBy)
+	}
+
+	// A revogação é definitiva e a imagem não volta a ser gravada
+	stub.MockTransactionStart("again")
+	if err := contract.RevokeImage(ctx, revoked, "de novo"); err == nil {
+		t.Error("imagem ja revogada nao deveria ser revogada novamente")
+	}
+	if err := contract.StoreImage(ctx, "KIT-1", revoked, `{"algorithm":"sha256"}`); err == nil {
+		t.Error("imagem revogada nao deveria ser regravada")
+	}
+	stub.MockTransactionEnd("again")
+
+	// GetImagesByKit só lista a revogada com includeRevoked
+	for includeRevoked, want := range map[bool][]string{
+		false: {kept},
+		true:  {kept, revoked},
+	} {
+		images, err := contract.GetImagesByKit(ctx, "KIT-1", includeRevoked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := imageHashes(images)
+		if !sameHashes(got, want) {
+			t.Errorf("includeRevoked=%v: obtido %v, esperado %v", includeRevoked, got, want)
+		}
+	}
+}
+
+func TestReassignImageKitMovesKitIndex(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+	hashData := storeTestImage(t, contract, stub, ctx, "KIT-ERRADO", "foto", nil)
+
+	stub.MockTransactionStart("reassign")
+	if err := contract.ReassignImageKit(ctx, hashData, "KIT-CERTO", "kit digitado errado"); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("reassign")
+
+	// O índice "kit~hashImagem" sai do kit antigo e passa para o novo
+	for idKit, present := range map[string]bool{"KIT-ERRADO": false, "KIT-CERTO": true} {
+		indexKey, err := stub.CreateCompositeKey("kit~hashImagem", []string{idKit, hashData})
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := stub.GetState(indexKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (value != nil) != present {
+			t.Errorf("indice do kit %s presente=%v, esperado %v", idKit, value != nil, present)
+		}
+
+		images, err := contract.GetImagesByKit(ctx, idKit, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(images) == 1) != present {
+			t.Errorf("kit %s lista %d imagens", idKit, len(images))
+		}
+	}
+
+	image, err := contract.GetImageByID(ctx, hashData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.IDKit != "KIT-CERTO" || image.ChangeReason != "kit digitado errado" || image.Version != 1 {
+		t.Errorf("imagem reatribuida inesperada: %+v", image)
+	}
+
+	// Imagens revogadas não podem ser reatribuídas
+	stub.MockTransactionStart("revoked")
+	defer stub.MockTransactionEnd("revoked")
+	if err := contract.RevokeImage(ctx, hashData, "duplicada"); err != nil {
+		t.Fatal(err)
+	}
+	if err := contract.ReassignImageKit(ctx, hashData, "KIT-ERRADO", "volta"); err == nil {
+		t.Error("imagem revogada nao deveria ser reatribuida")
+	}
+}
+
+func TestImageChangesRequireOwnerOrAdmin(t *testing.T) {
+	contract, stub, _ := newTestContract(t)
+	uploader := withCreator(t, stub, "org3MSP", "operador")
+	hashData := storeTestImage(t, contract, stub, uploader, "KIT-1", "foto", nil)
+
+	// Outros MSPs, inclusive os seus administradores, não alteram a imagem
+	stub.MockTransactionStart("outsider")
+	outsider := withCreator(t, stub, "org2MSP", "operador")
+	otherAdmin := withCreator(t, stub, "org2MSP", "admin", "admin")
+	checks := map[string]error{
+		"ReassignImageKit":         contract.ReassignImageKit(outsider, hashData, "KIT-2", "troca"),
+		"RevokeImage":              contract.RevokeImage(outsider, hashData, "revoga"),
+		"RevokeImage (org2 admin)": contract.RevokeImage(otherAdmin, hashData, "revoga"),
+	}
+	stub.MockTransactionEnd("outsider")
+	for name, err := range checks {
+		if err == nil || !strings.Contains(err.Error(), "administradores ou ao MSP") {
+			t.Errorf("%s de outro MSP deveria ser rejeitado, erro: %v", name, err)
+		}
+	}
+
+	// Outro usuário do MSP de origem pode corrigir o kit
+	stub.MockTransactionStart("colleague")
+	colleague := withCreator(t, stub, "org3MSP", "colega")
+	if err := contract.ReassignImageKit(colleague, hashData, "KIT-2", "troca"); err != nil {
+		t.Error(err)
+	}
+	stub.MockTransactionEnd("colleague")
+
+	// Administradores das organizações em adminMSPs podem revogar
+	stub.MockTransactionStart("admin")
+	admin := withCreator(t, stub, "org1MSP", "admin", "admin")
+	if err := contract.RevokeImage(admin, hashData, "revoga"); err != nil {
+		t.Error(err)
+	}
+	stub.MockTransactionEnd("admin")
+
+	image, err := contract.GetImageByID(admin, hashData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.UploadedByMSP != "org3MSP" || image.Revocation == nil || image.Revocation.RevokedByMSP != "org1MSP" {
+		t.Errorf("autoria inesperada: uploadedByMSP=%s revocation=%+v", image.UploadedByMSP, image.Revocation)
+	}
+}
+
+// Compara duas listas de hashes sem considerar a ordem
+func sameHashes(got []string, want []string) bool {
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	return reflect.DeepEqual(got, want)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Maior distância de Hamming aceita na busca por imagens semelhantes
+const maxPerceptualDistance = 24
+
+// Quantidade de imagens semelhantes retornadas por padrão e no máximo
+const (
+	defaultSimilarLimit = 20
+	maxSimilarLimit     = 100
+)
+
+// imagem encontrada na busca por semelhança e a sua distância ao hash buscado
+type SimilarImage struct {
+	Distance int         `json:"distance"`
+	Image    *ImageAsset `json:"image"`
+}
+
+// chave do índice dentro da distância buscada, ainda sem a imagem carregada
+type similarCandidate struct {
+	distance   int
+	hashImagem string
+}
+
+// Valida um hash perceptual de 64 bits e retorna a sua forma canônica (hex minúsculo)
+func canonicalPerceptualHash(perceptualHash string) (string, error) {
+	perceptualHash = strings.ToLower(perceptualHash)
+	if _, err := hex.DecodeString(perceptualHash); err != nil || len(perceptualHash) != perceptualHashLength {
+		return "", fmt.Errorf("perceptualHash deve ter %d caracteres hex", perceptualHashLength)
+	}
+	return perceptualHash, nil
+}
+
+// Valida o algoritmo do hash perceptual, assumindo dhash quando não informado
+func perceptualHashAlgorithm(algorithm string) (string, error) {
+	algorithm = strings.ToLower(algorithm)
+	if algorithm == "" {
+		return perceptualHashAlgorithms[0], nil
+	}
+	for _, accepted := range perceptualHashAlgorithms {
+		if accepted == algorithm {
+			return algorithm, nil
+		}
+	}
+	return "", fmt.Errorf("perceptualHashAlgorithm %q invalido, esperado um de: %s", algorithm, strings.Join(perceptualHashAlgorithms, ", "))
+}
+
+// Número de bits diferentes entre dois hashes perceptuais canônicos
+func hammingDistance(a string, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return bits.OnesCount64(x ^ y), nil
+}
+
+/*
+	Função que busca imagens já ancoradas cujo hash perceptual esteja a
+	no máximo maxDistance bits do informado, para identificar a mesma foto
+	recodificada ou recortada e reutilizada em outros kits. Só são
+	comparados hashes do mesmo algoritmo (dhash quando não informado).
+	O resultado vem ordenado pela distância e, nos empates, pela data
+	de gravação, limitado às limit imagens mais próximas (0 usa o padrão
+	de 20, no máximo 100). Imagens revogadas só são retornadas quando
+	includeRevoked for true.
+	A consulta percorre todo o índice "phash~hashImagem" do algoritmo, então
+	o custo cresce com o número de imagens ancoradas; o limit reduz apenas
+	as leituras das imagens e o tamanho da resposta
+*/
+func (c *SmartContract) FindSimilarImages(ctx contractapi.TransactionContextInterface, perceptualHash string, algorithm string, maxDistance int, includeRevoked bool, limit int) ([]*SimilarImage, error) {
+	perceptualHash, err := canonicalPerceptualHash(perceptualHash)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err = perceptualHashAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if maxDistance < 0 || maxDistance > maxPerceptualDistance {
+		return nil, fmt.Errorf("maxDistance deve estar entre 0 e %d", maxPerceptualDistance)
+	}
+	if limit == 0 {
+		limit = defaultSimilarLimit
+	}
+	if limit < 0 || limit > maxSimilarLimit {
+		return nil, fmt.Errorf("limit deve estar entre 0 e %d", maxSimilarLimit)
+	}
+
+	// A distância de Hamming não tem ordem útil no ledger, então o índice
+	// do algoritmo é percorrido inteiro; ele guarda só chaves, sem valores
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("phash~hashImagem", []string{algorithm})
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	// Primeiro seleciona as chaves dentro da distância, sem ler as imagens
+	candidates := []*similarCandidate{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// Separa atributos da chave composta (algoritmo, hash perceptual, hash)
+		_, parts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		distance, err := hammingDistance(perceptualHash, parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if distance > maxDistance {
+			continue
+		}
+
+		candidates = append(candidates, &similarCandidate{distance: distance, hashImagem: parts[2]})
+	}
+
+	// Lê as imagens da mais próxima para a mais distante até completar o
+	// limite; os empates de distância são lidos por inteiro para serem
+	// ordenados pela data de gravação
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	results := []*SimilarImage{}
+	for _, candidate := range candidates {
+		if len(results) >= limit && candidate.distance > results[len(results)-1].Distance {
+			break
+		}
+
+		image, err := c.GetImageByID(ctx, candidate.hashImagem)
+		if err != nil {
+			return nil, err
+		}
+		if image.Revoked && !includeRevoked {
+			continue
+		}
+
+		results = append(results, &SimilarImage{Distance: candidate.distance, Image: image})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].Image.Timestamp < results[j].Image.Timestamp
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHammingDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"0000000000000000", "0000000000000000", 0},
+		{"0000000000000000", "0000000000000001", 1},
+		{"0000000000000000", "ffffffffffffffff", 64},
+		{"f0f0f0f0f0f0f0f0", "0f0f0f0f0f0f0f0f", 64},
+		{"8000000000000001", "0000000000000000", 2},
+		{"00000000000000ff", "000000000000000f", 4},
+	}
+	for _, c := range cases {
+		distance, err := hammingDistance(c.a, c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if distance != c.distance {
+			t.Errorf("hammingDistance(%s, %s) = %d, esperado %d", c.a, c.b, distance, c.distance)
+		}
+	}
+
+	if _, err := hammingDistance("zz", "00"); err == nil {
+		t.Error("hash invalido deveria ser rejeitado")
+	}
+}
+
+func TestFindSimilarImages(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	phash := func(seed string, perceptualHash string, algorithm string) string {
+		return storeTestImage(t, contract, stub, ctx, "KIT-1", seed, map[string]interface{}{
+			"perceptualHash": perceptualHash, "perceptualHashAlgorithm": algorithm,
+		})
+	}
+	same := phash("mesma", "00000000000000FF", "")
+	oneBit := phash("um-bit", "00000000000000fe", "dhash")
+	fourBits := phash("quatro-bits", "000000000000000f", "dhash")
+	phash("distante", "ffffffffffffff00", "dhash")
+	phash("outro-algoritmo", "00000000000000ff", "phash")
+	revoked := phash("revogada", "00000000000001ff", "dhash")
+
+	stub.MockTransactionStart("revoke")
+	if err := contract.RevokeImage(ctx, revoked, "copia"); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("revoke")
+
+	cases := []struct {
+		name           string
+		maxDistance    int
+		includeRevoked bool
+		limit          int
+		want           []string
+		distances      []int
+	}{
+		{"exata", 0, false, 0, []string{same}, []int{0}},
+		{"por distancia", 4, false, 0, []string{same, oneBit, fourBits}, []int{0, 1, 4}},
+		{"com revogadas", 4, true, 0, []string{same, oneBit, revoked, fourBits}, []int{0, 1, 1, 4}},
+		{"distancia maxima", maxPerceptualDistance, true, 0, []string{same, oneBit, revoked, fourBits}, []int{0, 1, 1, 4}},
+		{"limitada", maxPerceptualDistance, true, 2, []string{same, oneBit}, []int{0, 1}},
+	}
+	for _, c := range cases {
+		matches, err := contract.FindSimilarImages(ctx, "00000000000000ff", "", c.maxDistance, c.includeRevoked, c.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]string, len(matches))
+		distances := make([]int, len(matches))
+		for i, match := range matches {
+			got[i] = match.Image.HashData
+			distances[i] = match.Distance
+		}
+		if !reflect.DeepEqual(got, c.want) || !reflect.DeepEqual(distances, c.distances) {
+			t.Errorf("%s: obtido %v %v, esperado %v %v", c.name, got, distances, c.want, c.distances)
+		}
+	}
+
+	// Hashes de outros algoritmos não são comparados
+	matches, err := contract.FindSimilarImages(ctx, "00000000000000ff", "phash", 0, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Image.PerceptualHashAlgorithm != "phash" {
+		t.Errorf("busca por phash deveria encontrar so a imagem phash: %v", matches)
+	}
+
+}
+
+func TestFindSimilarImagesValidatesInput(t *testing.T) {
+	contract, _, ctx := newTestContract(t)
+
+	cases := []struct {
+		perceptualHash, algorithm string
+		maxDistance, limit        int
+	}{
+		{"00ff", "", 0, 0},
+		{"zzzzzzzzzzzzzzzz", "", 0, 0},
+		{"00000000000000ff", "md5", 0, 0},
+		{"00000000000000ff", "", -1, 0},
+		{"00000000000000ff", "", maxPerceptualDistance + 1, 0},
+		{"00000000000000ff", "", 0, -1},
+		{"00000000000000ff", "", 0, maxSimilarLimit + 1},
+	}
+	for _, c := range cases {
+		if _, err := contract.FindSimilarImages(ctx, c.perceptualHash, c.algorithm, c.maxDistance, false, c.limit); err == nil {
+			t.Errorf("FindSimilarImages(%q, %q, %d, limit %d) deveria falhar", c.perceptualHash, c.algorithm, c.maxDistance, c.limit)
+		}
+	}
+}
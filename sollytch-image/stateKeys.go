@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+/*
+	Imagens gravadas antes do namespace "imagem:<algoritmo>:<hex>" estão na
+	chave antiga: o hash exatamente como enviado pelo cliente. Durante a
+	transição elas continuam legíveis pela chave antiga, são migradas a
+	cada escrita e, de uma vez, por MigrateStateKeys
+*/
+
+// Maior chave simples possível, usada como fim da varredura da migração
+var maxStateKey = string(utf8.MaxRune)
+
+// campo usado para identificar uma imagem gravada sem namespace
+type legacyImageProbe struct {
+	HashData *string `json:"hashData"`
+}
+
+// Indica se o valor de uma chave antiga é uma imagem gravada sob o próprio hash
+func isLegacyImage(key string, value []byte) bool {
+	var probe legacyImageProbe
+	if err := json.Unmarshal(value, &probe); err != nil {
+		return false
+	}
+	return probe.HashData != nil && strings.EqualFold(*probe.HashData, key)
+}
+
+/*
+	Chaves antigas em que uma imagem pode estar: o hash como informado e,
+	se for diferente, a sua forma canônica (hex minúsculo), que era a
+	enviada pelos clientes
+*/
+func legacyImageKeys(hashImagem string, imageKey string) []string {
+	keys := []string{hashImagem}
+	if canonical := imageKey[strings.LastIndex(imageKey, ":")+1:]; canonical != hashImagem {
+		keys = append(keys, canonical)
+	}
+	return keys
+}
+
+/*
+	Função que lê uma imagem pela chave "imagem:<algoritmo>:<hex>" e, durante
+	a transição, pelas chaves antigas. Retorna o valor, a chave com namespace
+	e a chave em que o valor foi encontrado
+*/
+func getImageState(ctx contractapi.TransactionContextInterface, hashImagem string) ([]byte, string, string, error) {
+	imageKey, err := resolveHashKey(imagemNamespace, hashImagem)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	data, err := ctx.GetStub().GetState(imageKey)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("erro ao acessar o ledger: %v", err)
+	}
+	if data != nil {
+		return data, imageKey, imageKey, nil
+	}
+
+	for _, legacyKey := range legacyImageKeys(hashImagem, imageKey) {
+		legacy, err := ctx.GetStub().GetState(legacyKey)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("erro ao acessar o ledger: %v", err)
+		}
+		if legacy != nil && isLegacyImage(legacyKey, legacy) {
+			return legacy, imageKey, legacyKey, nil
+		}
+	}
+
+	return nil, imageKey, imageKey, nil
+}
+
+/*
+	Função que converte uma imagem lida de uma chave antiga antes de alterá-la:
+	o hash passa para a forma canônica, o algoritmo é o da chave nova
+	(inferido pelo tamanho do digest) e o índice "kit~hashImagem" é
+	regravado quando o hash mudou de forma
+*/
+func migrateLegacyImage(ctx contractapi.TransactionContextInterface, imageKey string, legacyKey string, asset *ImageAsset) error {
+	parts := strings.SplitN(imageKey, ":", 3)
+	asset.HashAlgorithm = parts[1]
+	asset.HashData = parts[2]
+	if asset.HashEncoding == "" {
+		asset.HashEncoding = defaultHashEncoding
+	}
+
+	if asset.HashData == legacyKey {
+		return nil
+	}
+
+	oldIndexKey, err := ctx.GetStub().CreateCompositeKey("kit~hashImagem", []string{asset.IDKit, legacyKey})
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(oldIndexKey); err != nil {
+		return err
+	}
+	newIndexKey, err := ctx.GetStub().CreateCompositeKey("kit~hashImagem", []string{asset.IDKit, asset.HashData})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(newIndexKey, []byte{0x00})
+}
+
+/*
+	Função que grava um registro na chave com namespace e remove a cópia
+	antiga, quando o registro foi lido da chave sem prefixo. Assim cada
+	escrita durante a transição também migra o registro
+*/
+func putStateMigrating(ctx contractapi.TransactionContextInterface, key string, foundKey string, value []byte) error {
+	if err := ctx.GetStub().PutState(key, value); err != nil {
+		return err
+	}
+	if foundKey != "" && foundKey != key {
+		return ctx.GetStub().DelState(foundKey)
+	}
+	return nil
+}
+
+// chave que não pôde ser migrada e o motivo
+type SkippedKey struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// resultado de uma execução de MigrateStateKeys
+type KeyMigrationResult struct {
+	Images       int           `json:"images"`
+	Skipped      []*SkippedKey `json:"skipped"`
+	NextStartKey string        `json:"next_start_key"`
+	Done         bool          `json:"done"`
+}
+
+// registro da conclusão da migração de chaves
+type KeyMigrationMarker struct {
+	CompletedAt    string `json:"completed_at"`
+	CompletedByMSP string `json:"completed_by_msp"`
+	CompletedBy    string `json:"completed_by"`
+}
+
+// Cria a chave composta do registro de conclusão da migração
+func keyMigrationMarkerKey(ctx contractapi.TransactionContextInterface) (string, error) {
+	return ctx.GetStub().CreateCompositeKey("config", []string{"migracao_chaves"})
+}
+
+/*
+	Função que migra, uma única vez, as imagens gravadas sob o hash puro
+	para as chaves "imagem:<algoritmo>:<hex>". Restrita a administradores.
+	A varredura começa em startKey (vazio na primeira chamada) e processa
+	no máximo limit chaves; enquanto done for false, a chamada seguinte deve
+	usar o next_start_key devolvido. Ao final da varredura a migração é
+	marcada como concluída e não pode ser executada novamente.
+	Registros que não são imagens são mantidos e listados em skipped
+*/
+func (c *SmartContract) MigrateStateKeys(ctx contractapi.TransactionContextInterface, startKey string, limit int) (*KeyMigrationResult, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit deve ser maior que zero")
+	}
+
+	markerKey, err := keyMigrationMarkerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	marker, err := ctx.GetStub().GetState(markerKey)
+	if err != nil {
+		return nil, err
+	}
+	if marker != nil {
+		return nil, fmt.Errorf("migracao de chaves ja concluida")
+	}
+
+	iterator, err := ctx.GetStub().GetStateByRange(startKey, maxStateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &KeyMigrationResult{Skipped: []*SkippedKey{}}
+
+	// As chaves são lidas antes de migrar, para não alterar o estado
+	// durante a iteração
+	var legacy []*queryresult.KV
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			iterator.Close()
+			return nil, err
+		}
+
+		// Chaves compostas e chaves já migradas ficam como estão
+		if strings.HasPrefix(response.Key, "\x00") || strings.HasPrefix(response.Key, imagemNamespace+":") {
+			continue
+		}
+
+		if len(legacy) == limit {
+			result.NextStartKey = response.Key
+			break
+		}
+		legacy = append(legacy, response)
+	}
+	iterator.Close()
+
+	for _, response := range legacy {
+		if err := migrateLegacyKey(ctx, response.Key, response.Value, result); err != nil {
+			return nil, err
+		}
+	}
+	if result.NextStartKey != "" {
+		return result, nil
+	}
+
+	// Varredura completa: registra a conclusão da migração
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	mspID, subject, err := getSubmitter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	markerBytes, err := json.Marshal(KeyMigrationMarker{
+		CompletedAt: time.Unix(
+			txTime.Seconds,
+			int64(txTime.Nanos),
+		).UTC().Format(time.RFC3339),
+		CompletedByMSP: mspID,
+		CompletedBy:    subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.GetStub().PutState(markerKey, markerBytes); err != nil {
+		return nil, err
+	}
+
+	result.Done = true
+	return result, nil
+}
+
+// Função que move uma imagem antiga para a chave com namespace
+func migrateLegacyKey(ctx contractapi.TransactionContextInterface, key string, value []byte, result *KeyMigrationResult) error {
+	if !isLegacyImage(key, value) {
+		result.Skipped = append(result.Skipped, &SkippedKey{Key: key, Reason: "tipo de registro desconhecido"})
+		return nil
+	}
+
+	imageKey, err := resolveHashKey(imagemNamespace, key)
+	if err != nil {
+		result.Skipped = append(result.Skipped, &SkippedKey{Key: key, Reason: err.Error()})
+		return nil
+	}
+
+	// Um registro já gravado na chave nova nunca é sobrescrito
+	existing, err := ctx.GetStub().GetState(imageKey)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		result.Skipped = append(result.Skipped, &SkippedKey{Key: key, Reason: fmt.Sprintf("chave %s ja existe", imageKey)})
+		return nil
+	}
+
+	var asset ImageAsset
+	if err := json.Unmarshal(value, &asset); err != nil {
+		return err
+	}
+	if err := migrateLegacyImage(ctx, imageKey, key, &asset); err != nil {
+		return err
+	}
+
+	assetBytes, err := json.Marshal(asset)
+	if err != nil {
+		return err
+	}
+
+	result.Images++
+	return putStateMigrating(ctx, imageKey, key, assetBytes)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+// Grava uma imagem sob o hash puro e o seu índice por kit, como fazia a versão sem namespace
+func putLegacyImage(t *testing.T, stub *shimtest.MockStub, idKit string, hashData string) {
+	t.Helper()
+
+	bytes, err := json.Marshal(ImageAsset{IDKit: idKit, HashData: hashData, Timestamp: "2025-01-01T00:00:00Z", LastUpdatedAt: "2025-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stub.PutState(hashData, bytes); err != nil {
+		t.Fatal(err)
+	}
+
+	indexKey, err := stub.CreateCompositeKey("kit~hashImagem", []string{idKit, hashData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stub.PutState(indexKey, []byte{0x00}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Hash sha256 em hex de seed
+func sha256Hex(seed string) string {
+	digest := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestLegacyImagesReadAndMigrate(t *testing.T) {
+	contract, stub, ctx := newTestContract(t)
+
+	// Uma imagem gravada em hex maiúsculo e outra em hex minúsculo
+	upper := strings.ToUpper(sha256Hex("antiga"))
+	lower := sha256Hex("outra")
+
+	stub.MockTransactionStart("legado")
+	putLegacyImage(t, stub, "KIT-1", upper)
+	putLegacyImage(t, stub, "KIT-1", lower)
+	stub.PutState("lixo", []byte(`{"foo":"bar"}`))
+	stub.MockTransactionEnd("legado")
+
+	// Durante a transição as leituras aceitam as chaves antigas
+	for _, hash := range []string{upper, lower} {
+		if image, err := contract.GetImageByID(ctx, hash); err != nil || image.IDKit != "KIT-1" {
+			t.Fatalf("imagem antiga %s nao encontrada: %v", hash, err)
+		}
+		if exists, err := contract.ImageExists(ctx, hash); err != nil || !exists {
+			t.Errorf("ImageExists(%s) = %v, %v", hash, exists, err)
+		}
+	}
+	images, err := contract.GetImagesByKit(ctx, "KIT-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("GetImagesByKit retornou %v", imageHashes(images))
+	}
+
+	// Regravar uma imagem antiga a migra em vez de criar uma duplicata
+	stub.MockTransactionStart("regravacao")
+	if err := contract.StoreImage(ctx, "KIT-1", upper, `{"algorithm":"sha256"}`); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("regravacao")
+
+	canonical := strings.ToLower(upper)
+	image, err := contract.GetImageByID(ctx, canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Version != 1 || image.HashData != canonical || image.HashAlgorithm != "sha256" {
+		t.Errorf("imagem regravada inesperada: %+v", image)
+	}
+	if _, found := stub.State[upper]; found {
+		t.Error("chave antiga deveria ter sido removida")
+	}
+	images, err = contract.GetImagesByKit(ctx, "KIT-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameHashes(imageHashes(images), []string{canonical, lower}) {
+		t.Errorf("GetImagesByKit apos regravacao retornou %v", imageHashes(images))
+	}
+
+	// Apenas administradores migram as chaves
+	stub.MockTransactionStart("operador")
+	if _, err := contract.MigrateStateKeys(ctx, "", 10); err == nil || !strings.Contains(err.Error(), "administradores") {
+		t.Errorf("migracao deveria ser restrita a administradores, erro: %v", err)
+	}
+	stub.MockTransactionEnd("operador")
+
+	// Migração em páginas de uma chave
+	admin := withCreator(t, stub, "org1MSP", "admin", "admin")
+	total := &KeyMigrationResult{}
+	startKey := ""
+	for calls := 0; ; calls++ {
+		if calls > 10 {
+			t.Fatal("migracao nao terminou")
+		}
+
+		stub.MockTransactionStart("migracao")
+		result, err := contract.MigrateStateKeys(admin, startKey, 1)
+		stub.MockTransactionEnd("migracao")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total.Images += result.Images
+		total.Skipped = append(total.Skipped, result.Skipped...)
+		if result.Done {
+			break
+		}
+		startKey = result.NextStartKey
+	}
+
+	if total.Images != 1 || len(total.Skipped) != 1 || total.Skipped[0].Key != "lixo" {
+		t.Errorf("migracao inesperada: %d imagens, ignoradas %+v", total.Images, total.Skipped)
+	}
+	if _, found := stub.State[lower]; found {
+		t.Error("chave antiga deveria ter sido migrada")
+	}
+	image, err = contract.GetImageByID(ctx, lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.HashAlgorithm != "sha256" || image.HashEncoding != "hex" {
+		t.Errorf("imagem migrada sem metadados do hash: %+v", image)
+	}
+
+	stub.MockTransactionStart("de-novo")
+	if _, err := contract.MigrateStateKeys(admin, "", 10); err == nil {
+		t.Error("migracao concluida nao deveria ser executada novamente")
+	}
+	stub.MockTransactionEnd("de-novo")
+}